@@ -0,0 +1,97 @@
+package accounts
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"google.golang.org/api/iterator"
+)
+
+// USERS_COLLECTION holds a users document per customer, named by the UID of their Firebase Auth user.
+const USERS_COLLECTION = "users"
+
+// AuthUser is the part of a Firebase Auth user compared with the users documents.
+type AuthUser struct {
+	UID         string    `json:"uid"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"display_name"`
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	Staff       bool      `json:"-"` // Staff accounts have no users document
+}
+
+// UserDocument is the part of a users document compared with the Auth users.
+type UserDocument struct {
+	ID        string
+	CreatedAt time.Time // Creation time of the Auth user, zero for documents written before it was stored
+}
+
+// ListAuthUsers returns every Firebase Auth user.
+func ListAuthUsers(ctx context.Context, authClient *auth.Client) ([]AuthUser, error) {
+	users := []AuthUser{}
+	iter := authClient.Users(ctx, "")
+	for {
+		userRecord, err := iter.Next()
+		if err == iterator.Done {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, AuthUser{
+			UID:         userRecord.UID,
+			Email:       userRecord.Email,
+			DisplayName: userRecord.DisplayName,
+			Disabled:    userRecord.Disabled,
+			CreatedAt:   time.UnixMilli(userRecord.UserMetadata.CreationTimestamp),
+			Staff:       RoleFromClaims(userRecord.CustomClaims) != ROLE_CUSTOMER,
+		})
+	}
+}
+
+// ListUserDocuments returns the ID and creation time of every users document.
+func ListUserDocuments(ctx context.Context, firestoreClient *firestore.Client) ([]UserDocument, error) {
+	docSnapshots, err := firestoreClient.Collection(USERS_COLLECTION).Select("created_at").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]UserDocument, 0, len(docSnapshots))
+	for _, docSnapshot := range docSnapshots {
+		createdAt, _ := docSnapshot.Data()["created_at"].(time.Time)
+		documents = append(documents, UserDocument{ID: docSnapshot.Ref.ID, CreatedAt: createdAt})
+	}
+	return documents, nil
+}
+
+// FindOrphans compares the Auth users with the users documents, and returns the customers without a
+// document and the IDs of the documents without an Auth user, sorted. Customers and documents created at
+// or after createdBefore are left out: create-account may still be writing the document, and an account
+// created after the Auth users were listed has a document but no listed user.
+func FindOrphans(users []AuthUser, documents []UserDocument, createdBefore time.Time) ([]AuthUser, []string) {
+	authWithoutDocument := []AuthUser{}
+	documentsWithoutAuth := []string{}
+
+	hasDocument := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		hasDocument[document.ID] = true
+	}
+
+	hasAuthUser := make(map[string]bool, len(users))
+	for _, user := range users {
+		hasAuthUser[user.UID] = true
+		if !user.Staff && !hasDocument[user.UID] && user.CreatedAt.Before(createdBefore) {
+			authWithoutDocument = append(authWithoutDocument, user)
+		}
+	}
+
+	for _, document := range documents {
+		if !hasAuthUser[document.ID] && document.CreatedAt.Before(createdBefore) {
+			documentsWithoutAuth = append(documentsWithoutAuth, document.ID)
+		}
+	}
+	slices.Sort(documentsWithoutAuth)
+	return authWithoutDocument, documentsWithoutAuth
+}
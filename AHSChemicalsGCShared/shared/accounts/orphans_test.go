@@ -0,0 +1,34 @@
+package accounts_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Now()
+	users := []accounts.AuthUser{
+		{UID: "complete", CreatedAt: now.Add(-time.Hour)},
+		{UID: "orphan", CreatedAt: now.Add(-time.Hour)},
+		{UID: "being-created", CreatedAt: now},
+		{UID: "staff", CreatedAt: now.Add(-time.Hour), Staff: true},
+	}
+	documents := []accounts.UserDocument{
+		{ID: "complete", CreatedAt: now.Add(-time.Hour)},
+		{ID: "deleted-b", CreatedAt: now.Add(-time.Hour)},
+		{ID: "deleted-a"},
+		// Created after the Auth users were listed
+		{ID: "created-since-listing", CreatedAt: now},
+	}
+
+	authWithoutDocument, documentsWithoutAuth := accounts.FindOrphans(users, documents, now.Add(-15*time.Minute))
+
+	if len(authWithoutDocument) != 1 || authWithoutDocument[0].UID != "orphan" {
+		t.Errorf("Expected only orphan without a document, got %v", authWithoutDocument)
+	}
+	if len(documentsWithoutAuth) != 2 || documentsWithoutAuth[0] != "deleted-a" || documentsWithoutAuth[1] != "deleted-b" {
+		t.Errorf("Expected deleted-a and deleted-b without an Auth user, got %v", documentsWithoutAuth)
+	}
+}
@@ -0,0 +1,169 @@
+// Package accounts holds the portal's account model shared by the functions: the roles stored in the
+// Firebase custom claims and the permission matrix deciding what each role may do.
+package accounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// Roles a portal user can have. The role is stored in the "role" custom claim, users without one are
+// customers. Owners and admins also get the "admin" claim the functions outside of the permission
+// matrix still check.
+const (
+	ROLE_OWNER     = "owner"
+	ROLE_ADMIN     = "admin"
+	ROLE_SALES_REP = "sales_rep"
+	ROLE_WAREHOUSE = "warehouse"
+	ROLE_CUSTOMER  = "customer"
+)
+
+// Permission is an action a role may be allowed to perform.
+type Permission string
+
+const (
+	PERMISSION_CREATE_ACCOUNT     Permission = "create_account"
+	PERMISSION_UPDATE_ACCOUNT     Permission = "update_account"
+	PERMISSION_DELETE_ACCOUNT     Permission = "delete_account"
+	PERMISSION_FETCH_ACCOUNTS     Permission = "fetch_accounts"
+	PERMISSION_CREATE_INVOICE     Permission = "create_invoice"
+	PERMISSION_SYNC_CUSTOMERS     Permission = "sync_customers"     // Link accounts to QuickBooks customers
+	PERMISSION_SEND_MAIL          Permission = "send_mail"          // Email any recipient through send-mail
+	PERMISSION_SEND_SMS           Permission = "send_sms"           // Text the configured staff phones
+	PERMISSION_ASSIGN_REPS        Permission = "assign_reps"        // Reassign customers between sales reps
+	PERMISSION_RECONCILE_ACCOUNTS Permission = "reconcile_accounts" // Report and repair accounts missing from Auth or Firestore
+	PERMISSION_MANAGE_ROLES       Permission = "manage_roles"
+	PERMISSION_MANAGE_ORDERS      Permission = "manage_orders"  // Approve, invoice and cancel orders
+	PERMISSION_FULFILL_ORDERS     Permission = "fulfill_orders" // Mark orders as shipped and delivered
+)
+
+// ASSIGNED_REP_FIELD is the users document field holding the UID of the sales rep a customer is assigned to.
+const ASSIGNED_REP_FIELD = "assigned_rep"
+
+// rolePermissions is the permission matrix of the portal.
+var rolePermissions = map[string][]Permission{
+	ROLE_OWNER: {
+		PERMISSION_CREATE_ACCOUNT, PERMISSION_UPDATE_ACCOUNT, PERMISSION_DELETE_ACCOUNT, PERMISSION_FETCH_ACCOUNTS,
+		PERMISSION_CREATE_INVOICE, PERMISSION_SYNC_CUSTOMERS, PERMISSION_SEND_MAIL, PERMISSION_SEND_SMS,
+		PERMISSION_ASSIGN_REPS, PERMISSION_RECONCILE_ACCOUNTS, PERMISSION_MANAGE_ROLES, PERMISSION_MANAGE_ORDERS,
+		PERMISSION_FULFILL_ORDERS,
+	},
+	ROLE_ADMIN: {
+		PERMISSION_CREATE_ACCOUNT, PERMISSION_UPDATE_ACCOUNT, PERMISSION_DELETE_ACCOUNT, PERMISSION_FETCH_ACCOUNTS,
+		PERMISSION_CREATE_INVOICE, PERMISSION_SYNC_CUSTOMERS, PERMISSION_SEND_MAIL, PERMISSION_SEND_SMS,
+		PERMISSION_ASSIGN_REPS, PERMISSION_RECONCILE_ACCOUNTS, PERMISSION_MANAGE_ORDERS, PERMISSION_FULFILL_ORDERS,
+	},
+	// Sales reps only manage the customers assigned to them, see IsScopedToAssignedAccounts
+	ROLE_SALES_REP: {
+		PERMISSION_CREATE_ACCOUNT, PERMISSION_UPDATE_ACCOUNT, PERMISSION_DELETE_ACCOUNT, PERMISSION_FETCH_ACCOUNTS,
+		PERMISSION_SYNC_CUSTOMERS, PERMISSION_SEND_MAIL, PERMISSION_SEND_SMS,
+	},
+	ROLE_WAREHOUSE: {
+		PERMISSION_FETCH_ACCOUNTS, PERMISSION_SEND_MAIL, PERMISSION_SEND_SMS, PERMISSION_FULFILL_ORDERS,
+	},
+	// Customers only use the functions checking the caller's own account, such as place-order
+	ROLE_CUSTOMER: {},
+}
+
+// ErrPermissionDenied is returned when the caller's role does not grant the requested permission.
+var ErrPermissionDenied = errors.New("Your role does not allow this action")
+
+// IsValidRole reports whether role is one of the portal roles.
+func IsValidRole(role string) bool {
+	_, found := rolePermissions[role]
+	return found
+}
+
+// RoleFromClaims returns the role of a user from their custom claims. Admins created before roles
+// existed only have the "admin" claim, and users without claims are customers.
+func RoleFromClaims(claims map[string]any) string {
+	if role, _ := claims["role"].(string); IsValidRole(role) {
+		return role
+	}
+	if isAdmin, _ := claims["admin"].(bool); isAdmin {
+		return ROLE_ADMIN
+	}
+	return ROLE_CUSTOMER
+}
+
+// ClaimsForRole returns the custom claims granting role, nil for customers.
+func ClaimsForRole(role string) map[string]any {
+	switch role {
+	case ROLE_CUSTOMER:
+		return nil
+	case ROLE_OWNER, ROLE_ADMIN:
+		return map[string]any{"role": role, "admin": true}
+	default:
+		return map[string]any{"role": role}
+	}
+}
+
+// MergeRoleClaims returns claims with its role claims replaced by the ones granting role, keeping the
+// custom claims set for anything else. claims is not modified.
+func MergeRoleClaims(claims map[string]any, role string) map[string]any {
+	merged := make(map[string]any, len(claims)+2)
+	for key, value := range claims {
+		if key != "role" && key != "admin" {
+			merged[key] = value
+		}
+	}
+	for key, value := range ClaimsForRole(role) {
+		merged[key] = value
+	}
+	return merged
+}
+
+// HasPermission reports whether role grants permission.
+func HasPermission(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// IsScopedToAssignedAccounts reports whether role only manages the customers whose users document lists
+// the caller as assigned_rep, rather than every account.
+func IsScopedToAssignedAccounts(role string) bool {
+	return role == ROLE_SALES_REP
+}
+
+// CanManageAccount reports whether a caller with role and callerUID may see and modify the customer
+// assigned to assignedRep.
+func CanManageAccount(role string, callerUID string, assignedRep string) bool {
+	return !IsScopedToAssignedAccounts(role) || (assignedRep != "" && assignedRep == callerUID)
+}
+
+// VerifyCaller verifies the Firebase ID token of the request with authClient and returns it, so that the
+// caller's role can be read from its claims. Tokens issued before the user's refresh tokens were revoked,
+// such as when set-user-role changed their role, are rejected.
+func VerifyCaller(ctx context.Context, authClient *auth.Client, request *http.Request) (*auth.Token, error) {
+	authorization := request.Header.Get("Authorization")
+	idToken, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || idToken == "" {
+		return nil, errors.New("Missing or invalid Authorization header")
+	}
+	return authClient.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+}
+
+// AuthorizeCaller verifies the Firebase ID token of the request and checks that the caller's role
+// grants permission. ErrPermissionDenied is returned for a valid token without the permission.
+func AuthorizeCaller(ctx context.Context, authClient *auth.Client, request *http.Request, permission Permission) (*auth.Token, error) {
+	token, err := VerifyCaller(ctx, authClient, request)
+	if err != nil {
+		return nil, err
+	}
+	if !HasPermission(RoleFromClaims(token.Claims), permission) {
+		return nil, ErrPermissionDenied
+	}
+	return token, nil
+}
+
+// AuthorizationStatus returns the HTTP status for an error of AuthorizeCaller.
+func AuthorizationStatus(err error) int {
+	if errors.Is(err, ErrPermissionDenied) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,116 @@
+package accounts_test
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestRoleFromClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   string
+	}{
+		{"No claims", nil, accounts.ROLE_CUSTOMER},
+		{"Role claim", map[string]any{"role": "sales_rep"}, accounts.ROLE_SALES_REP},
+		{"Admin claim from before roles", map[string]any{"admin": true}, accounts.ROLE_ADMIN},
+		{"Owner with admin claim", map[string]any{"role": "owner", "admin": true}, accounts.ROLE_OWNER},
+		{"Unknown role", map[string]any{"role": "superuser"}, accounts.ROLE_CUSTOMER},
+	}
+
+	for _, tt := range tests {
+		if got := accounts.RoleFromClaims(tt.claims); got != tt.want {
+			t.Errorf("[%s] Expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestClaimsForRoleRoundTrip(t *testing.T) {
+	for _, role := range []string{
+		accounts.ROLE_OWNER, accounts.ROLE_ADMIN, accounts.ROLE_SALES_REP, accounts.ROLE_WAREHOUSE, accounts.ROLE_CUSTOMER,
+	} {
+		claims := accounts.ClaimsForRole(role)
+		if got := accounts.RoleFromClaims(claims); got != role {
+			t.Errorf("Expected %s, got %s", role, got)
+		}
+
+		// The functions outside of the permission matrix still check the admin claim
+		isAdmin, _ := claims["admin"].(bool)
+		if wantAdmin := role == accounts.ROLE_OWNER || role == accounts.ROLE_ADMIN; isAdmin != wantAdmin {
+			t.Errorf("[%s] Expected admin claim %v, got %v", role, wantAdmin, isAdmin)
+		}
+	}
+}
+
+func TestMergeRoleClaims(t *testing.T) {
+	claims := map[string]any{"role": "owner", "admin": true, "tenant": "ahs"}
+
+	merged := accounts.MergeRoleClaims(claims, accounts.ROLE_WAREHOUSE)
+	if !maps.Equal(merged, map[string]any{"role": "warehouse", "tenant": "ahs"}) {
+		t.Errorf("Expected the warehouse role and the other claims, got %v", merged)
+	}
+	if merged := accounts.MergeRoleClaims(claims, accounts.ROLE_CUSTOMER); !maps.Equal(merged, map[string]any{"tenant": "ahs"}) {
+		t.Errorf("Expected only the other claims for a customer, got %v", merged)
+	}
+	if merged := accounts.MergeRoleClaims(nil, accounts.ROLE_ADMIN); !maps.Equal(merged, map[string]any{"role": "admin", "admin": true}) {
+		t.Errorf("Expected the admin claims, got %v", merged)
+	}
+	if len(claims) != 3 {
+		t.Errorf("Expected the claims to be left unchanged, got %v", claims)
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission accounts.Permission
+		want       bool
+	}{
+		{accounts.ROLE_OWNER, accounts.PERMISSION_MANAGE_ROLES, true},
+		{accounts.ROLE_ADMIN, accounts.PERMISSION_MANAGE_ROLES, false},
+		{accounts.ROLE_ADMIN, accounts.PERMISSION_CREATE_INVOICE, true},
+		{accounts.ROLE_SALES_REP, accounts.PERMISSION_CREATE_INVOICE, false},
+		{accounts.ROLE_SALES_REP, accounts.PERMISSION_DELETE_ACCOUNT, true},
+		{accounts.ROLE_SALES_REP, accounts.PERMISSION_SYNC_CUSTOMERS, true},
+		{accounts.ROLE_WAREHOUSE, accounts.PERMISSION_SYNC_CUSTOMERS, false},
+		{accounts.ROLE_WAREHOUSE, accounts.PERMISSION_FETCH_ACCOUNTS, true},
+		{accounts.ROLE_WAREHOUSE, accounts.PERMISSION_UPDATE_ACCOUNT, false},
+		{accounts.ROLE_WAREHOUSE, accounts.PERMISSION_FULFILL_ORDERS, true},
+		{accounts.ROLE_WAREHOUSE, accounts.PERMISSION_MANAGE_ORDERS, false},
+		{accounts.ROLE_ADMIN, accounts.PERMISSION_MANAGE_ORDERS, true},
+		{accounts.ROLE_SALES_REP, accounts.PERMISSION_FULFILL_ORDERS, false},
+		{accounts.ROLE_CUSTOMER, accounts.PERMISSION_SEND_SMS, false},
+		{accounts.ROLE_CUSTOMER, accounts.PERMISSION_SEND_MAIL, false},
+		{accounts.ROLE_CUSTOMER, accounts.PERMISSION_FETCH_ACCOUNTS, false},
+		{"superuser", accounts.PERMISSION_FETCH_ACCOUNTS, false},
+	}
+
+	for _, tt := range tests {
+		if got := accounts.HasPermission(tt.role, tt.permission); got != tt.want {
+			t.Errorf("[%s %s] Expected %v, got %v", tt.role, tt.permission, tt.want, got)
+		}
+	}
+}
+
+func TestCanManageAccount(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		assignedRep string
+		want        bool
+	}{
+		{"Admin on any account", accounts.ROLE_ADMIN, "rep1", true},
+		{"Admin on unassigned account", accounts.ROLE_ADMIN, "", true},
+		{"Rep on own account", accounts.ROLE_SALES_REP, "rep1", true},
+		{"Rep on another rep's account", accounts.ROLE_SALES_REP, "rep2", false},
+		{"Rep on unassigned account", accounts.ROLE_SALES_REP, "", false},
+	}
+
+	for _, tt := range tests {
+		if got := accounts.CanManageAccount(tt.role, "rep1", tt.assignedRep); got != tt.want {
+			t.Errorf("[%s] Expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
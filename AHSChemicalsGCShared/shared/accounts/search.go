@@ -0,0 +1,74 @@
+package accounts
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// SearchFields returns the users document fields fetch-accounts filters, sorts and pages on: the
+// lowercased name and email, the disabled flag, role and creation time of the Auth user, and the filter
+// keys of the account's brands and properties. They are written along with the document, and again
+// whenever the user's brands or properties change.
+func SearchFields(userRecord *auth.UserRecord, brands []string, properties []map[string]string) map[string]any {
+	createdAt := time.Time{}
+	if userRecord.UserMetadata != nil {
+		createdAt = time.UnixMilli(userRecord.UserMetadata.CreationTimestamp)
+	}
+
+	return map[string]any{
+		"name_lower":  strings.ToLower(userRecord.DisplayName),
+		"email_lower": strings.ToLower(userRecord.Email),
+		"disabled":    userRecord.Disabled,
+		"role":        RoleFromClaims(userRecord.CustomClaims),
+		"created_at":  createdAt,
+		"filter_keys": FilterKeys(brands, properties),
+	}
+}
+
+// FilterKeys returns the keys an account is found by when filtering on a brand, a state, a county, a
+// state and county of the same property, or a brand along with any of those. Firestore allows a single
+// array-contains filter per query, so every combination gets its own key.
+func FilterKeys(brands []string, properties []map[string]string) []string {
+	var locations []string
+	for _, property := range properties {
+		locations = append(locations,
+			FilterKey("", property["state"], ""),
+			FilterKey("", "", property["county"]),
+			FilterKey("", property["state"], property["county"]),
+		)
+	}
+
+	keys := slices.Clone(locations)
+	for _, brand := range brands {
+		keys = append(keys, FilterKey(brand, "", ""))
+		for _, property := range properties {
+			keys = append(keys,
+				FilterKey(brand, property["state"], ""),
+				FilterKey(brand, "", property["county"]),
+				FilterKey(brand, property["state"], property["county"]),
+			)
+		}
+	}
+
+	slices.Sort(keys)
+	return slices.Compact(slices.DeleteFunc(keys, func(key string) bool { return key == "" }))
+}
+
+// FilterKey returns the filter key of a brand, state and county, any of which may be empty. Values are
+// compared case insensitively. An empty key is returned when all three are empty.
+func FilterKey(brand string, state string, county string) string {
+	var parts []string
+	if brand = strings.ToLower(strings.TrimSpace(brand)); brand != "" {
+		parts = append(parts, "brand:"+brand)
+	}
+	if state = strings.ToLower(strings.TrimSpace(state)); state != "" {
+		parts = append(parts, "state:"+state)
+	}
+	if county = strings.ToLower(strings.TrimSpace(county)); county != "" {
+		parts = append(parts, "county:"+county)
+	}
+	return strings.Join(parts, "|")
+}
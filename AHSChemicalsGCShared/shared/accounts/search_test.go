@@ -0,0 +1,72 @@
+package accounts_test
+
+import (
+	"slices"
+	"testing"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestFilterKeys(t *testing.T) {
+	type account struct {
+		uid        string
+		brands     []string
+		properties []map[string]string
+	}
+	listed := []account{
+		{uid: "c", brands: []string{"Clorox"}, properties: []map[string]string{{"state": "CA", "county": "Fresno"}}},
+		{uid: "a", brands: []string{"Kem Tek"}, properties: []map[string]string{{"state": "CA", "county": "Kern"}, {"state": "NV", "county": "Clark"}}},
+		{uid: "b", brands: []string{"Clorox", "Kem Tek"}, properties: []map[string]string{{"state": "NV", "county": "Washoe"}}},
+	}
+
+	tests := []struct {
+		brand, state, county string
+		want                 []string
+	}{
+		{brand: "clorox", want: []string{"c", "b"}},
+		{state: "nv", want: []string{"a", "b"}},
+		{county: "kern", want: []string{"a"}},
+		{state: "NV", county: "Kern", want: nil}, // Kern is in California
+		{brand: "Kem Tek", state: "CA", want: []string{"a"}},
+		{brand: " KEM TEK ", county: "Washoe", want: []string{"b"}},
+		{brand: "Clorox", state: "NV", county: "Clark", want: nil}, // The Clark property is not a Clorox account's
+	}
+
+	for _, tt := range tests {
+		key := accounts.FilterKey(tt.brand, tt.state, tt.county)
+		var got []string
+		for _, account := range listed {
+			if slices.Contains(accounts.FilterKeys(account.brands, account.properties), key) {
+				got = append(got, account.uid)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("[%s] Expected %v, got %v", key, tt.want, got)
+		}
+	}
+
+	if key := accounts.FilterKey("", " ", ""); key != "" {
+		t.Errorf("Expected no key without filters, got %q", key)
+	}
+}
+
+func TestSearchFields(t *testing.T) {
+	userRecord := &auth.UserRecord{
+		UserInfo:     &auth.UserInfo{DisplayName: "Carol Smith", Email: "Carol@Pool.com"},
+		Disabled:     true,
+		CustomClaims: map[string]any{"role": accounts.ROLE_SALES_REP},
+		UserMetadata: &auth.UserMetadata{CreationTimestamp: 3000},
+	}
+
+	fields := accounts.SearchFields(userRecord, []string{"Clorox"}, []map[string]string{{"state": "CA", "county": "Fresno"}})
+	if fields["name_lower"] != "carol smith" || fields["email_lower"] != "carol@pool.com" {
+		t.Errorf("Expected the name and email to be lowercased, got %v and %v", fields["name_lower"], fields["email_lower"])
+	}
+	if fields["disabled"] != true || fields["role"] != accounts.ROLE_SALES_REP {
+		t.Errorf("Expected the disabled flag and role of the Auth user, got %v and %v", fields["disabled"], fields["role"])
+	}
+	if keys := fields["filter_keys"].([]string); !slices.Contains(keys, "brand:clorox|state:ca|county:fresno") {
+		t.Errorf("Expected the filter keys of the brand and property, got %v", keys)
+	}
+}
@@ -0,0 +1,63 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// CheckSalesRep returns an error, meant for the caller, unless uid is a user with the sales rep role.
+func CheckSalesRep(ctx context.Context, authClient *auth.Client, uid string) error {
+	userRecord, err := authClient.GetUser(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("No sales rep found with UID %s", uid)
+	}
+	if RoleFromClaims(userRecord.CustomClaims) != ROLE_SALES_REP {
+		return fmt.Errorf("User %s is not a sales rep", uid)
+	}
+	return nil
+}
+
+// TriggerQuickBooksSync asks the quickbooks-sync-customers function, at QUICKBOOKS_SYNC_CUSTOMERS_URL, to
+// link the user to a QuickBooks Customer. The caller's Authorization header is forwarded, so the sync is
+// authorized for their role and runs with their QuickBooks connection, or for sales reps with a company
+// connected by an owner or admin.
+func TriggerQuickBooksSync(ctx context.Context, authorization string, uid string) error {
+	syncURL := os.Getenv("QUICKBOOKS_SYNC_CUSTOMERS_URL")
+	if syncURL == "" {
+		return errors.New("QUICKBOOKS_SYNC_CUSTOMERS_URL is not configured")
+	}
+
+	body, err := json.Marshal(map[string]string{"uid": uid})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, syncURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("quickbooks-sync-customers returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package accounts_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestTriggerQuickBooksSync(t *testing.T) {
+	var authorization string
+	var body map[string]string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		authorization = request.Header.Get("Authorization")
+		json.NewDecoder(request.Body).Decode(&body)
+		response.WriteHeader(status)
+	}))
+	defer server.Close()
+	t.Setenv("QUICKBOOKS_SYNC_CUSTOMERS_URL", server.URL)
+
+	if err := accounts.TriggerQuickBooksSync(context.Background(), "Bearer token", "c1"); err != nil {
+		t.Fatalf("Expected the sync to succeed, got %v", err)
+	}
+	if authorization != "Bearer token" || body["uid"] != "c1" {
+		t.Errorf("Expected the caller's token and c1 to be forwarded, got %q and %v", authorization, body)
+	}
+
+	status = http.StatusBadGateway
+	if err := accounts.TriggerQuickBooksSync(context.Background(), "Bearer token", "c1"); err == nil {
+		t.Error("Expected a failed sync to be reported")
+	}
+
+	t.Setenv("QUICKBOOKS_SYNC_CUSTOMERS_URL", "")
+	if err := accounts.TriggerQuickBooksSync(context.Background(), "Bearer token", "c1"); err == nil {
+		t.Error("Expected an error when the sync function is not configured")
+	}
+}
@@ -0,0 +1,686 @@
+// Package quickbooks is the client of the QuickBooks Online accounting API used by the quickbooks_*
+// functions: environment configuration, the OAuth tokens stored in Firestore, and authorized requests
+// with token refresh, retries and Fault parsing.
+package quickbooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/firestore"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+)
+
+const (
+	// Values of the QUICKBOOKS_ENVIRONMENT variable selecting the Intuit environment of a deployment
+	QUICKBOOKS_ENVIRONMENT_PRODUCTION = "production"
+	QUICKBOOKS_ENVIRONMENT_SANDBOX    = "sandbox"
+
+	// Intuit's OAuth2 token endpoint, shared by both environments
+	QUICKBOOKS_TOKEN_URL = "https://oauth.platform.intuit.com/oauth2/v1/tokens/bearer"
+
+	// Access tokens expiring within this margin are refreshed before use
+	accessTokenRefreshMargin = 5 * time.Minute
+
+	// Attempts made for a request QuickBooks throttled or was temporarily unable to serve
+	quickBooksMaxAttempts = 4
+
+	// Delay before the first retry, doubled on every following one unless QuickBooks sends Retry-After
+	quickBooksRetryDelay = time.Second
+
+	// Longest wait between two attempts, Intuit's throttling window is one minute
+	quickBooksMaxRetryDelay = 30 * time.Second
+
+	// QuickBooks Fault codes with a dedicated response
+	QUICKBOOKS_FAULT_DUPLICATE_DOC_NUMBER = "6140" // DocNumber already used by another transaction
+	QUICKBOOKS_FAULT_STALE_OBJECT         = "5010" // SyncToken is outdated, the entity was changed in the meantime
+	QUICKBOOKS_FAULT_INVALID_REFERENCE    = "2500" // A referenced entity does not exist or is inactive
+	QUICKBOOKS_FAULT_OBJECT_NOT_FOUND     = "610"  // A referenced entity was deleted
+
+	// Error codes returned to the frontend for QuickBooks rejections
+	ERROR_CODE_DUPLICATE_DOC_NUMBER = "duplicate_doc_number"
+	ERROR_CODE_STALE_OBJECT         = "stale_object"
+	ERROR_CODE_INVALID_REFERENCE    = "invalid_reference"
+	ERROR_CODE_QUICKBOOKS_REJECTED  = "quickbooks_rejected"
+)
+
+// quickBooksElementFields maps the segments of a Fault element to the request fields of our functions.
+// Segments mapped to "" are dropped, unknown segments are converted to snake case.
+var quickBooksElementFields = map[string]string{
+	"Line":                "lines",
+	"SalesItemLineDetail": "",
+	"ItemRef":             "item_ref",
+	"Qty":                 "quantity",
+	"TaxCodeRef":          "tax_code",
+	"ShipAddr":            "ship_to",
+	"CustomerMemo":        "memo",
+	"TotalAmt":            "amount",
+}
+
+// QuickBooksConfig holds the Intuit app credentials and the Firestore storage of one QuickBooks environment.
+// Sandbox tokens, connections and customer links are stored apart from the production ones, so a sandbox
+// deployment can never use a production company.
+type QuickBooksConfig struct {
+	Environment           string // production or sandbox
+	APIURL                string // Base URL of the accounting API
+	SecretPrefix          string // Prefix of the environment's secrets, e.g. QUICKBOOKS_SANDBOX_
+	ConnectionsCollection string // Firestore collection holding one document per admin UID listing the companies they connected
+	TokensCollection      string // Firestore collection holding one token document per connection (admin UID + realm ID)
+	CustomerIDsField      string // users document field mapping realm IDs to the user's QuickBooks customer ID
+	ClientID              string
+	ClientSecret          string
+}
+
+// QuickBooks is the configuration of the environment selected by InitQuickBooks.
+var QuickBooks = &QuickBooksConfig{}
+
+// NewQuickBooksConfig returns the configuration of the environment without its credentials. An empty
+// environment selects production.
+func NewQuickBooksConfig(environment string) (*QuickBooksConfig, error) {
+	switch environment {
+	case "", QUICKBOOKS_ENVIRONMENT_PRODUCTION:
+		return &QuickBooksConfig{
+			Environment:           QUICKBOOKS_ENVIRONMENT_PRODUCTION,
+			APIURL:                "https://quickbooks.api.intuit.com",
+			SecretPrefix:          "QUICKBOOKS_",
+			ConnectionsCollection: "quickbooks_connections",
+			TokensCollection:      "quickbooks_tokens",
+			CustomerIDsField:      "quickbooks_customer_ids",
+		}, nil
+	case QUICKBOOKS_ENVIRONMENT_SANDBOX:
+		return &QuickBooksConfig{
+			Environment:           QUICKBOOKS_ENVIRONMENT_SANDBOX,
+			APIURL:                "https://sandbox-quickbooks.api.intuit.com",
+			SecretPrefix:          "QUICKBOOKS_SANDBOX_",
+			ConnectionsCollection: "quickbooks_sandbox_connections",
+			TokensCollection:      "quickbooks_sandbox_tokens",
+			CustomerIDsField:      "quickbooks_sandbox_customer_ids",
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown QuickBooks environment %q, expected %q or %q", environment, QUICKBOOKS_ENVIRONMENT_PRODUCTION, QUICKBOOKS_ENVIRONMENT_SANDBOX)
+}
+
+// SecretName returns the name of an environment specific secret, e.g. CLIENT_ID becomes
+// QUICKBOOKS_SANDBOX_CLIENT_ID in the sandbox.
+func (config *QuickBooksConfig) SecretName(name string) string {
+	return config.SecretPrefix + name
+}
+
+// InitQuickBooks selects the environment named by the QUICKBOOKS_ENVIRONMENT variable (production when
+// unset) and loads its app credentials. In production mode (ENV != DEBUG), the credentials are retrieved
+// from Google Secret Manager, in debug mode from environment variables of the same name.
+func InitQuickBooks(ctx context.Context) error {
+	config, err := NewQuickBooksConfig(os.Getenv("QUICKBOOKS_ENVIRONMENT"))
+	if err != nil {
+		return err
+	}
+
+	secrets := map[string]*string{
+		config.SecretName("CLIENT_ID"):     &config.ClientID,
+		config.SecretName("CLIENT_SECRET"): &config.ClientSecret,
+	}
+	if os.Getenv("ENV") != "DEBUG" {
+		projectID, err := metadata.ProjectIDWithContext(ctx)
+		if err != nil {
+			return fmt.Errorf("retrieving project ID from metadata: %w", err)
+		}
+		for name, target := range secrets {
+			secretPath := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, name)
+			if *target, err = shared.GetSecretFromGCP(secretPath); err != nil {
+				return fmt.Errorf("fetching %s from Secret Manager: %w", name, err)
+			}
+		}
+	} else {
+		for name, target := range secrets {
+			*target = os.Getenv(name)
+		}
+	}
+
+	QuickBooks = config
+	return nil
+}
+
+// HTTPClient is shared by all sessions so connections to Intuit are reused.
+var HTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// ErrQuickBooksNotConnected is returned when the admin has not connected the requested QuickBooks company.
+var ErrQuickBooksNotConnected = errors.New("no QuickBooks company connected")
+
+// ErrQuickBooksTokenRevoked is returned when Intuit no longer accepts the stored refresh token, because the
+// company was disconnected or the refresh token expired.
+var ErrQuickBooksTokenRevoked = errors.New("QuickBooks refresh token is no longer valid")
+
+// QuickBooksConnection describes one QuickBooks company an admin has connected.
+type QuickBooksConnection struct {
+	TokenKey    string    `firestore:"token_key"`    // Document ID of the stored token data
+	ConnectedAt time.Time `firestore:"connected_at"` // When the admin authorized the company
+}
+
+// QuickBooksConnections is the Firestore document stored per admin UID by the quickbooks-callback function.
+type QuickBooksConnections struct {
+	DefaultRealmID string                          `firestore:"default_realm_id"` // Company used when no realm_id is requested
+	Realms         map[string]QuickBooksConnection `firestore:"realms"`           // Connected companies keyed by realm ID
+}
+
+// QuickBooksSession is an authorized connection to one QuickBooks company.
+type QuickBooksSession struct {
+	RealmID     string
+	AccessToken string
+	tokenKey    string // Token document the access token is refreshed from when QuickBooks rejects it
+}
+
+// QuickBooksError is returned when QuickBooks rejects a request. Errors holds the entries of the Fault
+// QuickBooks responded with, and is empty when the response was not a Fault.
+type QuickBooksError struct {
+	StatusCode int                    // HTTP status returned by QuickBooks
+	FaultType  string                 // Fault type such as ValidationFault or AuthenticationFault
+	Errors     []QuickBooksFaultError // Individual errors of the Fault
+	Body       string                 // Raw response body when it could not be parsed as a Fault
+}
+
+// QuickBooksFaultError is one entry of a QuickBooks Fault.
+type QuickBooksFaultError struct {
+	Message string `json:"Message"`
+	Detail  string `json:"Detail"`
+	Code    string `json:"code"`
+	Element string `json:"element"`
+}
+
+func (err *QuickBooksError) Error() string {
+	if len(err.Errors) == 0 {
+		return fmt.Sprintf("QuickBooks API Error (%d): %s", err.StatusCode, err.Body)
+	}
+
+	messages := make([]string, 0, len(err.Errors))
+	for _, faultError := range err.Errors {
+		message := faultError.Message
+		if faultError.Detail != "" {
+			message += ": " + faultError.Detail
+		}
+		messages = append(messages, message)
+	}
+	return fmt.Sprintf("QuickBooks API Error (%d): %s", err.StatusCode, strings.Join(messages, "; "))
+}
+
+// ParseQuickBooksError builds the QuickBooksError of a rejected response from its status code and body.
+// QuickBooks sends the Fault either at the top level or, for some endpoints, inside an IntuitResponse.
+func ParseQuickBooksError(statusCode int, body []byte) *QuickBooksError {
+	type fault struct {
+		Error []QuickBooksFaultError `json:"Error"`
+		Type  string                 `json:"type"`
+	}
+	var parsed struct {
+		Fault          *fault `json:"Fault"`
+		IntuitResponse *struct {
+			Fault *fault `json:"Fault"`
+		} `json:"IntuitResponse"`
+	}
+
+	qbErr := &QuickBooksError{StatusCode: statusCode}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		found := parsed.Fault
+		if found == nil && parsed.IntuitResponse != nil {
+			found = parsed.IntuitResponse.Fault
+		}
+		if found != nil && len(found.Error) > 0 {
+			qbErr.FaultType = found.Type
+			qbErr.Errors = found.Error
+			return qbErr
+		}
+	}
+	qbErr.Body = strings.TrimSpace(string(body))
+	return qbErr
+}
+
+// QuickBooksFieldError is one entry of a QuickBooks Fault as returned to the frontend.
+type QuickBooksFieldError struct {
+	Field   string `json:"field,omitempty"`  // Request field the error refers to, e.g. lines.item_ref
+	Code    string `json:"code"`             // QuickBooks error code
+	Message string `json:"message"`          // Human readable reason
+	Detail  string `json:"detail,omitempty"` // Additional explanation given by QuickBooks
+}
+
+// Code returns the error code of the rejection: duplicate_doc_number, stale_object, invalid_reference, or
+// quickbooks_rejected for any other Fault.
+func (err *QuickBooksError) Code() string {
+	for _, faultError := range err.Errors {
+		switch faultError.Code {
+		case QUICKBOOKS_FAULT_DUPLICATE_DOC_NUMBER:
+			return ERROR_CODE_DUPLICATE_DOC_NUMBER
+		case QUICKBOOKS_FAULT_STALE_OBJECT:
+			return ERROR_CODE_STALE_OBJECT
+		case QUICKBOOKS_FAULT_INVALID_REFERENCE, QUICKBOOKS_FAULT_OBJECT_NOT_FOUND:
+			return ERROR_CODE_INVALID_REFERENCE
+		}
+	}
+	return ERROR_CODE_QUICKBOOKS_REJECTED
+}
+
+// FieldErrors translates the Fault entries into errors on the request fields of our functions.
+func (err *QuickBooksError) FieldErrors() []QuickBooksFieldError {
+	fieldErrors := make([]QuickBooksFieldError, 0, len(err.Errors))
+	for _, faultError := range err.Errors {
+		fieldErrors = append(fieldErrors, QuickBooksFieldError{
+			Field:   elementToField(faultError.Element),
+			Code:    faultError.Code,
+			Message: faultError.Message,
+			Detail:  faultError.Detail,
+		})
+	}
+	return fieldErrors
+}
+
+// elementToField converts a Fault element such as Line.SalesItemLineDetail.ItemRef to the request field
+// lines.item_ref.
+func elementToField(element string) string {
+	var segments []string
+	for _, segment := range strings.Split(element, ".") {
+		field, ok := quickBooksElementFields[segment]
+		if !ok {
+			field = toSnakeCase(segment)
+		}
+		if field != "" {
+			segments = append(segments, field)
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// toSnakeCase converts a QuickBooks property name such as DocNumber to doc_number.
+func toSnakeCase(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// QuickBooksErrorStatus returns the HTTP status a function should respond with when a QuickBooks request
+// failed with err. Transactions QuickBooks refused to save are reported as 409 Conflict when they clash
+// with existing data and as 422 Unprocessable Entity otherwise, problems with the admin's authorization
+// keep their meaning, and QuickBooks outages and network failures are reported as a bad or timed out gateway.
+func QuickBooksErrorStatus(err error) int {
+	var qbErr *QuickBooksError
+	switch {
+	case errors.As(err, &qbErr):
+		switch qbErr.Code() {
+		case ERROR_CODE_DUPLICATE_DOC_NUMBER, ERROR_CODE_STALE_OBJECT:
+			return http.StatusConflict
+		case ERROR_CODE_INVALID_REFERENCE:
+			return http.StatusUnprocessableEntity
+		}
+		switch qbErr.StatusCode {
+		case http.StatusBadRequest:
+			return http.StatusUnprocessableEntity
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests:
+			return qbErr.StatusCode
+		}
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// WriteQuickBooksError responds to a failed QuickBooks request. Fault entries are returned field by field
+// together with the error code so the frontend can show each message next to the offending field, other
+// failures are returned as a plain error message.
+func WriteQuickBooksError(response http.ResponseWriter, err error, message string) {
+	statusCode := QuickBooksErrorStatus(err)
+
+	var qbErr *QuickBooksError
+	if !errors.As(err, &qbErr) || len(qbErr.Errors) == 0 {
+		firebase_shared.WriteJSONError(response, statusCode, message+": "+err.Error())
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(statusCode)
+	json.NewEncoder(response).Encode(map[string]any{
+		"error":  message,
+		"code":   qbErr.Code(),
+		"fields": qbErr.FieldErrors(),
+	})
+}
+
+// ResolveQuickBooksConnection returns the realm ID and connection to use for the admin. When requestedRealmID
+// is empty, the admin's default company is used. ErrQuickBooksNotConnected is returned if the admin has not
+// connected any company or the requested one.
+func ResolveQuickBooksConnection(ctx context.Context, uid string, requestedRealmID string) (string, *QuickBooksConnection, error) {
+	docSnapshot, err := firebase_shared.FirestoreClient.Collection(QuickBooks.ConnectionsCollection).Doc(uid).Get(ctx)
+	if docSnapshot != nil && !docSnapshot.Exists() {
+		return "", nil, ErrQuickBooksNotConnected
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var connections QuickBooksConnections
+	if err := docSnapshot.DataTo(&connections); err != nil {
+		return "", nil, err
+	}
+
+	realmID := requestedRealmID
+	if realmID == "" {
+		realmID = connections.DefaultRealmID
+	}
+
+	connection, ok := connections.Realms[realmID]
+	if realmID == "" || !ok || connection.TokenKey == "" {
+		return "", nil, ErrQuickBooksNotConnected
+	}
+	return realmID, &connection, nil
+}
+
+// OpenQuickBooksSession resolves the admin's QuickBooks company and returns a valid access token for it.
+func OpenQuickBooksSession(ctx context.Context, uid string, requestedRealmID string) (*QuickBooksSession, error) {
+	realmID, connection, err := ResolveQuickBooksConnection(ctx, uid, requestedRealmID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewQuickBooksSession(ctx, realmID, connection.TokenKey)
+}
+
+// OpenRealmSession returns a session on the QuickBooks company using the token of any admin who connected
+// it. It is used where no admin is calling, such as customer requests and Intuit webhooks.
+func OpenRealmSession(ctx context.Context, realmID string) (*QuickBooksSession, error) {
+	tokenSnapshots, err := firebase_shared.FirestoreClient.Collection(QuickBooks.TokensCollection).Where("realm_id", "==", realmID).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(tokenSnapshots) == 0 {
+		return nil, ErrQuickBooksNotConnected
+	}
+
+	return NewQuickBooksSession(ctx, realmID, tokenSnapshots[0].Ref.ID)
+}
+
+// NewQuickBooksSession returns a session on the company using a valid access token of the token document.
+func NewQuickBooksSession(ctx context.Context, realmID string, tokenKey string) (*QuickBooksSession, error) {
+	accessToken, err := ValidAccessToken(ctx, tokenKey, "")
+	if err != nil {
+		return nil, err
+	}
+	return &QuickBooksSession{RealmID: realmID, AccessToken: accessToken, tokenKey: tokenKey}, nil
+}
+
+// NewStoredTokenSession returns a session on the company using accessToken as stored in the token document,
+// without refreshing it first. The token is only refreshed if QuickBooks rejects it, so checking whether a
+// connection still works does not rotate a token that is still valid.
+func NewStoredTokenSession(realmID string, tokenKey string, accessToken string) *QuickBooksSession {
+	return &QuickBooksSession{RealmID: realmID, AccessToken: accessToken, tokenKey: tokenKey}
+}
+
+// refreshAccessToken replaces the access token after QuickBooks rejected it before its stored expiry, for
+// example because Intuit revoked it.
+func (session *QuickBooksSession) refreshAccessToken(ctx context.Context) error {
+	accessToken, err := ValidAccessToken(ctx, session.tokenKey, session.AccessToken)
+	if err != nil {
+		return err
+	}
+	session.AccessToken = accessToken
+	return nil
+}
+
+// ValidAccessToken returns the stored access token of the token document, refreshing it at Intuit when it
+// is about to expire or is the rejectedToken QuickBooks refused. A token another request refreshed in the
+// meantime is used as is.
+func ValidAccessToken(ctx context.Context, tokenKey string, rejectedToken string) (string, error) {
+	tokenRef := firebase_shared.FirestoreClient.Collection(QuickBooks.TokensCollection).Doc(tokenKey)
+	tokenSnapshot, err := tokenRef.Get(ctx)
+	if tokenSnapshot != nil && !tokenSnapshot.Exists() {
+		return "", ErrQuickBooksNotConnected
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tokenData := tokenSnapshot.Data()
+	accessToken, _ := tokenData["access_token"].(string)
+	expiresAt, _ := tokenData["expires_at"].(time.Time)
+	if accessToken != "" && accessToken != rejectedToken && time.Now().Add(accessTokenRefreshMargin).Before(expiresAt) {
+		return accessToken, nil
+	}
+
+	refreshToken, _ := tokenData["refresh_token"].(string)
+	if refreshToken == "" {
+		return "", errors.New("stored QuickBooks token has no refresh token")
+	}
+	tokenResponse, err := RequestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Intuit rotates the refresh token, the new one must be stored for the next refresh
+	now := time.Now()
+	_, err = tokenRef.Set(ctx, map[string]any{
+		"access_token":             tokenResponse.AccessToken,
+		"refresh_token":            tokenResponse.RefreshToken,
+		"expires_at":               now.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+		"refresh_token_expires_at": now.Add(time.Duration(tokenResponse.RefreshTokenExpiresIn) * time.Second),
+		"updated_at":               now,
+	}, firestore.MergeAll)
+	if err != nil {
+		return "", err
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+// TokenResponse represents the JSON returned by Intuit's token endpoint.
+type TokenResponse struct {
+	AccessToken           string `json:"access_token"`
+	RefreshToken          string `json:"refresh_token"`
+	TokenType             string `json:"token_type"`
+	ExpiresIn             int64  `json:"expires_in"`                 // Access token lifetime in seconds
+	RefreshTokenExpiresIn int64  `json:"x_refresh_token_expires_in"` // Refresh token lifetime in seconds
+}
+
+// RequestToken posts the form to Intuit's token endpoint with the environment's app credentials.
+func RequestToken(ctx context.Context, form url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, QUICKBOOKS_TOKEN_URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(QuickBooks.ClientID, QuickBooks.ClientSecret)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "invalid_grant") {
+		return nil, fmt.Errorf("%w: %s", ErrQuickBooksTokenRevoked, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResponse TokenResponse
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.AccessToken == "" || tokenResponse.RefreshToken == "" {
+		return nil, errors.New("token endpoint returned an empty token")
+	}
+	return &tokenResponse, nil
+}
+
+// Do sends a request to the QuickBooks v3 API of the session's company. path is relative to
+// /v3/company/{realmId}, body is encoded as JSON when not nil and the JSON response is decoded into out.
+func (session *QuickBooksSession) Do(ctx context.Context, method string, path string, body any, out any) error {
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	resp, err := session.send(ctx, method, path, body, contentType, "application/json")
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, out)
+}
+
+// PostEmpty sends a POST without a body to the QuickBooks v3 API of the session's company with the given
+// Content-Type and decodes the JSON response into out. QuickBooks only accepts some of these requests,
+// such as invoice/{id}/send, as application/octet-stream.
+func (session *QuickBooksSession) PostEmpty(ctx context.Context, path string, contentType string, out any) error {
+	resp, err := session.send(ctx, http.MethodPost, path, nil, contentType, "application/json")
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse decodes the JSON body of resp into out, when out is not nil, and closes it.
+func decodeResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// Download requests a non-JSON resource of the session's company, such as an invoice PDF. The caller
+// must close the returned body.
+func (session *QuickBooksSession) Download(ctx context.Context, path string, accept string) (io.ReadCloser, error) {
+	resp, err := session.send(ctx, http.MethodGet, path, nil, "", accept)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// send performs the request, with the Content-Type contentType when not empty, and returns the response if
+// QuickBooks accepted it. A rejected access token is refreshed once and throttled or unavailable requests
+// are retried with backoff as allowed by isRetryable, otherwise the rejection is returned as a *QuickBooksError.
+func (session *QuickBooksSession) send(ctx context.Context, method string, path string, body any, contentType string, accept string) (*http.Response, error) {
+	apiURL := fmt.Sprintf("%s/v3/company/%s/%s", QuickBooks.APIURL, session.RealmID, strings.TrimPrefix(path, "/"))
+
+	var encoded []byte
+	if body != nil {
+		var err error
+		encoded, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, apiURL, bytes.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.AccessToken))
+		req.Header.Set("Accept", accept)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+			return resp, nil
+		}
+
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		qbErr := ParseQuickBooksError(resp.StatusCode, respBody)
+
+		// Access tokens can be revoked before they expire, refresh once and try again
+		if resp.StatusCode == http.StatusUnauthorized && !refreshed && session.tokenKey != "" {
+			refreshed = true
+			if err := session.refreshAccessToken(ctx); err != nil {
+				return nil, fmt.Errorf("%w (refreshing the access token failed: %w)", qbErr, err)
+			}
+			attempt--
+			continue
+		}
+
+		if !isRetryable(method, apiURL, resp.StatusCode) || attempt >= quickBooksMaxAttempts {
+			return nil, qbErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryDelay(resp.Header.Get("Retry-After"), attempt)):
+		}
+	}
+}
+
+// isRetryable reports whether the request may be sent again: QuickBooks throttled it, or was temporarily
+// unavailable. A write that failed with a 5xx may still have been saved, so it is only repeated when its
+// requestid lets QuickBooks recognize the retry instead of creating a duplicate.
+func isRetryable(method string, apiURL string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return method == http.MethodGet || hasRequestID(apiURL)
+	}
+	return false
+}
+
+// hasRequestID reports whether the request URL carries a requestid query parameter.
+func hasRequestID(apiURL string) bool {
+	parsed, err := url.Parse(apiURL)
+	return err == nil && parsed.Query().Get("requestid") != ""
+}
+
+// retryDelay returns how long to wait before the next attempt, honoring the Retry-After header
+// QuickBooks sends when throttling.
+func retryDelay(retryAfter string, attempt int) time.Duration {
+	delay := quickBooksRetryDelay << (attempt - 1)
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	return min(delay, quickBooksMaxRetryDelay)
+}
+
+// Query runs a QuickBooks query statement and decodes the QueryResponse into out.
+func (session *QuickBooksSession) Query(ctx context.Context, statement string, out any) error {
+	return session.Do(ctx, http.MethodGet, "query?query="+url.QueryEscape(statement), nil, out)
+}
+
+// EscapeQueryValue escapes a value for use inside a single-quoted QuickBooks query literal.
+func EscapeQueryValue(value string) string {
+	return strings.ReplaceAll(value, "'", `\'`)
+}
@@ -0,0 +1,269 @@
+package quickbooks_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+func TestParseQuickBooksError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		faultType  string
+		codes      []string
+		message    string
+	}{
+		{
+			name:       "Validation Fault",
+			statusCode: http.StatusBadRequest,
+			body:       `{"Fault":{"Error":[{"Message":"Duplicate Document Number Error","Detail":"Duplicate Document Number Error : You must specify a different number.","code":"6140","element":""}],"type":"ValidationFault"},"time":"2025-06-30T10:00:00.000-07:00"}`,
+			faultType:  "ValidationFault",
+			codes:      []string{"6140"},
+			message:    "QuickBooks API Error (400): Duplicate Document Number Error: Duplicate Document Number Error : You must specify a different number.",
+		},
+		{
+			name:       "Fault Inside IntuitResponse",
+			statusCode: http.StatusUnauthorized,
+			body:       `{"IntuitResponse":{"Fault":{"Error":[{"Message":"message=AuthenticationFailed","code":"3200"}],"type":"AuthenticationFault"}}}`,
+			faultType:  "AuthenticationFault",
+			codes:      []string{"3200"},
+			message:    "QuickBooks API Error (401): message=AuthenticationFailed",
+		},
+		{
+			name:       "Non JSON Body",
+			statusCode: http.StatusServiceUnavailable,
+			body:       "Service Unavailable\n",
+			message:    "QuickBooks API Error (503): Service Unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		qbErr := quickbooks.ParseQuickBooksError(tt.statusCode, []byte(tt.body))
+		if qbErr.StatusCode != tt.statusCode {
+			t.Errorf("[%s] Expected status %d, got %d", tt.name, tt.statusCode, qbErr.StatusCode)
+		}
+		if qbErr.FaultType != tt.faultType {
+			t.Errorf("[%s] Expected fault type %q, got %q", tt.name, tt.faultType, qbErr.FaultType)
+		}
+		if len(qbErr.Errors) != len(tt.codes) {
+			t.Errorf("[%s] Expected %d fault errors, got %d", tt.name, len(tt.codes), len(qbErr.Errors))
+			continue
+		}
+		for i, code := range tt.codes {
+			if qbErr.Errors[i].Code != code {
+				t.Errorf("[%s] Expected code %s, got %s", tt.name, code, qbErr.Errors[i].Code)
+			}
+		}
+		if qbErr.Error() != tt.message {
+			t.Errorf("[%s] Expected message %q, got %q", tt.name, tt.message, qbErr.Error())
+		}
+	}
+}
+
+func TestQuickBooksErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "Validation Fault", err: &quickbooks.QuickBooksError{StatusCode: http.StatusBadRequest}, want: http.StatusUnprocessableEntity},
+		{name: "Duplicate Doc Number", err: faultError(quickbooks.QUICKBOOKS_FAULT_DUPLICATE_DOC_NUMBER), want: http.StatusConflict},
+		{name: "Stale Object", err: faultError(quickbooks.QUICKBOOKS_FAULT_STALE_OBJECT), want: http.StatusConflict},
+		{name: "Invalid Reference", err: faultError(quickbooks.QUICKBOOKS_FAULT_INVALID_REFERENCE), want: http.StatusUnprocessableEntity},
+		{name: "Token Rejected After Refresh", err: &quickbooks.QuickBooksError{StatusCode: http.StatusUnauthorized}, want: http.StatusUnauthorized},
+		{name: "Still Throttled", err: &quickbooks.QuickBooksError{StatusCode: http.StatusTooManyRequests}, want: http.StatusTooManyRequests},
+		{name: "QuickBooks Outage", err: &quickbooks.QuickBooksError{StatusCode: http.StatusInternalServerError}, want: http.StatusBadGateway},
+		{name: "Wrapped Error", err: fmt.Errorf("fetching invoice: %w", &quickbooks.QuickBooksError{StatusCode: http.StatusNotFound}), want: http.StatusNotFound},
+		{name: "Timeout", err: context.DeadlineExceeded, want: http.StatusGatewayTimeout},
+		{name: "Network Error", err: errors.New("connection reset by peer"), want: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		if got := quickbooks.QuickBooksErrorStatus(tt.err); got != tt.want {
+			t.Errorf("[%s] Expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestQuickBooksErrorFieldErrors(t *testing.T) {
+	qbErr := &quickbooks.QuickBooksError{
+		StatusCode: http.StatusBadRequest,
+		FaultType:  "ValidationFault",
+		Errors: []quickbooks.QuickBooksFaultError{
+			{Message: "Invalid Reference Id", Detail: "Invalid Reference Id : Item assigned to this transaction has been deleted", Code: "2500", Element: "Line.SalesItemLineDetail.ItemRef"},
+			{Message: "Duplicate Document Number Error", Code: "6140", Element: "DocNumber"},
+			{Message: "Business Validation Error", Code: "6000"},
+		},
+	}
+
+	if code := qbErr.Code(); code != quickbooks.ERROR_CODE_INVALID_REFERENCE {
+		t.Errorf("Expected code %s, got %s", quickbooks.ERROR_CODE_INVALID_REFERENCE, code)
+	}
+
+	want := []quickbooks.QuickBooksFieldError{
+		{Field: "lines.item_ref", Code: "2500", Message: "Invalid Reference Id", Detail: "Invalid Reference Id : Item assigned to this transaction has been deleted"},
+		{Field: "doc_number", Code: "6140", Message: "Duplicate Document Number Error"},
+		{Code: "6000", Message: "Business Validation Error"},
+	}
+	got := qbErr.FieldErrors()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d field errors, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], got[i])
+		}
+	}
+
+	unknown := faultError("6000")
+	if code := unknown.Code(); code != quickbooks.ERROR_CODE_QUICKBOOKS_REJECTED {
+		t.Errorf("Expected code %s, got %s", quickbooks.ERROR_CODE_QUICKBOOKS_REJECTED, code)
+	}
+}
+
+// faultError returns a ValidationFault with a single error of the given code.
+func faultError(code string) *quickbooks.QuickBooksError {
+	return &quickbooks.QuickBooksError{
+		StatusCode: http.StatusBadRequest,
+		FaultType:  "ValidationFault",
+		Errors:     []quickbooks.QuickBooksFaultError{{Message: "QuickBooks error", Code: code}},
+	}
+}
+
+func TestNewQuickBooksConfig(t *testing.T) {
+	production, err := quickbooks.NewQuickBooksConfig("")
+	if err != nil {
+		t.Fatalf("Expected the default environment to be valid, got %v", err)
+	}
+	if production.Environment != quickbooks.QUICKBOOKS_ENVIRONMENT_PRODUCTION {
+		t.Errorf("Expected the default environment to be %s, got %s", quickbooks.QUICKBOOKS_ENVIRONMENT_PRODUCTION, production.Environment)
+	}
+
+	sandbox, err := quickbooks.NewQuickBooksConfig(quickbooks.QUICKBOOKS_ENVIRONMENT_SANDBOX)
+	if err != nil {
+		t.Fatalf("Expected the sandbox environment to be valid, got %v", err)
+	}
+	if sandbox.APIURL == production.APIURL {
+		t.Errorf("Expected the sandbox to use its own API URL, got %s", sandbox.APIURL)
+	}
+	if sandbox.TokensCollection == production.TokensCollection || sandbox.ConnectionsCollection == production.ConnectionsCollection || sandbox.CustomerIDsField == production.CustomerIDsField {
+		t.Errorf("Expected the sandbox to store its tokens, connections and customer IDs apart from production")
+	}
+	if name := sandbox.SecretName("CLIENT_ID"); name != "QUICKBOOKS_SANDBOX_CLIENT_ID" {
+		t.Errorf("Expected sandbox secret QUICKBOOKS_SANDBOX_CLIENT_ID, got %s", name)
+	}
+	if name := production.SecretName("CLIENT_ID"); name != "QUICKBOOKS_CLIENT_ID" {
+		t.Errorf("Expected production secret QUICKBOOKS_CLIENT_ID, got %s", name)
+	}
+
+	if _, err := quickbooks.NewQuickBooksConfig("staging"); err == nil {
+		t.Errorf("Expected an unknown environment to be rejected")
+	}
+}
+
+func TestSessionRetriesOnlyIdempotentWrites(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		attempts int32
+	}{
+		{name: "Read After Bad Gateway", method: http.MethodGet, path: "invoice/130", status: http.StatusBadGateway, attempts: 2},
+		{name: "Write With Request ID After Bad Gateway", method: http.MethodPost, path: "payment?requestid=abc", status: http.StatusBadGateway, attempts: 2},
+		{name: "Write Without Request ID After Gateway Timeout", method: http.MethodPost, path: "payment", status: http.StatusGatewayTimeout, attempts: 1},
+		{name: "Write Without Request ID When Throttled", method: http.MethodPost, path: "payment", status: http.StatusTooManyRequests, attempts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				// Fail the first attempt only
+				if attempts.Add(1) == 1 {
+					response.Header().Set("Retry-After", "1")
+					response.WriteHeader(tt.status)
+					return
+				}
+				response.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			previous := quickbooks.QuickBooks
+			quickbooks.QuickBooks = &quickbooks.QuickBooksConfig{APIURL: server.URL}
+			defer func() { quickbooks.QuickBooks = previous }()
+
+			session := &quickbooks.QuickBooksSession{RealmID: "123", AccessToken: "access-token"}
+			err := session.Do(context.Background(), tt.method, tt.path, map[string]any{}, nil)
+
+			if got := attempts.Load(); got != tt.attempts {
+				t.Errorf("[%s] Expected %d attempts, got %d", tt.name, tt.attempts, got)
+			}
+			var qbErr *quickbooks.QuickBooksError
+			if tt.attempts == 1 && (!errors.As(err, &qbErr) || qbErr.StatusCode != tt.status) {
+				t.Errorf("[%s] Expected the %d rejection to be returned, got %v", tt.name, tt.status, err)
+			}
+			if tt.attempts > 1 && err != nil {
+				t.Errorf("[%s] Expected the retry to succeed, got %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestStoredTokenSessionSendsStoredToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		authorization = request.Header.Get("Authorization")
+		response.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	previous := quickbooks.QuickBooks
+	quickbooks.QuickBooks = &quickbooks.QuickBooksConfig{APIURL: server.URL}
+	defer func() { quickbooks.QuickBooks = previous }()
+
+	session := quickbooks.NewStoredTokenSession("123", "uid_123", "stored-token")
+	if err := session.Do(context.Background(), http.MethodGet, "companyinfo/123", nil, nil); err != nil {
+		t.Fatalf("Expected the request to succeed, got %v", err)
+	}
+	if authorization != "Bearer stored-token" {
+		t.Errorf("Expected the stored token to be sent, got %q", authorization)
+	}
+}
+
+func TestPostEmptySendsContentType(t *testing.T) {
+	var method, contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		method = request.Method
+		contentType = request.Header.Get("Content-Type")
+		body, _ = io.ReadAll(request.Body)
+		response.Write([]byte(`{"Invoice":{"Id":"130"}}`))
+	}))
+	defer server.Close()
+
+	previous := quickbooks.QuickBooks
+	quickbooks.QuickBooks = &quickbooks.QuickBooksConfig{APIURL: server.URL}
+	defer func() { quickbooks.QuickBooks = previous }()
+
+	session := &quickbooks.QuickBooksSession{RealmID: "123", AccessToken: "access-token"}
+	var out map[string]any
+	if err := session.PostEmpty(context.Background(), "invoice/130/send", "application/octet-stream", &out); err != nil {
+		t.Fatalf("Expected the request to succeed, got %v", err)
+	}
+	if method != http.MethodPost || contentType != "application/octet-stream" || len(body) != 0 {
+		t.Errorf("Expected an empty POST as application/octet-stream, got %s %q with %d bytes", method, contentType, len(body))
+	}
+	if out["Invoice"] == nil {
+		t.Errorf("Expected the response to be decoded, got %v", out)
+	}
+}
@@ -0,0 +1,60 @@
+package quickbooks
+
+import "strings"
+
+// The portal keeps QuickBooks IDs per company, since the same portal user or catalog item has another ID in
+// every company it was synced to, sandbox companies included. Realm IDs are unique across both environments.
+
+// CustomerIDs returns the QuickBooks customer IDs stored on a users document, keyed by realm ID, for the
+// selected environment. Users synced before the IDs were kept per company only have the
+// quickbooks_customer_id and quickbooks_realm_id fields, which are returned as well.
+func CustomerIDs(user map[string]any) map[string]string {
+	customerIDs := map[string]string{}
+	if realmID, _ := user["quickbooks_realm_id"].(string); realmID != "" {
+		if customerID, _ := user["quickbooks_customer_id"].(string); customerID != "" {
+			customerIDs[realmID] = customerID
+		}
+	}
+
+	stored, _ := user[QuickBooks.CustomerIDsField].(map[string]any)
+	for realmID, value := range stored {
+		if customerID, _ := value.(string); customerID != "" {
+			customerIDs[realmID] = customerID
+		}
+	}
+	return customerIDs
+}
+
+// ProductDocumentID returns the ID of the products document of a QuickBooks item of the company realmID,
+// named {realmId}_{itemId}. productID is either that document ID or, for orders and quotes placed before
+// products were kept per company, the bare item ID.
+func ProductDocumentID(realmID string, productID string) string {
+	if strings.HasPrefix(productID, realmID+"_") {
+		return productID
+	}
+	return realmID + "_" + productID
+}
+
+// ItemID returns the QuickBooks item ID of a product of the company realmID, from its products document ID
+// or, for orders placed before products were kept per company, the bare item ID. false is returned for a
+// product of another company.
+func ItemID(realmID string, productID string) (string, bool) {
+	if itemID, found := strings.CutPrefix(productID, realmID+"_"); found {
+		return itemID, itemID != ""
+	}
+	return productID, productID != "" && !strings.Contains(productID, "_")
+}
+
+// IsEntityID reports whether id has the form of a QuickBooks entity ID, a positive number. IDs taken from
+// requests are checked before they are put into an API path.
+func IsEntityID(id string) bool {
+	if id == "" || len(id) > 20 {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return strings.TrimLeft(id, "0") != ""
+}
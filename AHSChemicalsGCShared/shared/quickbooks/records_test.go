@@ -0,0 +1,104 @@
+package quickbooks_test
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+func TestCustomerIDs(t *testing.T) {
+	previous := quickbooks.QuickBooks
+	quickbooks.QuickBooks, _ = quickbooks.NewQuickBooksConfig(quickbooks.QUICKBOOKS_ENVIRONMENT_SANDBOX)
+	defer func() { quickbooks.QuickBooks = previous }()
+
+	tests := []struct {
+		name string
+		user map[string]any
+		want map[string]string
+	}{
+		{
+			name: "Not Synced",
+			user: map[string]any{"brands": []any{"Pool"}},
+			want: map[string]string{},
+		},
+		{
+			name: "Synced Per Company",
+			user: map[string]any{"quickbooks_sandbox_customer_ids": map[string]any{"9341": "58", "9342": "7"}},
+			want: map[string]string{"9341": "58", "9342": "7"},
+		},
+		{
+			name: "Other Environment Ignored",
+			user: map[string]any{"quickbooks_customer_ids": map[string]any{"1234": "12"}},
+			want: map[string]string{},
+		},
+		{
+			name: "Synced Before Per Company IDs",
+			user: map[string]any{"quickbooks_customer_id": "12", "quickbooks_realm_id": "1234", "quickbooks_sandbox_customer_ids": map[string]any{"9341": "58"}},
+			want: map[string]string{"1234": "12", "9341": "58"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := quickbooks.CustomerIDs(tt.user); !maps.Equal(got, tt.want) {
+			t.Errorf("[%s] Expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestProductDocumentID(t *testing.T) {
+	if id := quickbooks.ProductDocumentID("1234", "1234_56"); id != "1234_56" {
+		t.Errorf("Expected a product document ID to be kept, got %s", id)
+	}
+	if id := quickbooks.ProductDocumentID("1234", "56"); id != "1234_56" {
+		t.Errorf("Expected an item ID to be prefixed with the realm, got %s", id)
+	}
+	if id := quickbooks.ProductDocumentID("1234", "9341_56"); id != "1234_9341_56" {
+		t.Errorf("Expected a product of another company not to resolve to this company, got %s", id)
+	}
+}
+
+func TestItemID(t *testing.T) {
+	tests := []struct {
+		productID string
+		itemID    string
+		found     bool
+	}{
+		{productID: "1234_56", itemID: "56", found: true},
+		{productID: "56", itemID: "56", found: true},
+		{productID: "9341_56", found: false},
+		{productID: "1234_", found: false},
+		{productID: "", found: false},
+	}
+
+	for _, tt := range tests {
+		itemID, found := quickbooks.ItemID("1234", tt.productID)
+		if found != tt.found || (found && itemID != tt.itemID) {
+			t.Errorf("[%s] Expected %q and %v, got %q and %v", tt.productID, tt.itemID, tt.found, itemID, found)
+		}
+	}
+}
+
+func TestIsEntityID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "130", want: true},
+		{id: "1", want: true},
+		{id: "", want: false},
+		{id: "0", want: false},
+		{id: "-5", want: false},
+		{id: "130/pdf", want: false},
+		{id: "../company", want: false},
+		{id: "130?minorversion=1", want: false},
+		{id: "１３０", want: false},
+		{id: "123456789012345678901", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := quickbooks.IsEntityID(tt.id); got != tt.want {
+			t.Errorf("IsEntityID(%q): Expected %v, got %v", tt.id, tt.want, got)
+		}
+	}
+}
@@ -27,6 +27,7 @@ func main(){
 		shared.InitFirebaseDebug(adminSDKFilePath)
 		
 		http.Handle("/create-account", http.HandlerFunc(function.CreateAccount))
+		http.Handle("/reconcile-accounts", http.HandlerFunc(function.ReconcileAccounts))
 			
 		log.Print("create-account started at: 3002")
 		err = http.ListenAndServe(":3002", nil)
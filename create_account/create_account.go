@@ -1,6 +1,7 @@
 package function
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -9,16 +10,19 @@ import (
 	"firebase.google.com/go/v4/auth"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 )
 
 // CreateAccountRequest represents the expected JSON structure in the request body
 type CreateAccountRequest struct {
-	Name        string              `json:"name"`         // Full name of the user (required)
-	PhoneNumber string              `json:"phone_number"` // User's phone number (required)
-	Email       string              `json:"email"`        // User's email (required)
-	Password    string              `json:"password"`     // User's password (required)
-	Properties  []map[string]string `json:"properties"`   // List of address properties (required)
-	Brands      []string            `json:"brands"`       // List of brands associated with the user (required)
+	Name           string              `json:"name"`            // Full name of the user (required)
+	PhoneNumber    string              `json:"phone_number"`    // User's phone number (required)
+	Email          string              `json:"email"`           // User's email (required)
+	Password       string              `json:"password"`        // User's password (required)
+	Properties     []map[string]string `json:"properties"`      // List of address properties (required)
+	Brands         []string            `json:"brands"`          // List of brands associated with the user (required)
+	SyncQuickBooks bool                `json:"sync_quickbooks"` // Create or link the matching QuickBooks customer (optional)
+	AssignedRep    string              `json:"assigned_rep"`    // UID of the sales rep managing the account (optional, sales reps are always assigned their own accounts)
 }
 
 func init() {
@@ -26,15 +30,18 @@ func init() {
 	if os.Getenv("ENV") != "DEBUG" {
 		shared.InitFirebaseProd(nil)
 		functions.HTTP("create-account", CreateAccount)
+		functions.HTTP("reconcile-accounts", ReconcileAccounts)
 	}
 }
 
 // CreateAccount handles the creation of a new user in Firebase Authentication
 // and stores additional user data (properties, brands) in Firestore.
 //
-// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Authorization: Requires a valid Bearer token of a role with the create_account permission. Accounts
+// created by a sales rep are assigned to them.
 // Method: POST
-// Request Body: JSON matching the CreateAccountRequest struct
+// Request Body: JSON matching the CreateAccountRequest struct. With sync_quickbooks set, the account is
+// also linked to a QuickBooks customer through the quickbooks-sync-customers function.
 // Success Response: 200 OK with success message
 // Error Response: Appropriate HTTP status codes with descriptive error messages
 func CreateAccount(response http.ResponseWriter, request *http.Request) {
@@ -51,9 +58,10 @@ func CreateAccount(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Ensure that the user is authorized (admin privileges)
-	if err := shared.IsAuthorizedAndAdmin(request); err != nil {
-		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+	// Ensure that the caller's role allows creating accounts
+	token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_CREATE_ACCOUNT)
+	if err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
 		return
 	}
 
@@ -102,6 +110,21 @@ func CreateAccount(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	// Sales reps always manage the accounts they create, others may assign the account to a rep
+	assignedRep := createAccountRequest.AssignedRep
+	if accounts.IsScopedToAssignedAccounts(accounts.RoleFromClaims(token.Claims)) {
+		if assignedRep != "" && assignedRep != token.UID {
+			shared.WriteJSONError(response, http.StatusForbidden, "Sales reps can only create accounts assigned to themselves")
+			return
+		}
+		assignedRep = token.UID
+	} else if assignedRep != "" {
+		if err := accounts.CheckSalesRep(ctx, shared.AuthClient, assignedRep); err != nil {
+			shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	// Create the user in Firebase Authentication
 	userToCreate := (&auth.UserToCreate{}).
 		Email(createAccountRequest.Email).
@@ -123,19 +146,39 @@ func CreateAccount(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Prepare the Firestore document with the user's properties and brands
-	data := map[string]any{
-		"properties": createAccountRequest.Properties,
-		"brands":     createAccountRequest.Brands,
+	// Prepare the Firestore document with the user's properties and brands, and the fields fetch-accounts
+	// searches on
+	data := accounts.SearchFields(createdUser, createAccountRequest.Brands, createAccountRequest.Properties)
+	data["properties"] = createAccountRequest.Properties
+	data["brands"] = createAccountRequest.Brands
+	if assignedRep != "" {
+		data[accounts.ASSIGNED_REP_FIELD] = assignedRep
 	}
 
-	// Store the additional user data in Firestore
+	// Store the additional user data in Firestore. Without it the Auth user could log in with no brands
+	// or properties, so it is deleted again when the write fails.
 	if _, err := shared.FirestoreClient.Collection("users").Doc(createdUser.UID).Set(ctx, data); err != nil {
-		log.Printf("Firestore write error: %v", err)
-		shared.WriteJSONError(response, http.StatusInternalServerError, err.Error())
+		log.Printf("Firestore write error for uid %s: %v", createdUser.UID, err)
+
+		// The request context may be what failed the write, the rollback must still run
+		if rollbackErr := shared.AuthClient.DeleteUser(context.WithoutCancel(ctx), createdUser.UID); rollbackErr != nil {
+			log.Printf("Error rolling back auth user %s, reconcile-accounts will report it: %v", createdUser.UID, rollbackErr)
+			shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while saving the account, and the login could not be removed: "+err.Error())
+			return
+		}
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while saving the account, it was not created: "+err.Error())
 		return
 	}
 
+	// Link the new account to a QuickBooks customer if requested
+	if createAccountRequest.SyncQuickBooks {
+		if err := accounts.TriggerQuickBooksSync(ctx, request.Header.Get("Authorization"), createdUser.UID); err != nil {
+			log.Printf("QuickBooks sync error for uid %s: %v", createdUser.UID, err)
+			shared.WriteJSONSuccess(response, http.StatusOK, "Account Created Successfully, but QuickBooks sync failed", nil)
+			return
+		}
+	}
+
 	// Respond with success
 	shared.WriteJSONSuccess(response, http.StatusOK, "Account Created Successfully", nil)
-}
\ No newline at end of file
+}
@@ -3,10 +3,14 @@ module github.com/HarshMohanSason/AHSChemicalsGCFunctions
 go 1.24.2
 
 require (
+	cloud.google.com/go/firestore v1.18.0
 	firebase.google.com/go/v4 v4.15.2
 	github.com/GoogleCloudPlatform/functions-framework-go v1.9.2
 	github.com/HarshMohanSason/AHSChemicalsGCShared v1.9.5
+	github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts v1.0.0
 	github.com/joho/godotenv v1.5.1
+	google.golang.org/api v0.237.0
+	google.golang.org/grpc v1.73.0
 )
 
 require (
@@ -15,7 +19,6 @@ require (
 	cloud.google.com/go/auth v0.16.2 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.8 // indirect
 	cloud.google.com/go/compute/metadata v0.7.0 // indirect
-	cloud.google.com/go/firestore v1.18.0 // indirect
 	cloud.google.com/go/iam v1.5.2 // indirect
 	cloud.google.com/go/longrunning v0.6.7 // indirect
 	cloud.google.com/go/monitoring v1.24.2 // indirect
@@ -65,11 +68,11 @@ require (
 	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.26.0 // indirect
 	golang.org/x/time v0.12.0 // indirect
-	google.golang.org/api v0.237.0 // indirect
 	google.golang.org/appengine/v2 v2.0.6 // indirect
 	google.golang.org/genproto v0.0.0-20250505200425-f936aa4a68b2 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250603155806-513f23925822 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250603155806-513f23925822 // indirect
-	google.golang.org/grpc v1.73.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 )
+
+replace github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts => ../AHSChemicalsGCShared/shared/accounts
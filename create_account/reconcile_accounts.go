@@ -0,0 +1,188 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Customers created more recently than this are not reported, CreateAccount may still be writing their document
+	reconcileGracePeriod = 15 * time.Minute
+
+	// Maximum number of users the Auth API returns in one GetUsers call
+	getUsersBatchSize = 100
+)
+
+// ReconcileAccounts finds customers whose Firebase Auth user has no users document, such as those left
+// behind when CreateAccount could not roll back, and users documents whose Auth user no longer exists.
+// A GET request only reports them, while a POST request also repairs them. Customers without a document
+// get an empty one rather than losing their login, since they may be staff who were demoted to customer or
+// accounts still worth completing; they then show as incomplete in fetch-accounts. Documents without an
+// Auth user are deleted.
+//
+// Authorization: Requires a valid Bearer token of a role with the reconcile_accounts permission.
+// Method: GET to report, POST to report and repair
+// Success Response: 200 OK with a ReconciliationReport
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func ReconcileAccounts(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS (OPTIONS) requests and setup CORS headers
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	if request.Method != http.MethodGet && request.Method != http.MethodPost {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method")
+		return
+	}
+
+	// Ensure that the caller's role allows reconciling accounts
+	token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_RECONCILE_ACCOUNTS)
+	if err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+
+	users, err := accounts.ListAuthUsers(ctx, shared.AuthClient)
+	if err != nil {
+		log.Printf("Error listing Firebase users: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while listing the users")
+		return
+	}
+
+	documents, err := accounts.ListUserDocuments(ctx, shared.FirestoreClient)
+	if err != nil {
+		log.Printf("Error listing users documents: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while listing the users documents")
+		return
+	}
+
+	report := ReconciliationReport{}
+	report.AuthWithoutDocument, report.DocumentsWithoutAuth = accounts.FindOrphans(users, documents, time.Now().Add(-reconcileGracePeriod))
+	if request.Method == http.MethodGet {
+		shared.WriteJSONSuccess(response, http.StatusOK, "Accounts reconciled", report)
+		return
+	}
+
+	log.Printf("uid %s is repairing %d Auth users without a document and %d documents without an Auth user",
+		token.UID, len(report.AuthWithoutDocument), len(report.DocumentsWithoutAuth))
+
+	report.Failures = append(createMissingDocuments(ctx, report.AuthWithoutDocument), deleteOrphanedDocuments(ctx, report.DocumentsWithoutAuth)...)
+	report.Repaired = true
+	if len(report.Failures) > 0 {
+		shared.WriteJSONSuccess(response, http.StatusOK, fmt.Sprintf("Accounts repaired, but %d could not be", len(report.Failures)), report)
+		return
+	}
+	shared.WriteJSONSuccess(response, http.StatusOK, "Accounts repaired", report)
+}
+
+// createMissingDocuments writes an empty users document for each Auth user and returns the ones that could
+// not get one. A document written in the meantime, for example by update-account, is left as it is.
+func createMissingDocuments(ctx context.Context, users []accounts.AuthUser) []AccountFailure {
+	var failures []AccountFailure
+
+	bulkWriter := shared.FirestoreClient.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob, len(users))
+	for start := 0; start < len(users); start += getUsersBatchSize {
+		batch := users[start:min(start+getUsersBatchSize, len(users))]
+		identifiers := make([]auth.UserIdentifier, 0, len(batch))
+		for _, user := range batch {
+			identifiers = append(identifiers, auth.UIDIdentifier{UID: user.UID})
+		}
+
+		// Read the users again for the search fields, users deleted since the report are skipped
+		result, err := shared.AuthClient.GetUsers(ctx, identifiers)
+		if err != nil {
+			log.Printf("Error reading %d Auth users without a document: %v", len(identifiers), err)
+			for _, user := range batch {
+				failures = append(failures, AccountFailure{UID: user.UID, Error: "Auth user could not be read"})
+			}
+			continue
+		}
+
+		for _, userRecord := range result.Users {
+			data := accounts.SearchFields(userRecord, []string{}, []map[string]string{})
+			data["brands"] = []string{}
+			data["properties"] = []map[string]string{}
+
+			job, err := bulkWriter.Create(shared.FirestoreClient.Collection(accounts.USERS_COLLECTION).Doc(userRecord.UID), data)
+			if err != nil {
+				failures = append(failures, AccountFailure{UID: userRecord.UID, Error: err.Error()})
+				continue
+			}
+			jobs[userRecord.UID] = job
+		}
+	}
+	bulkWriter.End()
+
+	for uid, job := range jobs {
+		if _, err := job.Results(); err != nil && status.Code(err) != codes.AlreadyExists {
+			log.Printf("Error creating users document %s: %v", uid, err)
+			failures = append(failures, AccountFailure{UID: uid, Error: "users document could not be created"})
+		}
+	}
+	return failures
+}
+
+// deleteOrphanedDocuments deletes the users documents and returns the ones that could not be deleted. The
+// Auth users are looked up again first, and the document of a user created since the report is kept.
+func deleteOrphanedDocuments(ctx context.Context, documentIDs []string) []AccountFailure {
+	var failures []AccountFailure
+
+	bulkWriter := shared.FirestoreClient.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob, len(documentIDs))
+	for start := 0; start < len(documentIDs); start += getUsersBatchSize {
+		batch := documentIDs[start:min(start+getUsersBatchSize, len(documentIDs))]
+		identifiers := make([]auth.UserIdentifier, 0, len(batch))
+		for _, documentID := range batch {
+			identifiers = append(identifiers, auth.UIDIdentifier{UID: documentID})
+		}
+
+		result, err := shared.AuthClient.GetUsers(ctx, identifiers)
+		if err != nil {
+			log.Printf("Error reading %d Auth users of orphaned documents: %v", len(identifiers), err)
+			for _, documentID := range batch {
+				failures = append(failures, AccountFailure{UID: documentID, Error: "Auth user could not be read"})
+			}
+			continue
+		}
+
+		// Only the documents of users Auth still does not know about are deleted
+		found := make(map[string]bool, len(result.Users))
+		for _, userRecord := range result.Users {
+			found[userRecord.UID] = true
+		}
+		for _, documentID := range batch {
+			if found[documentID] {
+				log.Printf("Keeping users document %s, its Auth user was created since the report", documentID)
+				continue
+			}
+			job, err := bulkWriter.Delete(shared.FirestoreClient.Collection(accounts.USERS_COLLECTION).Doc(documentID))
+			if err != nil {
+				failures = append(failures, AccountFailure{UID: documentID, Error: err.Error()})
+				continue
+			}
+			jobs[documentID] = job
+		}
+	}
+	bulkWriter.End()
+
+	for documentID, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("Error deleting orphaned users document %s: %v", documentID, err)
+			failures = append(failures, AccountFailure{UID: documentID, Error: "users document could not be deleted"})
+		}
+	}
+	return failures
+}
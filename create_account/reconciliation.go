@@ -0,0 +1,18 @@
+package function
+
+import "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+
+// AccountFailure is an orphan the reconciliation could not repair.
+type AccountFailure struct {
+	UID   string `json:"uid"`
+	Error string `json:"error"`
+}
+
+// ReconciliationReport lists the customers whose Auth user and users document are out of sync, as found
+// by accounts.FindOrphans.
+type ReconciliationReport struct {
+	AuthWithoutDocument  []accounts.AuthUser `json:"auth_without_document"`  // Customers who can log in but have no brands or properties
+	DocumentsWithoutAuth []string            `json:"documents_without_auth"` // users documents left behind by deleted Auth users
+	Repaired             bool                `json:"repaired"`
+	Failures             []AccountFailure    `json:"failures,omitempty"` // Orphans that could not be repaired
+}
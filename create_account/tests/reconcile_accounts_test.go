@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestReconcileAccounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "Wrong HTTP method",
+			method:     http.MethodDelete,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "Missing Authorization header",
+			method:     http.MethodGet,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid token",
+			method:     http.MethodPost,
+			token:      "Bearer invalid",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/reconcile-accounts", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			res := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(function.ReconcileAccounts)
+			handler.ServeHTTP(res, req)
+
+			if res.Code != tt.wantStatus {
+				t.Errorf("[%s] Expected status %v, got %v", tt.name, tt.wantStatus, res.Code)
+			}
+		})
+	}
+}
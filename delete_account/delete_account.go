@@ -5,8 +5,10 @@ import (
     "net/http"
     "os"
 
+    "firebase.google.com/go/v4/auth"
     "github.com/GoogleCloudPlatform/functions-framework-go/functions"
     "github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+    "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 )
 
 func init() {
@@ -19,7 +21,8 @@ func init() {
 
 // DeleteAccount deletes a user from Firebase Authentication and removes their Firestore record.
 //
-// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Authorization: Requires a valid Bearer token of a role with the delete_account permission. Staff accounts
+// can only be deleted by owners, and sales reps can only delete the customers assigned to them.
 // Method: DELETE
 // URL Parameters:
 //   - uid: The UID of the user to delete (required)
@@ -40,9 +43,10 @@ func DeleteAccount(response http.ResponseWriter, request *http.Request) {
         return
     }
 
-    // Ensure that the user is authorized (admin privileges)
-    if err := shared.IsAuthorizedAndAdmin(request); err != nil {
-        shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+    // Ensure that the caller's role allows deleting accounts
+    token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_DELETE_ACCOUNT)
+    if err != nil {
+        shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
         return
     }
 
@@ -55,6 +59,42 @@ func DeleteAccount(response http.ResponseWriter, request *http.Request) {
         return
     }
 
+    callerRole := accounts.RoleFromClaims(token.Claims)
+
+    // Staff accounts can only be deleted by those who manage roles
+    userRecord, err := shared.AuthClient.GetUser(ctx, uid)
+    if auth.IsUserNotFound(err) {
+        shared.WriteJSONError(response, http.StatusNotFound, "No user found with the given UID")
+        return
+    }
+    if err != nil {
+        log.Printf("Auth lookup error: %v", err)
+        shared.WriteJSONError(response, http.StatusInternalServerError, err.Error())
+        return
+    }
+    if accounts.RoleFromClaims(userRecord.CustomClaims) != accounts.ROLE_CUSTOMER && !accounts.HasPermission(callerRole, accounts.PERMISSION_MANAGE_ROLES) {
+        shared.WriteJSONError(response, http.StatusForbidden, "Only owners can delete staff accounts")
+        return
+    }
+
+    // Sales reps can only delete the customers assigned to them
+    if accounts.IsScopedToAssignedAccounts(callerRole) {
+        docSnapshot, err := shared.FirestoreClient.Collection("users").Doc(uid).Get(ctx)
+        if err != nil && (docSnapshot == nil || docSnapshot.Exists()) {
+            log.Printf("Firestore read error: %v", err)
+            shared.WriteJSONError(response, http.StatusInternalServerError, err.Error())
+            return
+        }
+        assignedRep := ""
+        if docSnapshot.Exists() {
+            assignedRep, _ = docSnapshot.Data()[accounts.ASSIGNED_REP_FIELD].(string)
+        }
+        if !accounts.CanManageAccount(callerRole, token.UID, assignedRep) {
+            shared.WriteJSONError(response, http.StatusNotFound, "No user found with the given UID")
+            return
+        }
+    }
+
     // Delete user from Firebase Authentication
     if err := shared.AuthClient.DeleteUser(ctx, uid); err != nil {
         log.Printf("Auth delete error: %v", err)
@@ -77,4 +117,4 @@ func DeleteAccount(response http.ResponseWriter, request *http.Request) {
 
     // Respond with success
     shared.WriteJSONSuccess(response, http.StatusOK, "Account deleted successfully", nil)
-}
\ No newline at end of file
+}
@@ -3,8 +3,10 @@ module github.com/HarshMohanSason/AHSChemicalsGCFunctions
 go 1.24.2
 
 require (
+	firebase.google.com/go/v4 v4.15.2
 	github.com/GoogleCloudPlatform/functions-framework-go v1.9.2
 	github.com/HarshMohanSason/AHSChemicalsGCShared v1.9.5
+	github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts v1.0.0
 	github.com/joho/godotenv v1.5.1
 )
 
@@ -20,7 +22,6 @@ require (
 	cloud.google.com/go/monitoring v1.24.2 // indirect
 	cloud.google.com/go/secretmanager v1.15.0 // indirect
 	cloud.google.com/go/storage v1.50.0 // indirect
-	firebase.google.com/go/v4 v4.15.2 // indirect
 	github.com/GoogleCloudPlatform/opentelemetry-operations-go/detectors/gcp v1.27.0 // indirect
 	github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric v0.50.0 // indirect
 	github.com/GoogleCloudPlatform/opentelemetry-operations-go/internal/resourcemapping v0.50.0 // indirect
@@ -73,3 +74,5 @@ require (
 	google.golang.org/grpc v1.73.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 )
+
+replace github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts => ../AHSChemicalsGCShared/shared/accounts
@@ -47,6 +47,14 @@ done
 
 for i in "${!ENTRY_POINTS[@]}"; do
     echo "Deploying '${ENTRY_POINTS[$i]}' to region '${REGIONS[$i]}'..."
+
+    # Only the function source is uploaded, so the shared packages its go.mod replaces with the copies in
+    # AHSChemicalsGCShared are vendored into it for the build
+    VENDORED=false
+    if grep -q "=> \.\./AHSChemicalsGCShared" "${SOURCES[$i]}/go.mod"; then
+        (cd "${SOURCES[$i]}" && go mod vendor) || exit 1
+        VENDORED=true
+    fi
     
     gcloud functions deploy "${ENTRY_POINTS[$i]}"\
       --gen2 \
@@ -58,5 +66,9 @@ for i in "${!ENTRY_POINTS[@]}"; do
       --trigger-http \
       --allow-unauthenticated
 
+    if [ "$VENDORED" = true ]; then
+        rm -rf "${SOURCES[$i]}/vendor"
+    fi
+
     echo "Deployment complete. "${ENTRY_POINTS[$i]}" has been deployed"
 done
@@ -0,0 +1,352 @@
+package function
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+
+	SORT_BY_NAME       = "name"
+	SORT_BY_EMAIL      = "email"
+	SORT_BY_CREATED_AT = "created_at"
+
+	ORDER_ASC  = "asc"
+	ORDER_DESC = "desc"
+)
+
+// Account is a customer account as listed by FetchAccounts.
+type Account struct {
+	UID         string              `json:"uid"`
+	DisplayName string              `json:"displayName"`
+	Email       string              `json:"email"`
+	Disabled    bool                `json:"disabled"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Properties  []map[string]string `json:"properties"`
+	Brands      []string            `json:"brands"`
+	AssignedRep string              `json:"assigned_rep,omitempty"` // UID of the sales rep managing the account
+	Incomplete  bool                `json:"incomplete"`             // The account is missing its brands, its properties or its users document
+}
+
+// AccountFailure is an account whose users document or login could not be read.
+type AccountFailure struct {
+	UID   string `json:"uid"`
+	Error string `json:"error"`
+}
+
+// AccountsPage is the paginated response of FetchAccounts.
+type AccountsPage struct {
+	Accounts      []Account        `json:"accounts"`
+	TotalCount    int              `json:"total_count"`               // Number of accounts matching the filters, across all pages
+	NextPageToken string           `json:"next_page_token,omitempty"` // Pass as page_token to fetch the next page
+	Failures      []AccountFailure `json:"failures,omitempty"`        // Accounts left out of the listing because their data could not be read
+}
+
+// AccountQuery holds the filters, sorting and page requested from FetchAccounts.
+type AccountQuery struct {
+	Brand    string
+	State    string
+	County   string
+	Search   string // Matched against the start of the sorted name or email, case insensitive
+	Disabled *bool
+	// Only accounts assigned to this sales rep. FetchAccounts always sets it to the caller for sales reps.
+	AssignedRep string
+	SortBy      string
+	Order       string
+	PageSize    int
+	cursor      *pageCursor
+}
+
+// pageCursor identifies the last account of a page by its sort key and UID. It is sent to the client
+// base64 encoded as the page token, along with the sorting it was created for.
+type pageCursor struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Key    string `json:"k"`
+	UID    string `json:"u"`
+}
+
+// ParseAccountQuery reads the URL parameters of FetchAccounts.
+func ParseAccountQuery(values url.Values) (AccountQuery, error) {
+	query := AccountQuery{
+		Brand:       strings.TrimSpace(values.Get("brand")),
+		State:       strings.TrimSpace(values.Get("state")),
+		County:      strings.TrimSpace(values.Get("county")),
+		Search:      strings.ToLower(strings.TrimSpace(values.Get("search"))),
+		AssignedRep: strings.TrimSpace(values.Get("assigned_rep")),
+		SortBy:      SORT_BY_NAME,
+		Order:       ORDER_ASC,
+		PageSize:    defaultPageSize,
+	}
+
+	if value := values.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, errors.New("disabled must be true or false")
+		}
+		query.Disabled = &disabled
+	}
+
+	if value := values.Get("sort"); value != "" {
+		if !slices.Contains([]string{SORT_BY_NAME, SORT_BY_EMAIL, SORT_BY_CREATED_AT}, value) {
+			return query, errors.New("sort must be one of name, email or created_at")
+		}
+		query.SortBy = value
+	}
+	if query.Search != "" && query.SortBy == SORT_BY_CREATED_AT {
+		return query, errors.New("search requires sorting by name or email")
+	}
+	if value := values.Get("order"); value != "" {
+		if value != ORDER_ASC && value != ORDER_DESC {
+			return query, errors.New("order must be asc or desc")
+		}
+		query.Order = value
+	}
+
+	if value := values.Get("page_size"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return query, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+		query.PageSize = pageSize
+	}
+
+	if value := values.Get("page_token"); value != "" {
+		cursor, err := decodePageToken(value)
+		// A token only makes sense for the sorting it was created with
+		if err != nil || cursor.SortBy != query.SortBy || cursor.Order != query.Order {
+			return query, errors.New("Invalid page_token")
+		}
+		query.cursor = cursor
+	}
+
+	return query, nil
+}
+
+// FilterKey returns the filter key of the brand, state and county filters, "" when none is set.
+func (query AccountQuery) FilterKey() string {
+	return accounts.FilterKey(query.Brand, query.State, query.County)
+}
+
+// sortField returns the users document field the accounts are sorted by.
+func (query AccountQuery) sortField() string {
+	switch query.SortBy {
+	case SORT_BY_EMAIL:
+		return "email_lower"
+	case SORT_BY_CREATED_AT:
+		return "created_at"
+	default:
+		return "name_lower"
+	}
+}
+
+// Filter returns the users collection query matching every filter, without sorting or paging, so that
+// it can also be counted. Only customers are listed, staff accounts are managed through their roles.
+func (query AccountQuery) Filter(users firestore.Query) firestore.Query {
+	filtered := users.Where("role", "==", accounts.ROLE_CUSTOMER)
+	if key := query.FilterKey(); key != "" {
+		filtered = filtered.Where("filter_keys", "array-contains", key)
+	}
+	if query.Disabled != nil {
+		filtered = filtered.Where("disabled", "==", *query.Disabled)
+	}
+	if query.AssignedRep != "" {
+		filtered = filtered.Where(accounts.ASSIGNED_REP_FIELD, "==", query.AssignedRep)
+	}
+	// Searching matches the start of the sorted field, the only range Firestore can sort by
+	if query.Search != "" {
+		filtered = filtered.Where(query.sortField(), ">=", query.Search).Where(query.sortField(), "<", query.Search+"\uf8ff")
+	}
+	return filtered
+}
+
+// PageQuery returns the query of the requested page: the filtered query sorted, started after the cursor
+// of the page token and limited to one account more than the page size, which tells whether another page
+// follows. Accounts with the same sort key are ordered by UID so that pages never overlap.
+func (query AccountQuery) PageQuery(filtered firestore.Query) (firestore.Query, error) {
+	direction := firestore.Asc
+	if query.Order == ORDER_DESC {
+		direction = firestore.Desc
+	}
+	paged := filtered.OrderBy(query.sortField(), direction).OrderBy(firestore.DocumentID, direction)
+
+	if query.cursor != nil {
+		key, err := query.cursorKey()
+		if err != nil {
+			return paged, errors.New("Invalid page_token")
+		}
+		paged = paged.StartAfter(key, query.cursor.UID)
+	}
+	return paged.Limit(query.PageSize + 1), nil
+}
+
+// ListsAccountsWithoutDocument reports whether customers without a users document can match the query.
+// They have no brands, properties or sales rep, so a brand, state, county or assigned_rep filter, which
+// sales reps always have, leaves them out.
+func (query AccountQuery) ListsAccountsWithoutDocument() bool {
+	return query.FilterKey() == "" && query.AssignedRep == ""
+}
+
+// AccountsWithoutDocument returns the customers without a users document matching the disabled and search
+// filters, in the order of the query. The page token is not applied, see PageEntries.
+func (query AccountQuery) AccountsWithoutDocument(users []accounts.AuthUser) []accounts.AuthUser {
+	matching := []accounts.AuthUser{}
+	for _, user := range users {
+		if !query.ListsAccountsWithoutDocument() || user.Staff {
+			continue
+		}
+		if query.Disabled != nil && user.Disabled != *query.Disabled {
+			continue
+		}
+		if key, _ := query.authUserKey(user).(string); query.Search != "" && !strings.HasPrefix(key, query.Search) {
+			continue
+		}
+		matching = append(matching, user)
+	}
+	slices.SortFunc(matching, func(a, b accounts.AuthUser) int {
+		return query.compare(query.authUserKey(a), a.UID, query.authUserKey(b), b.UID)
+	})
+	return matching
+}
+
+// PageEntry is an account of a page, read either from a users document or, for a customer without one,
+// from their Auth user. Exactly one of Document and User is set.
+type PageEntry struct {
+	Key      any // Value of the sorted field, a string or a time.Time
+	UID      string
+	Document *firestore.DocumentSnapshot
+	User     *accounts.AuthUser
+}
+
+// DocumentEntry returns the page entry of a users document of the page query.
+func (query AccountQuery) DocumentEntry(docSnapshot *firestore.DocumentSnapshot) PageEntry {
+	return PageEntry{Key: docSnapshot.Data()[query.sortField()], UID: docSnapshot.Ref.ID, Document: docSnapshot}
+}
+
+// UserEntry returns the page entry of a customer without a users document.
+func (query AccountQuery) UserEntry(user accounts.AuthUser) PageEntry {
+	return PageEntry{Key: query.authUserKey(user), UID: user.UID, User: &user}
+}
+
+// PageEntries merges the users documents of the page query, which holds up to one more than the page size,
+// with the customers without a document, and returns the page and the token of the next page. Customers
+// without a document are sorted by the same fields as the users documents, so that the page token works
+// for both.
+func (query AccountQuery) PageEntries(documents []PageEntry, users []PageEntry) ([]PageEntry, string) {
+	merged := slices.Clone(documents)
+	seen := make(map[string]bool, len(documents))
+	for _, entry := range documents {
+		seen[entry.UID] = true
+	}
+	for _, entry := range users {
+		// A customer whose document was written since the users were compared is listed once
+		if seen[entry.UID] || !query.afterCursor(entry) {
+			continue
+		}
+		merged = append(merged, entry)
+	}
+	slices.SortStableFunc(merged, func(a, b PageEntry) int {
+		return query.compare(a.Key, a.UID, b.Key, b.UID)
+	})
+
+	if len(merged) <= query.PageSize {
+		return merged, ""
+	}
+	merged = merged[:query.PageSize]
+	last := merged[len(merged)-1]
+	return merged, query.pageToken(last.Key, last.UID)
+}
+
+// authUserKey returns the value of the sorted field a customer without a users document would have, see
+// accounts.SearchFields.
+func (query AccountQuery) authUserKey(user accounts.AuthUser) any {
+	switch query.SortBy {
+	case SORT_BY_EMAIL:
+		return strings.ToLower(user.Email)
+	case SORT_BY_CREATED_AT:
+		return user.CreatedAt
+	default:
+		return strings.ToLower(user.DisplayName)
+	}
+}
+
+// compare orders two accounts by their sort key and UID the way the page query does.
+func (query AccountQuery) compare(keyA any, uidA string, keyB any, uidB string) int {
+	result := 0
+	switch keyA := keyA.(type) {
+	case time.Time:
+		keyB, _ := keyB.(time.Time)
+		result = keyA.Compare(keyB)
+	case string:
+		keyB, _ := keyB.(string)
+		result = strings.Compare(keyA, keyB)
+	}
+	if result == 0 {
+		result = strings.Compare(uidA, uidB)
+	}
+	if query.Order == ORDER_DESC {
+		return -result
+	}
+	return result
+}
+
+// afterCursor reports whether the account follows the last account of the previous page.
+func (query AccountQuery) afterCursor(entry PageEntry) bool {
+	if query.cursor == nil {
+		return true
+	}
+	key, err := query.cursorKey()
+	if err != nil {
+		return false
+	}
+	return query.compare(entry.Key, entry.UID, key, query.cursor.UID) > 0
+}
+
+// cursorKey returns the sort key of the page token, parsed to the type of the sorted field.
+func (query AccountQuery) cursorKey() (any, error) {
+	if query.SortBy == SORT_BY_CREATED_AT {
+		return time.Parse(time.RFC3339Nano, query.cursor.Key)
+	}
+	return query.cursor.Key, nil
+}
+
+// pageToken returns the page token of the page following the account with the sort key and UID.
+func (query AccountQuery) pageToken(key any, uid string) string {
+	cursor := pageCursor{SortBy: query.SortBy, Order: query.Order, UID: uid}
+	switch key := key.(type) {
+	case time.Time:
+		cursor.Key = key.Format(time.RFC3339Nano)
+	case string:
+		cursor.Key = key
+	}
+	return encodePageToken(cursor)
+}
+
+func encodePageToken(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(token string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
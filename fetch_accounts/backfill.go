@@ -0,0 +1,136 @@
+package function
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// Number of users listed per Firebase Auth page, the maximum the Auth API allows
+	authPageSize = 1000
+
+	// Number of users documents read per GetAll call
+	getAllBatchSize = 100
+)
+
+// BackfillResult reports how many users documents a backfill updated.
+type BackfillResult struct {
+	Updated int `json:"updated"` // Users documents whose search fields were written
+	Skipped int `json:"skipped"` // Logins without a users document, reported by reconcile-accounts
+}
+
+// BackfillSearchFields writes the fields FetchAccounts searches on (see accounts.SearchFields) onto every
+// users document, from its login and its brands and properties. Documents written before those fields
+// existed are not listed until it ran once, and it can be run again to pick up changes made to logins
+// outside of the portal, such as a user disabled in the Firebase console.
+//
+// Authorization: Requires a valid Bearer token of a role with the reconcile_accounts permission.
+// Method: POST
+// Success Response: 200 OK with a BackfillResult
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func BackfillSearchFields(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS and preflight requests
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Validate HTTP method
+	if request.Method != http.MethodPost {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method, expected POST")
+		return
+	}
+
+	// Ensure that the caller's role allows maintaining the accounts
+	if _, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_RECONCILE_ACCOUNTS); err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+
+	result, err := backfillSearchFields(ctx)
+	if err != nil {
+		log.Printf("Error backfilling the account search fields: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error backfilling the account search fields")
+		return
+	}
+
+	shared.WriteJSONSuccess(response, http.StatusOK, "Account search fields backfilled successfully", result)
+}
+
+// backfillSearchFields lists every login and updates the search fields of their users documents.
+func backfillSearchFields(ctx context.Context) (*BackfillResult, error) {
+	result := &BackfillResult{}
+	bulkWriter := shared.FirestoreClient.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+
+	pager := iterator.NewPager(shared.AuthClient.Users(ctx, ""), authPageSize, "")
+	for {
+		var userRecords []*auth.ExportedUserRecord
+		nextPageToken, err := pager.NextPage(&userRecords)
+		if err != nil {
+			bulkWriter.End()
+			return nil, err
+		}
+
+		for start := 0; start < len(userRecords); start += getAllBatchSize {
+			batch := userRecords[start:min(start+getAllBatchSize, len(userRecords))]
+
+			docRefs := make([]*firestore.DocumentRef, 0, len(batch))
+			for _, userRecord := range batch {
+				docRefs = append(docRefs, shared.FirestoreClient.Collection("users").Doc(userRecord.UID))
+			}
+			docSnapshots, err := shared.FirestoreClient.GetAll(ctx, docRefs)
+			if err != nil {
+				bulkWriter.End()
+				return nil, err
+			}
+
+			for i, userRecord := range batch {
+				if !docSnapshots[i].Exists() {
+					result.Skipped++
+					continue
+				}
+
+				var document userDocument
+				if err := docSnapshots[i].DataTo(&document); err != nil {
+					log.Printf("Skipping malformed user document %s: %v", userRecord.UID, err)
+					result.Skipped++
+					continue
+				}
+
+				// Update rather than set, so that a document deleted in the meantime is not recreated
+				var updates []firestore.Update
+				for field, value := range accounts.SearchFields(userRecord.UserRecord, document.Brands, document.Properties) {
+					updates = append(updates, firestore.Update{FieldPath: []string{field}, Value: value})
+				}
+				job, err := bulkWriter.Update(docRefs[i], updates)
+				if err != nil {
+					bulkWriter.End()
+					return nil, err
+				}
+				jobs = append(jobs, job)
+			}
+		}
+
+		if nextPageToken == "" {
+			break
+		}
+	}
+
+	bulkWriter.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return nil, err
+		}
+	}
+	result.Updated = len(jobs)
+	return result, nil
+}
@@ -26,6 +26,7 @@ func main(){
 		shared.InitFirebaseDebug(adminSDKFilePath)
 		
 		http.Handle("/fetch-accounts", http.HandlerFunc(function.FetchAccounts))
+		http.Handle("/backfill-account-search-fields", http.HandlerFunc(function.BackfillSearchFields))
 			
 		log.Print("fetch-accounts started at: 3004")
 		err = http.ListenAndServe(":3004", nil)
@@ -1,14 +1,17 @@
 package function
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
-	"sync"
+	"time"
 
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
 	"firebase.google.com/go/v4/auth"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 )
 
 func init() {
@@ -16,15 +19,46 @@ func init() {
 	if os.Getenv("ENV") != "DEBUG" {
 		shared.InitFirebaseProd(nil)
 		functions.HTTP("fetch-accounts", FetchAccounts)
+		functions.HTTP("backfill-account-search-fields", BackfillSearchFields)
 	}
 }
 
-// FetchAccounts is a Google Cloud Function HTTP handler that retrieves all Firebase Auth users
-// who do not have custom claims set, along with their associated Firestore document data (properties & brands).
+// userDocument holds the users collection fields listed with an account.
+type userDocument struct {
+	Properties  []map[string]string `firestore:"properties"`
+	Brands      []string            `firestore:"brands"`
+	AssignedRep string              `firestore:"assigned_rep"`
+	CreatedAt   time.Time           `firestore:"created_at"`
+}
+
+// FetchAccounts is a Google Cloud Function HTTP handler that lists the customer accounts, along with their
+// associated Firestore document data (properties & brands), one page at a time.
+//
+// The filters, sorting and paging run as a single Firestore query on the users documents, using the
+// search fields the account functions store on them (see accounts.SearchFields), and the total count as a
+// count aggregation of the same query. Only the logins of the returned page are read from Firebase Auth.
+// Customers whose login has no users document are listed as incomplete accounts without brands or
+// properties: unless a brand, state, county or sales rep filter leaves them out, the Auth users are
+// compared with the users documents and the ones without a document are merged into the page.
+// Firestore merges the composite indexes listed in firestore.indexes.json to serve every combination of
+// filters, which have to be deployed along with the function.
 //
-// Authentication: Requires a valid Firebase ID token with 'admin' custom claim set to true in the Authorization header.
+// Authentication: Requires a valid Firebase ID token of a role with the fetch_accounts permission in the Authorization header.
 // Method: GET
-// Response: JSON with a list of user data or error message
+// URL Parameters:
+//   - brand: Only return accounts with this brand (optional)
+//   - state: Only return accounts with a property in this state (optional)
+//   - county: Only return accounts with a property in this county (optional)
+//   - search: Only return accounts whose name, or email when sorted by email, starts with this text, case insensitive (optional)
+//   - disabled: true or false to only return disabled or enabled accounts (optional)
+//   - assigned_rep: Only return accounts assigned to this sales rep, ignored for sales reps who only ever see their own (optional)
+//   - sort: name, email or created_at (optional, default name, search requires name or email)
+//   - order: asc or desc (optional, default asc)
+//   - page_size: Number of accounts per page, between 1 and 100 (optional, default 25)
+//   - page_token: The next_page_token of the previous page, requested with the same sort and order (optional)
+//
+// Response: JSON with an AccountsPage or error message. Accounts whose document or login could not be read
+// are listed under failures instead of failing the whole response.
 func FetchAccounts(response http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 
@@ -39,81 +73,166 @@ func FetchAccounts(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Ensure that the user is authorized (admin privileges)
-	if err := shared.IsAuthorizedAndAdmin(request); err != nil {
-		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+	// Ensure that the caller's role allows listing accounts
+	token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_FETCH_ACCOUNTS)
+	if err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+
+	query, err := ParseAccountQuery(request.URL.Query())
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Sales reps only see the customers assigned to them
+	if accounts.IsScopedToAssignedAccounts(accounts.RoleFromClaims(token.Claims)) {
+		query.AssignedRep = token.UID
+	}
+
+	page, err := fetchAccountsPage(ctx, query)
+	if err != nil {
+		log.Printf("Error listing the accounts: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error listing the accounts")
 		return
 	}
 
-	iter := shared.AuthClient.Users(ctx, "") // Iterator to fetch all Firebase users
-	users := []map[string]any{}
-	var mu sync.Mutex // Protect concurrent writes to `users` slice
+	if len(page.Failures) > 0 {
+		log.Printf("Data of %d accounts could not be fetched", len(page.Failures))
+		shared.WriteJSONSuccess(response, http.StatusOK, "Fetched accounts, but some of them could not be read", page)
+		return
+	}
+
+	shared.WriteJSONSuccess(response, http.StatusOK, "Fetched accounts successfully", page)
+}
+
+// fetchAccountsPage counts the users documents matching the query, along with the customers without one,
+// reads the requested page of them and the logins of that page.
+func fetchAccountsPage(ctx context.Context, query AccountQuery) (AccountsPage, error) {
+	page := AccountsPage{Accounts: []Account{}}
+	filtered := query.Filter(shared.FirestoreClient.Collection(accounts.USERS_COLLECTION).Query)
+
+	countResult, err := filtered.NewAggregationQuery().WithCount("total_count").Get(ctx)
+	if err != nil {
+		return page, err
+	}
+	if count, ok := countResult["total_count"].(*firestorepb.Value); ok {
+		page.TotalCount = int(count.GetIntegerValue())
+	}
+
+	var userEntries []PageEntry
+	if query.ListsAccountsWithoutDocument() {
+		withoutDocument, err := customersWithoutDocument(ctx)
+		if err != nil {
+			return page, err
+		}
+		matching := query.AccountsWithoutDocument(withoutDocument)
+		page.TotalCount += len(matching)
+		for _, user := range matching {
+			userEntries = append(userEntries, query.UserEntry(user))
+		}
+	}
 
-	const maxConcurrentLimit = 50
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, maxConcurrentLimit)
+	pageQuery, err := query.PageQuery(filtered)
+	if err != nil {
+		return page, err
+	}
+	docSnapshots, err := pageQuery.Documents(ctx).GetAll()
+	if err != nil {
+		return page, err
+	}
+	documentEntries := make([]PageEntry, 0, len(docSnapshots))
+	for _, docSnapshot := range docSnapshots {
+		documentEntries = append(documentEntries, query.DocumentEntry(docSnapshot))
+	}
 
-	var errs []error
-	var errsMu sync.Mutex // Protect concurrent writes to `errs` slice
+	entries, nextPageToken := query.PageEntries(documentEntries, userEntries)
+	page.NextPageToken = nextPageToken
+	if len(entries) == 0 {
+		return page, nil
+	}
 
-	// Iterate through Firebase users
-	for {
-		userRecord, err := iter.Next()
-		if userRecord == nil {
-			break
+	// Read the logins of the page in a single call, page sizes stay within the limit of 100 users
+	identifiers := make([]auth.UserIdentifier, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Document != nil {
+			identifiers = append(identifiers, auth.UIDIdentifier{UID: entry.UID})
 		}
+	}
+	userRecords := make(map[string]*auth.UserRecord, len(identifiers))
+	if len(identifiers) > 0 {
+		usersResult, err := shared.AuthClient.GetUsers(ctx, identifiers)
 		if err != nil {
-			log.Printf("Error fetching user records: %v", err)
-			shared.WriteJSONError(response, http.StatusInternalServerError, err.Error())
-			return
+			return page, err
+		}
+		for _, userRecord := range usersResult.Users {
+			userRecords[userRecord.UID] = userRecord
+		}
+	}
+
+	for _, entry := range entries {
+		// Customers without a users document are listed from their login, without brands or properties
+		if entry.User != nil {
+			page.Accounts = append(page.Accounts, Account{
+				UID:         entry.UID,
+				DisplayName: entry.User.DisplayName,
+				Email:       entry.User.Email,
+				Disabled:    entry.User.Disabled,
+				CreatedAt:   entry.User.CreatedAt,
+				Brands:      []string{},
+				Properties:  []map[string]string{},
+				Incomplete:  true,
+			})
+			continue
 		}
 
-		record := userRecord // Capture for use in the goroutine
-
-		wg.Add(1)
-		sem <- struct{}{} // Acquire a slot for concurrency limiting
-
-		go func(record *auth.ExportedUserRecord) {
-			defer wg.Done()
-			defer func() { <-sem }() // Release slot when done
-
-			// Process users who do not have custom claims set
-			if record.CustomClaims == nil {
-				docSnapshot, err := shared.FirestoreClient.Collection("users").Doc(record.UserRecord.UserInfo.UID).Get(ctx)
-				if err != nil {
-					errsMu.Lock()
-					errs = append(errs, err)
-					errsMu.Unlock()
-					return
-				}
-
-				data := docSnapshot.Data()
-				properties := data["properties"]
-				brands := data["brands"]
-
-				userMap := map[string]any{
-					"uid":         record.UserRecord.UserInfo.UID,
-					"displayName": record.UserRecord.UserInfo.DisplayName,
-					"email":       record.UserRecord.UserInfo.Email,
-					"properties":  properties,
-					"brands":      brands,
-				}
-
-				mu.Lock()
-				users = append(users, userMap)
-				mu.Unlock()
-			}
-		}(record)
-	}
-
-	wg.Wait()
-
-	// If any errors occurred while fetching Firestore data, respond with an error
-	if len(errs) > 0 {
-		log.Print("Error occurred while fetching some user accounts")
-		shared.WriteJSONError(response, http.StatusInternalServerError, "Some user data could not be fetched")
-		return
+		userRecord, found := userRecords[entry.UID]
+		if !found {
+			page.Failures = append(page.Failures, AccountFailure{UID: entry.UID, Error: "No login found for the account"})
+			continue
+		}
+
+		var document userDocument
+		if err := entry.Document.DataTo(&document); err != nil {
+			log.Printf("Error reading user document %s: %v", entry.UID, err)
+			page.Failures = append(page.Failures, AccountFailure{UID: entry.UID, Error: "User data is malformed"})
+			continue
+		}
+
+		account := Account{
+			UID:         entry.UID,
+			DisplayName: userRecord.DisplayName,
+			Email:       userRecord.Email,
+			Disabled:    userRecord.Disabled,
+			CreatedAt:   document.CreatedAt,
+			Brands:      []string{},
+			Properties:  []map[string]string{},
+			AssignedRep: document.AssignedRep,
+		}
+		if document.Brands != nil {
+			account.Brands = document.Brands
+		}
+		if document.Properties != nil {
+			account.Properties = document.Properties
+		}
+		account.Incomplete = len(account.Brands) == 0 || len(account.Properties) == 0
+		page.Accounts = append(page.Accounts, account)
 	}
+	return page, nil
+}
 
-	shared.WriteJSONSuccess(response, http.StatusOK, "Fetched accounts successfully", users)
-}
\ No newline at end of file
+// customersWithoutDocument returns the customers whose Auth user has no users document, such as those
+// left behind when create-account could not write it.
+func customersWithoutDocument(ctx context.Context) ([]accounts.AuthUser, error) {
+	users, err := accounts.ListAuthUsers(ctx, shared.AuthClient)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := accounts.ListUserDocuments(ctx, shared.FirestoreClient)
+	if err != nil {
+		return nil, err
+	}
+	withoutDocument, _ := accounts.FindOrphans(users, documents, time.Now())
+	return withoutDocument, nil
+}
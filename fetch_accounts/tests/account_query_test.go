@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"encoding/base64"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestParseAccountQueryRejectsInvalidParameters(t *testing.T) {
+	for _, raw := range []string{
+		"disabled=maybe",
+		"sort=phone",
+		"order=up",
+		"page_size=0",
+		"page_size=101",
+		"page_token=not-a-token",
+		"search=car&sort=created_at", // Only the sorted name or email can be searched
+	} {
+		values, _ := url.ParseQuery(raw)
+		if _, err := function.ParseAccountQuery(values); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestParseAccountQueryDefaults(t *testing.T) {
+	query, err := function.ParseAccountQuery(url.Values{"search": {"  Carol "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.SortBy != function.SORT_BY_NAME || query.Order != function.ORDER_ASC || query.PageSize != 25 {
+		t.Errorf("expected name, asc and 25, got %s, %s and %d", query.SortBy, query.Order, query.PageSize)
+	}
+	if query.Search != "carol" {
+		t.Errorf("expected the search to be trimmed and lowercased, got %q", query.Search)
+	}
+}
+
+func TestAccountQueryFilterKey(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"brand=Clorox", "brand:clorox"},
+		{"state=NV&county=Kern", "state:nv|county:kern"},
+		{"brand=Kem Tek&county=Washoe&disabled=true", "brand:kem tek|county:washoe"},
+	}
+
+	for _, test := range tests {
+		values, _ := url.ParseQuery(test.raw)
+		query, err := function.ParseAccountQuery(values)
+		if err != nil {
+			t.Fatalf("%q: %v", test.raw, err)
+		}
+		if key := query.FilterKey(); key != test.want {
+			t.Errorf("%q: expected %q, got %q", test.raw, test.want, key)
+		}
+	}
+}
+
+func TestAccountQueryPageTokenRequiresSameSort(t *testing.T) {
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","o":"asc","k":"carol","u":"c"}`))
+
+	if _, err := function.ParseAccountQuery(url.Values{"page_token": {token}}); err != nil {
+		t.Errorf("expected a page_token of the same sort to be accepted, got %v", err)
+	}
+	if _, err := function.ParseAccountQuery(url.Values{"page_token": {token}, "sort": {"email"}}); err == nil {
+		t.Error("expected a page_token of another sort to be rejected")
+	}
+}
+
+func TestAccountsWithoutDocument(t *testing.T) {
+	users := []accounts.AuthUser{
+		{UID: "c", DisplayName: "Carol"},
+		{UID: "a", DisplayName: "alice", Disabled: true},
+		{UID: "b", DisplayName: "Bob"},
+		{UID: "s", DisplayName: "Cathy", Staff: true},
+	}
+
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{raw: "", want: []string{"a", "b", "c"}},
+		{raw: "order=desc", want: []string{"c", "b", "a"}},
+		{raw: "search=ca", want: []string{"c"}},
+		{raw: "disabled=false", want: []string{"b", "c"}},
+		{raw: "brand=Clorox", want: []string{}},
+		{raw: "state=CA", want: []string{}},
+		{raw: "assigned_rep=rep1", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.raw)
+		query, err := function.ParseAccountQuery(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, user := range query.AccountsWithoutDocument(users) {
+			got = append(got, user.UID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.raw, tt.want, got)
+		}
+	}
+}
+
+func TestPageEntriesMergesAccountsWithoutDocument(t *testing.T) {
+	query, err := function.ParseAccountQuery(url.Values{"page_size": {"3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents := []function.PageEntry{
+		{Key: "alice", UID: "a"},
+		{Key: "carol", UID: "c"},
+		{Key: "dave", UID: "d"},
+		{Key: "erin", UID: "e"}, // The one more than the page size the page query reads
+	}
+	users := []function.PageEntry{
+		query.UserEntry(accounts.AuthUser{UID: "b", DisplayName: "Bob"}),
+		query.UserEntry(accounts.AuthUser{UID: "c", DisplayName: "Carol"}), // Document written since the comparison
+	}
+
+	entries, nextPageToken := query.PageEntries(documents, users)
+	if got := pageUIDs(entries); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("expected a, b and c, got %v", got)
+	}
+	if entries[1].User == nil || entries[2].User != nil {
+		t.Error("expected b to be listed from its login and c from its document")
+	}
+	if nextPageToken == "" {
+		t.Fatal("expected a next page")
+	}
+
+	// The next page continues after c in both the documents and the logins
+	next, err := function.ParseAccountQuery(url.Values{"page_size": {"3"}, "page_token": {nextPageToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users = append(users, next.UserEntry(accounts.AuthUser{UID: "z", DisplayName: "Zoe"}))
+	entries, nextPageToken = next.PageEntries([]function.PageEntry{{Key: "dave", UID: "d"}, {Key: "erin", UID: "e"}}, users)
+	if got := pageUIDs(entries); !slices.Equal(got, []string{"d", "e", "z"}) {
+		t.Errorf("expected d, e and z, got %v", got)
+	}
+	if nextPageToken != "" {
+		t.Errorf("expected the last page, got next page token %q", nextPageToken)
+	}
+}
+
+func TestPageEntriesSortedByCreation(t *testing.T) {
+	query, err := function.ParseAccountQuery(url.Values{"sort": {"created_at"}, "order": {"desc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	documents := []function.PageEntry{{Key: now.Add(-time.Hour), UID: "old"}}
+	users := []function.PageEntry{query.UserEntry(accounts.AuthUser{UID: "new", CreatedAt: now})}
+
+	entries, _ := query.PageEntries(documents, users)
+	if got := pageUIDs(entries); !slices.Equal(got, []string{"new", "old"}) {
+		t.Errorf("expected new before old, got %v", got)
+	}
+}
+
+func pageUIDs(entries []function.PageEntry) []string {
+	uids := []string{}
+	for _, entry := range entries {
+		uids = append(uids, entry.UID)
+	}
+	return uids
+}
@@ -0,0 +1,222 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+)
+
+const (
+	ORDERS_COLLECTION = "orders"
+
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// Layout of the from and to URL parameters
+	dateLayout = "2006-01-02"
+)
+
+// OrderLine is an ordered product as stored on the order by the place-order function.
+type OrderLine struct {
+	ProductID string  `firestore:"product_id" json:"product_id"`
+	Name      string  `firestore:"name" json:"name"`
+	Brand     string  `firestore:"brand" json:"brand"`
+	SKU       string  `firestore:"sku" json:"sku"`
+	Quantity  float64 `firestore:"quantity" json:"quantity"`
+	UnitPrice float64 `firestore:"unit_price" json:"unit_price"`
+}
+
+// Order is an entry of the caller's order history.
+type Order struct {
+	ID                  string            `firestore:"-" json:"id"`
+	PropertyIndex       int               `firestore:"property_index" json:"property_index"`
+	Property            map[string]string `firestore:"property" json:"property"`
+	Items               []OrderLine       `firestore:"items" json:"items"`
+	Total               float64           `firestore:"total" json:"total"`
+	Memo                string            `firestore:"memo" json:"memo"`
+	Status              string            `firestore:"status" json:"status"`
+	QuickBooksInvoiceID string            `firestore:"quickbooks_invoice_id" json:"quickbooks_invoice_id,omitempty"`
+	QuickBooksDocNumber string            `firestore:"quickbooks_doc_number" json:"invoice_number,omitempty"` // Invoice number shown to the customer
+	CreatedAt           time.Time         `firestore:"created_at" json:"created_at"`
+	UpdatedAt           time.Time         `firestore:"updated_at" json:"updated_at"`
+}
+
+// OrdersPage is the paginated response of FetchOrders.
+type OrdersPage struct {
+	Orders        []Order `json:"orders"`
+	NextPageToken string  `json:"next_page_token,omitempty"` // Pass as page_token to fetch the next page
+}
+
+// OrderFilters are the URL parameters of FetchOrders.
+type OrderFilters struct {
+	PropertyIndex *int      // nil when orders to every property are listed
+	From          time.Time // First instant included, zero when unbounded
+	To            time.Time // First instant excluded, the day after the to parameter, zero when unbounded
+	PageSize      int
+	PageToken     string
+}
+
+func init() {
+	// Initialize Firebase and register the Cloud Function only in production environment.
+	if os.Getenv("ENV") != "DEBUG" {
+		shared.InitFirebaseProd(nil)
+		functions.HTTP("fetch-orders", FetchOrders)
+	}
+}
+
+// FetchOrders returns the order history of the caller, newest first. Orders are stored in the orders
+// collection with the UID of the customer who placed them, and only the caller's own orders are listed.
+//
+// Authentication: Requires a valid Firebase ID token in the Authorization header.
+// Method: GET
+// URL Parameters:
+//   - property_index: Only return orders shipped to this property of the caller (optional)
+//   - from: Only return orders placed on or after this date, formatted as YYYY-MM-DD (optional)
+//   - to: Only return orders placed on or before this date, formatted as YYYY-MM-DD (optional)
+//   - page_size: Number of orders per page, between 1 and 100 (optional, default 20)
+//   - page_token: The next_page_token of the previous page (optional)
+//
+// Response: JSON with an OrdersPage or error message
+func FetchOrders(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS and preflight requests
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Validate HTTP method
+	if request.Method != http.MethodGet {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method")
+		return
+	}
+
+	// Ensure that the user is authorized
+	if err := shared.IsAuthorized(request); err != nil {
+		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+	token, err := verifyCaller(ctx, request)
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	filters, err := ParseOrderFilters(request.URL.Query())
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Only the caller's own orders, whatever the other filters are
+	ordersQuery := shared.FirestoreClient.Collection(ORDERS_COLLECTION).Where("customer_uid", "==", token.UID)
+	if filters.PropertyIndex != nil {
+		ordersQuery = ordersQuery.Where("property_index", "==", *filters.PropertyIndex)
+	}
+	if !filters.From.IsZero() {
+		ordersQuery = ordersQuery.Where("created_at", ">=", filters.From)
+	}
+	if !filters.To.IsZero() {
+		ordersQuery = ordersQuery.Where("created_at", "<", filters.To)
+	}
+
+	ordersQuery = ordersQuery.OrderBy("created_at", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+
+	// Continue after the last order of the previous page
+	if filters.PageToken != "" {
+		cursor, err := shared.FirestoreClient.Collection(ORDERS_COLLECTION).Doc(filters.PageToken).Get(ctx)
+		if err != nil || cursor.Data()["customer_uid"] != token.UID {
+			shared.WriteJSONError(response, http.StatusBadRequest, "Invalid page_token")
+			return
+		}
+		ordersQuery = ordersQuery.StartAfter(cursor)
+	}
+
+	orderSnapshots, err := ordersQuery.Limit(filters.PageSize).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error fetching orders for uid %s: %v", token.UID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error fetching orders")
+		return
+	}
+
+	page := OrdersPage{Orders: make([]Order, 0, len(orderSnapshots))}
+	for _, orderSnapshot := range orderSnapshots {
+		var order Order
+		if err := orderSnapshot.DataTo(&order); err != nil {
+			log.Printf("Error reading order %s: %v", orderSnapshot.Ref.ID, err)
+			continue
+		}
+		order.ID = orderSnapshot.Ref.ID
+		page.Orders = append(page.Orders, order)
+	}
+	if len(orderSnapshots) == filters.PageSize {
+		page.NextPageToken = orderSnapshots[len(orderSnapshots)-1].Ref.ID
+	}
+
+	shared.WriteJSONSuccess(response, http.StatusOK, "Fetched orders successfully", page)
+}
+
+// ParseOrderFilters reads the URL parameters of FetchOrders. The error of an invalid parameter is meant
+// for the caller.
+func ParseOrderFilters(query url.Values) (*OrderFilters, error) {
+	filters := &OrderFilters{PageSize: defaultPageSize, PageToken: query.Get("page_token")}
+
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return nil, errors.New("page_size must be between 1 and 100")
+		}
+		filters.PageSize = pageSize
+	}
+
+	if value := query.Get("property_index"); value != "" {
+		propertyIndex, err := strconv.Atoi(value)
+		if err != nil || propertyIndex < 0 {
+			return nil, errors.New("Invalid property_index")
+		}
+		filters.PropertyIndex = &propertyIndex
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return nil, errors.New("from must be formatted as YYYY-MM-DD")
+		}
+		filters.From = from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return nil, errors.New("to must be formatted as YYYY-MM-DD")
+		}
+		// The whole day of the to date is included
+		filters.To = to.AddDate(0, 0, 1)
+	}
+	if !filters.From.IsZero() && !filters.To.IsZero() && !filters.From.Before(filters.To) {
+		return nil, errors.New("from must not be after to")
+	}
+
+	return filters, nil
+}
+
+// verifyCaller verifies the Firebase ID token of the request and returns it. shared.IsAuthorized
+// only reports whether the token is valid, while this function also needs the caller's UID.
+func verifyCaller(ctx context.Context, request *http.Request) (*auth.Token, error) {
+	authorization := request.Header.Get("Authorization")
+	idToken, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || idToken == "" {
+		return nil, errors.New("Missing or invalid Authorization header")
+	}
+	return shared.AuthClient.VerifyIDToken(ctx, idToken)
+}
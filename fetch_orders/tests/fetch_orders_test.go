@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestParseOrderFilters(t *testing.T) {
+	day := func(value string) time.Time {
+		date, _ := time.Parse("2006-01-02", value)
+		return date
+	}
+
+	tests := []struct {
+		name              string
+		query             string
+		wantErr           bool
+		wantPageSize      int
+		wantPropertyIndex int // -1 when no property filter is expected
+		wantFrom          time.Time
+		wantTo            time.Time
+	}{
+		{name: "No parameters", query: "", wantPageSize: 20, wantPropertyIndex: -1},
+		{name: "Page size", query: "page_size=100", wantPageSize: 100, wantPropertyIndex: -1},
+		{name: "Page size too large", query: "page_size=101", wantErr: true},
+		{name: "Page size zero", query: "page_size=0", wantErr: true},
+		{name: "First property", query: "property_index=0", wantPageSize: 20, wantPropertyIndex: 0},
+		{name: "Negative property", query: "property_index=-1", wantErr: true},
+		{name: "Property not a number", query: "property_index=main", wantErr: true},
+		{
+			name:              "Date range includes the whole to day",
+			query:             "from=2026-03-01&to=2026-03-31",
+			wantPageSize:      20,
+			wantPropertyIndex: -1,
+			wantFrom:          day("2026-03-01"),
+			wantTo:            day("2026-04-01"),
+		},
+		{
+			name:              "Single day",
+			query:             "from=2026-03-01&to=2026-03-01",
+			wantPageSize:      20,
+			wantPropertyIndex: -1,
+			wantFrom:          day("2026-03-01"),
+			wantTo:            day("2026-03-02"),
+		},
+		{name: "From after to", query: "from=2026-03-02&to=2026-03-01", wantErr: true},
+		{name: "Badly formatted date", query: "from=03/01/2026", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filters, err := function.ParseOrderFilters(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if filters.PageSize != tt.wantPageSize {
+				t.Errorf("[%s] Expected page size %d, got %d", tt.name, tt.wantPageSize, filters.PageSize)
+			}
+			if tt.wantPropertyIndex < 0 && filters.PropertyIndex != nil {
+				t.Errorf("[%s] Expected no property filter, got %d", tt.name, *filters.PropertyIndex)
+			}
+			if tt.wantPropertyIndex >= 0 && (filters.PropertyIndex == nil || *filters.PropertyIndex != tt.wantPropertyIndex) {
+				t.Errorf("[%s] Expected property %d, got %v", tt.name, tt.wantPropertyIndex, filters.PropertyIndex)
+			}
+			if !filters.From.Equal(tt.wantFrom) || !filters.To.Equal(tt.wantTo) {
+				t.Errorf("[%s] Expected range %v - %v, got %v - %v", tt.name, tt.wantFrom, tt.wantTo, filters.From, filters.To)
+			}
+		})
+	}
+}
+
+func TestParseOrderFiltersPageToken(t *testing.T) {
+	filters, err := function.ParseOrderFilters(url.Values{"page_token": {"order-42"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if filters.PageToken != "order-42" {
+		t.Errorf("Expected page token order-42, got %q", filters.PageToken)
+	}
+}
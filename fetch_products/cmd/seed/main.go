@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/joho/godotenv"
+)
+
+// seedProduct mirrors one entry of products_seed.json
+type seedProduct struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Brand       string  `json:"brand"`
+	SKU         string  `json:"sku"`
+	Description string  `json:"description"`
+	UnitPrice   float64 `json:"unit_price"`
+	Active      bool    `json:"active"`
+}
+
+// Seeds the debug project's products collection with the sample catalog in products_seed.json.
+// In production the collection is filled by the quickbooks-import-items function.
+func main(){
+
+	//Only for local development
+	if os.Getenv("ENV") == "DEBUG"{
+
+		//Load the env file
+		err := godotenv.Load("../keys/.env")
+		if err != nil{
+			log.Printf("Error occurred loading the env file: %v", err)
+		}
+
+		//Initialize the debug project sdk
+		shared.InitFirebaseDebug(os.Getenv("FIREBASE_CREDENTIALS_DEBUG"))
+
+		seedFile, err := os.ReadFile("products_seed.json")
+		if err != nil{
+			log.Fatalf("Error occurred reading the seed file: %v", err)
+		}
+
+		var products []seedProduct
+		if err := json.Unmarshal(seedFile, &products); err != nil{
+			log.Fatalf("Error occurred parsing the seed file: %v", err)
+		}
+
+		ctx := context.Background()
+		for _, product := range products {
+			data := map[string]any{
+				"name":        product.Name,
+				"name_lower":  strings.ToLower(product.Name),
+				"brand":       product.Brand,
+				"sku":         product.SKU,
+				"description": product.Description,
+				"unit_price":  product.UnitPrice,
+				"active":      product.Active,
+			}
+			if _, err := shared.FirestoreClient.Collection("products").Doc(product.ID).Set(ctx, data); err != nil{
+				log.Fatalf("Error occurred seeding product %s: %v", product.ID, err)
+			}
+		}
+		log.Printf("Seeded %d products", len(products))
+	}
+}
@@ -0,0 +1,236 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+)
+
+const (
+	PRODUCTS_COLLECTION = "products"
+	USERS_COLLECTION    = "users"
+
+	defaultPageSize = 25
+	maxPageSize     = 100
+
+	// Firestore accepts at most 30 values in an "in" filter
+	maxBrandsPerQuery = 30
+)
+
+var (
+	// ErrNoBrandsAssigned is returned for a customer without brands, who may not see any product.
+	ErrNoBrandsAssigned = errors.New("No brands are assigned to this account")
+
+	// ErrBrandNotAssigned is returned when a customer filters on a brand that is not theirs.
+	ErrBrandNotAssigned = errors.New("This brand is not assigned to your account")
+
+	// ErrTooManyBrands is returned when the brands do not fit in a single Firestore "in" filter.
+	ErrTooManyBrands = errors.New("Too many brands, filter by a single brand")
+)
+
+// Product is a catalog entry in the products collection. Documents are keyed by the QuickBooks item ID
+// and written by the quickbooks-import-items function.
+type Product struct {
+	ID               string  `firestore:"-" json:"id"`
+	Name             string  `firestore:"name" json:"name"`
+	NameLower        string  `firestore:"name_lower" json:"-"` // Lowercase name used for prefix search
+	Brand            string  `firestore:"brand" json:"brand"`
+	SKU              string  `firestore:"sku" json:"sku"`
+	Description      string  `firestore:"description" json:"description"`
+	UnitPrice        float64 `firestore:"unit_price" json:"unit_price"`
+	Active           bool    `firestore:"active" json:"active"`
+	QuickBooksItemID string  `firestore:"quickbooks_item_id" json:"quickbooks_item_id"`
+}
+
+// ProductsPage is the paginated response of FetchProducts.
+type ProductsPage struct {
+	Products      []Product `json:"products"`
+	NextPageToken string    `json:"next_page_token,omitempty"` // Pass as page_token to fetch the next page
+}
+
+func init() {
+	// Initialize Firebase and register the Cloud Function only in production environment.
+	if os.Getenv("ENV") != "DEBUG" {
+		shared.InitFirebaseProd(nil)
+		functions.HTTP("fetch-products", FetchProducts)
+	}
+}
+
+// FetchProducts returns the active products of the brands assigned to the caller in their users/{uid}
+// document. Admins can see the products of every brand.
+//
+// Authentication: Requires a valid Firebase ID token in the Authorization header.
+// Method: GET
+// URL Parameters:
+//   - brand: Only return products of this brand, must be one of the caller's brands (optional)
+//   - search: Case-insensitive prefix of the product name (optional)
+//   - page_size: Number of products per page, between 1 and 100 (optional, default 25)
+//   - page_token: The next_page_token of the previous page (optional)
+//
+// Response: JSON with a ProductsPage or error message
+func FetchProducts(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS and preflight requests
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Validate HTTP method
+	if request.Method != http.MethodGet {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method")
+		return
+	}
+
+	// Ensure that the user is authorized
+	if err := shared.IsAuthorized(request); err != nil {
+		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+	token, err := verifyCaller(ctx, request)
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	query := request.URL.Query()
+
+	pageSize, err := ParsePageSize(query.Get("page_size"))
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Work out which brands the caller may see
+	var assignedBrands []string
+	isAdmin, _ := token.Claims["admin"].(bool)
+	if !isAdmin {
+		userSnapshot, err := shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(token.UID).Get(ctx)
+		if err != nil {
+			log.Printf("Error fetching document for uid %v: %v", token.UID, err)
+			shared.WriteJSONError(response, http.StatusForbidden, "No brands are assigned to this account")
+			return
+		}
+		var user struct {
+			Brands []string `firestore:"brands"`
+		}
+		if err := userSnapshot.DataTo(&user); err != nil {
+			log.Printf("Error reading brands for uid %v: %v", token.UID, err)
+			shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the account's brands")
+			return
+		}
+		assignedBrands = user.Brands
+	}
+
+	brands, err := AllowedBrands(isAdmin, assignedBrands, query.Get("brand"))
+	if errors.Is(err, ErrTooManyBrands) {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// Build the query: active products of the allowed brands ordered by name
+	productsQuery := shared.FirestoreClient.Collection(PRODUCTS_COLLECTION).Where("active", "==", true)
+	switch len(brands) {
+	case 0:
+		// Admin without a brand filter
+	case 1:
+		productsQuery = productsQuery.Where("brand", "==", brands[0])
+	default:
+		productsQuery = productsQuery.Where("brand", "in", brands)
+	}
+
+	if search := strings.ToLower(strings.TrimSpace(query.Get("search"))); search != "" {
+		productsQuery = productsQuery.Where("name_lower", ">=", search).Where("name_lower", "<", search+"\uf8ff")
+	}
+	productsQuery = productsQuery.OrderBy("name_lower", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc)
+
+	// Continue after the last product of the previous page
+	if pageToken := query.Get("page_token"); pageToken != "" {
+		cursor, err := shared.FirestoreClient.Collection(PRODUCTS_COLLECTION).Doc(pageToken).Get(ctx)
+		if err != nil {
+			shared.WriteJSONError(response, http.StatusBadRequest, "Invalid page_token")
+			return
+		}
+		productsQuery = productsQuery.StartAfter(cursor)
+	}
+
+	productSnapshots, err := productsQuery.Limit(pageSize).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error fetching products: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error fetching products")
+		return
+	}
+
+	page := ProductsPage{Products: make([]Product, 0, len(productSnapshots))}
+	for _, productSnapshot := range productSnapshots {
+		var product Product
+		if err := productSnapshot.DataTo(&product); err != nil {
+			log.Printf("Error reading product %s: %v", productSnapshot.Ref.ID, err)
+			continue
+		}
+		product.ID = productSnapshot.Ref.ID
+		page.Products = append(page.Products, product)
+	}
+	if len(productSnapshots) == pageSize {
+		page.NextPageToken = productSnapshots[len(productSnapshots)-1].Ref.ID
+	}
+
+	shared.WriteJSONSuccess(response, http.StatusOK, "Fetched products successfully", page)
+}
+
+// ParsePageSize parses the page_size parameter, defaulting to 25 when it is empty.
+func ParsePageSize(value string) (int, error) {
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	pageSize, err := strconv.Atoi(value)
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		return 0, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+	}
+	return pageSize, nil
+}
+
+// AllowedBrands returns the brands whose products the caller may list: the requested brand, which must be
+// one of the caller's brands, or else all of them. Admins may request any brand, and nil is returned for
+// an admin without a brand filter, who sees every brand.
+func AllowedBrands(isAdmin bool, assignedBrands []string, requestedBrand string) ([]string, error) {
+	if !isAdmin && len(assignedBrands) == 0 {
+		return nil, ErrNoBrandsAssigned
+	}
+	if requestedBrand != "" {
+		if !isAdmin && !slices.Contains(assignedBrands, requestedBrand) {
+			return nil, ErrBrandNotAssigned
+		}
+		return []string{requestedBrand}, nil
+	}
+	if len(assignedBrands) > maxBrandsPerQuery {
+		return nil, ErrTooManyBrands
+	}
+	return assignedBrands, nil
+}
+
+// verifyCaller verifies the Firebase ID token of the request and returns it. shared.IsAuthorized
+// only reports whether the token is valid, while this function also needs the caller's UID and claims.
+func verifyCaller(ctx context.Context, request *http.Request) (*auth.Token, error) {
+	authorization := request.Header.Get("Authorization")
+	idToken, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || idToken == "" {
+		return nil, errors.New("Missing or invalid Authorization header")
+	}
+	return shared.AuthClient.VerifyIDToken(ctx, idToken)
+}
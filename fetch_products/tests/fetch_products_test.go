@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestAllowedBrands(t *testing.T) {
+	manyBrands := make([]string, 31)
+	for i := range manyBrands {
+		manyBrands[i] = string(rune('A' + i))
+	}
+
+	tests := []struct {
+		name           string
+		isAdmin        bool
+		assignedBrands []string
+		requestedBrand string
+		want           []string
+		wantErr        error
+	}{
+		{name: "Customer sees their brands", assignedBrands: []string{"ProBlend", "Husky"}, want: []string{"ProBlend", "Husky"}},
+		{name: "Customer filters on one of their brands", assignedBrands: []string{"ProBlend", "Husky"}, requestedBrand: "Husky", want: []string{"Husky"}},
+		{name: "Customer filters on another brand", assignedBrands: []string{"ProBlend"}, requestedBrand: "Husky", wantErr: function.ErrBrandNotAssigned},
+		{name: "Customer without brands", wantErr: function.ErrNoBrandsAssigned},
+		{name: "Customer with more brands than a query takes", assignedBrands: manyBrands, wantErr: function.ErrTooManyBrands},
+		{name: "Customer with many brands filters on one", assignedBrands: manyBrands, requestedBrand: "B", want: []string{"B"}},
+		{name: "Admin sees every brand", isAdmin: true, want: nil},
+		{name: "Admin filters on any brand", isAdmin: true, requestedBrand: "Husky", want: []string{"Husky"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := function.AllowedBrands(tt.isAdmin, tt.assignedBrands, tt.requestedBrand)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("[%s] Expected brands %v, got %v", tt.name, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: 25},
+		{value: "1", want: 1},
+		{value: "100", want: 100},
+		{value: "0", wantErr: true},
+		{value: "101", wantErr: true},
+		{value: "ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := function.ParsePageSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePageSize(%q): Expected error %v, got %v", tt.value, tt.wantErr, err)
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParsePageSize(%q): Expected %d, got %d", tt.value, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SetUserRoleRequest defines the structure of the incoming JSON request
+type SetUserRoleRequest struct {
+	UID  string `json:"uid"`  // Firebase User ID (required)
+	Role string `json:"role"` // owner, admin, sales_rep, warehouse, or customer to revoke the staff role (required)
+}
+
+// Validate checks the request of the caller callerUID. The error is meant for the caller.
+func (r *SetUserRoleRequest) Validate(callerUID string) error {
+	if r.UID == "" {
+		return errors.New("UID is required")
+	}
+	if !accounts.IsValidRole(r.Role) {
+		return errors.New("role must be one of owner, admin, sales_rep, warehouse or customer")
+	}
+	if r.UID == callerUID {
+		return errors.New("You cannot change your own role")
+	}
+	return nil
+}
+
+func init() {
+	// Initialize Firebase and register the Cloud Function for production environment only
+	if os.Getenv("ENV") != "DEBUG" {
+		shared.InitFirebaseProd(nil)
+		functions.HTTP("set-user-role", SetUserRole)
+	}
+}
+
+// SetUserRole grants a role to a user, or revokes it by setting the customer role, through the user's
+// custom claims. The user's refresh tokens are revoked, so they have to sign in again and get an ID token
+// carrying the new role; functions checking roles reject their older ID tokens. Owners cannot change their
+// own role, so the portal always keeps at least one owner; the first owner has to be granted with the
+// Admin SDK.
+//
+// Authorization: Requires a valid Bearer token of a role with the manage_roles permission (owners).
+// Method: POST
+// Request Body: JSON matching the SetUserRoleRequest struct
+// Success Response: 200 OK with the user's new and previous role
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func SetUserRole(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS (OPTIONS) requests and setup CORS headers
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Only allow POST method
+	if request.Method != http.MethodPost {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method")
+		return
+	}
+
+	// Ensure that the caller's role allows managing roles
+	token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_MANAGE_ROLES)
+	if err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	var setRoleRequest SetUserRoleRequest
+	if err := json.NewDecoder(request.Body).Decode(&setRoleRequest); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate required fields
+	if err := setRoleRequest.Validate(token.UID); err != nil {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userRecord, err := shared.AuthClient.GetUser(ctx, setRoleRequest.UID)
+	if auth.IsUserNotFound(err) {
+		shared.WriteJSONError(response, http.StatusNotFound, "No user found with the given UID")
+		return
+	}
+	if err != nil {
+		log.Printf("Auth lookup error: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	previousRole := accounts.RoleFromClaims(userRecord.CustomClaims)
+	result := map[string]string{
+		"uid":           setRoleRequest.UID,
+		"role":          setRoleRequest.Role,
+		"previous_role": previousRole,
+	}
+	if previousRole == setRoleRequest.Role {
+		shared.WriteJSONSuccess(response, http.StatusOK, "The user already has this role", result)
+		return
+	}
+
+	// Only the role claims change, any other custom claim of the user is kept
+	claims := accounts.MergeRoleClaims(userRecord.CustomClaims, setRoleRequest.Role)
+	if err := shared.AuthClient.SetCustomUserClaims(ctx, setRoleRequest.UID, claims); err != nil {
+		log.Printf("Error setting claims for uid %s: %v", setRoleRequest.UID, err)
+
+		// Attempt to extract more readable Firebase error, if available
+		firebaseError := shared.ExtractFirebaseErrorFromResponse(err)
+		if firebaseError != nil {
+			shared.WriteJSONError(response, http.StatusInternalServerError, firebaseError.Error.Message)
+		} else {
+			shared.WriteJSONError(response, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// Sign the user out so their ID token cannot be refreshed with the previous role's claims
+	if err := shared.AuthClient.RevokeRefreshTokens(ctx, setRoleRequest.UID); err != nil {
+		log.Printf("Error revoking refresh tokens of uid %s: %v", setRoleRequest.UID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Role updated, but the user's sessions could not be revoked")
+		return
+	}
+
+	// Keep the role fetch-accounts filters on in sync, staff accounts are not listed as customers
+	_, err = shared.FirestoreClient.Collection("users").Doc(setRoleRequest.UID).Update(ctx, []firestore.Update{{Path: "role", Value: setRoleRequest.Role}})
+	if err != nil && status.Code(err) != codes.NotFound {
+		log.Printf("Error storing the role of uid %s: %v", setRoleRequest.UID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Role updated, but the account listing could not be updated")
+		return
+	}
+
+	log.Printf("uid %s changed the role of %s from %s to %s", token.UID, setRoleRequest.UID, previousRole, setRoleRequest.Role)
+	shared.WriteJSONSuccess(response, http.StatusOK, "Role updated successfully", result)
+}
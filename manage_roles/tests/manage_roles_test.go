@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestSetUserRoleRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request function.SetUserRoleRequest
+		wantErr bool
+	}{
+		{name: "Grant a staff role", request: function.SetUserRoleRequest{UID: "user1", Role: "sales_rep"}},
+		{name: "Grant the owner role", request: function.SetUserRoleRequest{UID: "user1", Role: "owner"}},
+		{name: "Revoke a staff role", request: function.SetUserRoleRequest{UID: "user1", Role: "customer"}},
+		{name: "Missing UID", request: function.SetUserRoleRequest{Role: "admin"}, wantErr: true},
+		{name: "Missing role", request: function.SetUserRoleRequest{UID: "user1"}, wantErr: true},
+		{name: "Unknown role", request: function.SetUserRoleRequest{UID: "user1", Role: "superuser"}, wantErr: true},
+		{name: "Own role", request: function.SetUserRoleRequest{UID: "owner1", Role: "customer"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.request.Validate("owner1"); (err != nil) != tt.wantErr {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	sendgrid "github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	twilio "github.com/twilio/twilio-go"
+	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// Credentials of the order notifications, the same secrets the send-mobile-message and send-mail
+// functions use. The notifications are sent with the function's own credentials rather than through
+// those functions, which would need the customer's token to carry permissions customers must not have.
+var (
+	TWILIO_RECIPIENTS_PHONE string
+	TWILIO_ACCOUNT_SID      string
+	TWILIO_AUTH_TOKEN       string
+	TWILIO_FROM_PHONE       string
+	SENDGRID_API_KEY        string
+	SENDGRID_FROM_MAIL      string
+)
+
+// loadNotificationSecrets loads the Twilio and SendGrid credentials. In production mode (ENV != DEBUG),
+// they are retrieved from Google Secret Manager, in debug mode from environment variables. A missing
+// secret is only logged: orders are still placed and the failed notification is recorded on the order.
+func loadNotificationSecrets(ctx context.Context) {
+	secrets := map[string]*string{
+		"TWILIO_RECIPENTS_PHONE": &TWILIO_RECIPIENTS_PHONE,
+		"TWILIO_ACCOUNT_SID":     &TWILIO_ACCOUNT_SID,
+		"TWILIO_AUTH_TOKEN":      &TWILIO_AUTH_TOKEN,
+		"TWILIO_FROM_PHONE":      &TWILIO_FROM_PHONE,
+		"SENDGRID_API_KEY":       &SENDGRID_API_KEY,
+		"SENDGRID_FROM_MAIL":     &SENDGRID_FROM_MAIL,
+	}
+
+	if os.Getenv("ENV") == "DEBUG" {
+		for name, target := range secrets {
+			*target = os.Getenv(name)
+		}
+		return
+	}
+
+	projectID, err := metadata.ProjectIDWithContext(ctx)
+	if err != nil {
+		log.Printf("Failed to retrieve project ID from metadata, order notifications are disabled: %v", err)
+		return
+	}
+	for name, target := range secrets {
+		secretPath := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, name)
+		if *target, err = shared.GetSecretFromGCP(secretPath); err != nil {
+			log.Printf("Failed to fetch %s from Secret Manager: %v", name, err)
+		}
+	}
+}
+
+// sendAdminSMS texts the new order to the staff phones through Twilio.
+func sendAdminSMS(orderID string, order *Order) error {
+	if TWILIO_RECIPIENTS_PHONE == "" || TWILIO_ACCOUNT_SID == "" || TWILIO_AUTH_TOKEN == "" || TWILIO_FROM_PHONE == "" {
+		return errors.New("Twilio configuration incomplete")
+	}
+
+	message := fmt.Sprintf("New order %s from %s (%s): %d products, total $%.2f, ship to %s, %s",
+		orderID, order.CustomerName, order.CustomerEmail, len(order.Items), order.Total,
+		order.Property["street"], order.Property["city"])
+
+	client := twilio.NewRestClientWithParams(twilio.ClientParams{
+		Username: TWILIO_ACCOUNT_SID,
+		Password: TWILIO_AUTH_TOKEN,
+	})
+
+	var failedRecipients []string
+	for _, receiverPhone := range strings.Split(TWILIO_RECIPIENTS_PHONE, ";") {
+		params := &twilioApi.CreateMessageParams{}
+		params.SetTo(receiverPhone)
+		params.SetFrom(TWILIO_FROM_PHONE)
+		params.SetBody(message)
+
+		if _, err := client.Api.CreateMessage(params); err != nil {
+			log.Printf("Error sending order %s message to %s: %v", orderID, receiverPhone, err)
+			failedRecipients = append(failedRecipients, receiverPhone)
+		}
+	}
+	if len(failedRecipients) > 0 {
+		return fmt.Errorf("message could not be sent to %v", failedRecipients)
+	}
+	return nil
+}
+
+// sendConfirmationEmail emails the order confirmation to the customer through SendGrid.
+func sendConfirmationEmail(orderID string, order *Order) error {
+	if order.CustomerEmail == "" {
+		return errors.New("the customer has no email address")
+	}
+
+	templateID := os.Getenv("ORDER_CONFIRMATION_TEMPLATE_ID")
+	if templateID == "" {
+		return errors.New("ORDER_CONFIRMATION_TEMPLATE_ID is not configured")
+	}
+	if SENDGRID_API_KEY == "" || SENDGRID_FROM_MAIL == "" {
+		return errors.New("SendGrid configuration incomplete")
+	}
+
+	p := mail.NewPersonalization()
+	p.AddTos(mail.NewEmail(order.CustomerName, order.CustomerEmail))
+	p.SetDynamicTemplateData("order_id", orderID)
+	p.SetDynamicTemplateData("name", order.CustomerName)
+	p.SetDynamicTemplateData("items", order.Items)
+	p.SetDynamicTemplateData("total", fmt.Sprintf("%.2f", order.Total))
+	p.SetDynamicTemplateData("property", order.Property)
+	p.SetDynamicTemplateData("memo", order.Memo)
+
+	message := mail.NewV3Mail()
+	message.SetFrom(mail.NewEmail("AHSChemicals", SENDGRID_FROM_MAIL))
+	message.AddPersonalizations(p)
+	message.SetTemplateID(templateID)
+
+	resp, err := sendgrid.NewSendClient(SENDGRID_API_KEY).Send(message)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SendGrid returned %d: %s", resp.StatusCode, resp.Body)
+	}
+	return nil
+}
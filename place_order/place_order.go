@@ -0,0 +1,322 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+const (
+	ORDERS_COLLECTION   = "orders"
+	USERS_COLLECTION    = "users"
+	PRODUCTS_COLLECTION = "products"
+
+	ORDER_STATUS_PENDING = "pending"
+)
+
+// PlaceOrderRequest defines the structure of the incoming JSON request
+type PlaceOrderRequest struct {
+	PropertyIndex *int        `json:"property_index"` // Index into the caller's properties to ship to (required)
+	Items         []OrderItem `json:"items"`          // Products and quantities to order (required)
+	Memo          string      `json:"memo"`           // Note from the customer (optional)
+}
+
+// OrderItem is a product and quantity requested by the customer.
+type OrderItem struct {
+	ProductID string  `json:"product_id"` // Document ID in the products collection (required)
+	Quantity  float64 `json:"quantity"`   // Quantity, must be greater than zero (required)
+}
+
+// OrderLine is an ordered product as stored on the order, priced at the time the order was placed.
+type OrderLine struct {
+	ProductID string  `firestore:"product_id" json:"product_id"`
+	Name      string  `firestore:"name" json:"name"`
+	Brand     string  `firestore:"brand" json:"brand"`
+	SKU       string  `firestore:"sku" json:"sku"`
+	Quantity  float64 `firestore:"quantity" json:"quantity"`
+	UnitPrice float64 `firestore:"unit_price" json:"unit_price"`
+}
+
+// Order is the document stored in the orders collection.
+type Order struct {
+	CustomerUID   string            `firestore:"customer_uid" json:"customer_uid"`
+	CustomerName  string            `firestore:"customer_name" json:"customer_name"`
+	CustomerEmail string            `firestore:"customer_email" json:"customer_email"`
+	PropertyIndex int               `firestore:"property_index" json:"property_index"`
+	Property      map[string]string `firestore:"property" json:"property"` // Copy of the property at the time of the order
+	Items         []OrderLine       `firestore:"items" json:"items"`
+	Total         float64           `firestore:"total" json:"total"`
+	Memo          string            `firestore:"memo" json:"memo"`
+	Status        string            `firestore:"status" json:"status"`
+	History       []StatusChange    `firestore:"history" json:"history"` // Every status the order went through
+	CreatedAt     time.Time         `firestore:"created_at" json:"created_at"`
+	UpdatedAt     time.Time         `firestore:"updated_at" json:"updated_at"`
+}
+
+// StatusChange records who moved the order to a status and when.
+type StatusChange struct {
+	From      string    `firestore:"from" json:"from"`
+	To        string    `firestore:"to" json:"to"`
+	ChangedBy string    `firestore:"changed_by" json:"changed_by"`
+	ChangedAt time.Time `firestore:"changed_at" json:"changed_at"`
+	Note      string    `firestore:"note,omitempty" json:"note,omitempty"`
+}
+
+// Product holds the products collection fields used to validate and price an order.
+type Product struct {
+	Name      string  `firestore:"name"`
+	Brand     string  `firestore:"brand"`
+	SKU       string  `firestore:"sku"`
+	UnitPrice float64 `firestore:"unit_price"`
+	Active    bool    `firestore:"active"`
+}
+
+// portalUser holds the users collection fields an order is validated against.
+type portalUser struct {
+	Brands     []string            `firestore:"brands"`
+	Properties []map[string]string `firestore:"properties"`
+}
+
+func init() {
+	// Initialize Firebase and register the Cloud Function only in production environment.
+	loadNotificationSecrets(context.Background())
+	if os.Getenv("ENV") != "DEBUG" {
+		shared.InitFirebaseProd(nil)
+		functions.HTTP("place-order", PlaceOrder)
+	}
+}
+
+// PlaceOrder validates an order against the caller's brands and properties, stores it with status
+// pending and notifies the admins by SMS and the customer by email. The notifications are sent from
+// here with the function's own Twilio and SendGrid credentials, so the client does not send them.
+//
+// Authentication: Requires a valid Firebase ID token in the Authorization header.
+// Method: POST
+// Request Body: JSON matching PlaceOrderRequest structure
+// Success Response: 200 OK with the order ID
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func PlaceOrder(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS and preflight requests
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Only allow POST method for placing orders
+	if request.Method != http.MethodPost {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method, expected POST")
+		return
+	}
+
+	// Ensure that the user is authorized, rejecting tokens revoked since they were issued
+	token, err := accounts.VerifyCaller(ctx, shared.AuthClient, request)
+	if err != nil {
+		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	// Decode the JSON request body
+	var orderRequest PlaceOrderRequest
+	if err := json.NewDecoder(request.Body).Decode(&orderRequest); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate required fields
+	if err := orderRequest.Validate(); err != nil {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Fetch the caller's brands and properties
+	userSnapshot, err := shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(token.UID).Get(ctx)
+	if userSnapshot != nil && !userSnapshot.Exists() {
+		shared.WriteJSONError(response, http.StatusForbidden, "No account data found for this user")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching document for uid %v: %v", token.UID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error fetching account data")
+		return
+	}
+	var user portalUser
+	if err := userSnapshot.DataTo(&user); err != nil {
+		log.Printf("Error reading document for uid %v: %v", token.UID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading account data")
+		return
+	}
+
+	propertyIndex := *orderRequest.PropertyIndex
+	if propertyIndex < 0 || propertyIndex >= len(user.Properties) {
+		shared.WriteJSONError(response, http.StatusBadRequest, "Selected property does not belong to this account")
+		return
+	}
+
+	// Price the order from the catalog and make sure every product belongs to the caller's brands
+	lines, err := priceOrderItems(ctx, orderRequest.Items, user.Brands)
+	if err != nil {
+		var orderError *orderValidationError
+		if errors.As(err, &orderError) {
+			shared.WriteJSONError(response, http.StatusBadRequest, orderError.Error())
+			return
+		}
+		log.Printf("Error fetching products: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error fetching products")
+		return
+	}
+
+	customerName, _ := token.Claims["name"].(string)
+	customerEmail, _ := token.Claims["email"].(string)
+
+	now := time.Now()
+	order := Order{
+		CustomerUID:   token.UID,
+		CustomerName:  customerName,
+		CustomerEmail: customerEmail,
+		PropertyIndex: propertyIndex,
+		Property:      user.Properties[propertyIndex],
+		Items:         lines,
+		Total:         OrderTotal(lines),
+		Memo:          orderRequest.Memo,
+		Status:        ORDER_STATUS_PENDING,
+		History:       []StatusChange{{To: ORDER_STATUS_PENDING, ChangedBy: token.UID, ChangedAt: now}},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	// Store the order
+	orderRef, _, err := shared.FirestoreClient.Collection(ORDERS_COLLECTION).Add(ctx, order)
+	if err != nil {
+		log.Printf("Firestore write error: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while placing the order")
+		return
+	}
+
+	// Notify the admins and the customer. A failed notification does not fail the order, the outcome
+	// is recorded on the order instead.
+	notifications := map[string]any{
+		"sms":   notificationStatus(sendAdminSMS(orderRef.ID, &order)),
+		"email": notificationStatus(sendConfirmationEmail(orderRef.ID, &order)),
+	}
+	if _, err := orderRef.Update(ctx, []firestore.Update{{Path: "notifications", Value: notifications}}); err != nil {
+		log.Printf("Error recording notifications for order %s: %v", orderRef.ID, err)
+	}
+
+	shared.WriteJSONSuccess(response, http.StatusOK, "Order placed successfully", map[string]any{
+		"order_id": orderRef.ID,
+		"total":    order.Total,
+	})
+}
+
+// Validate checks that the request names a property and at least one product, each with a positive quantity.
+func (orderRequest *PlaceOrderRequest) Validate() error {
+	if orderRequest.PropertyIndex == nil {
+		return errors.New("A property is required")
+	}
+	if len(orderRequest.Items) == 0 {
+		return errors.New("At least one product is required")
+	}
+	for _, item := range orderRequest.Items {
+		if item.ProductID == "" {
+			return errors.New("No product selected in one of the items")
+		}
+		if item.Quantity <= 0 {
+			return errors.New("Quantity must be greater than zero for every product")
+		}
+	}
+	return nil
+}
+
+// OrderTotal returns the total of the order lines, rounded to cents.
+func OrderTotal(lines []OrderLine) float64 {
+	total := 0.0
+	for _, line := range lines {
+		total += line.Quantity * line.UnitPrice
+	}
+	return math.Round(total*100) / 100
+}
+
+// orderValidationError is returned when an ordered product cannot be sold to the caller.
+type orderValidationError struct {
+	message string
+}
+
+func (err *orderValidationError) Error() string {
+	return err.message
+}
+
+// priceOrderItems loads the ordered products in one round trip and returns them as order lines.
+func priceOrderItems(ctx context.Context, items []OrderItem, brands []string) ([]OrderLine, error) {
+	productRefs := make([]*firestore.DocumentRef, 0, len(items))
+	for _, item := range items {
+		productRefs = append(productRefs, shared.FirestoreClient.Collection(PRODUCTS_COLLECTION).Doc(item.ProductID))
+	}
+
+	productSnapshots, err := shared.FirestoreClient.GetAll(ctx, productRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]OrderLine, 0, len(items))
+	for i, item := range items {
+		if !productSnapshots[i].Exists() {
+			return nil, &orderValidationError{message: fmt.Sprintf("Product %s not found", item.ProductID)}
+		}
+
+		var orderedProduct Product
+		if err := productSnapshots[i].DataTo(&orderedProduct); err != nil {
+			return nil, err
+		}
+		line, err := PriceOrderLine(item, orderedProduct, brands)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// PriceOrderLine returns the order line of an item, priced from the catalog. An error is returned when
+// the product is no longer sold or not part of the caller's brands.
+func PriceOrderLine(item OrderItem, orderedProduct Product, brands []string) (OrderLine, error) {
+	if !orderedProduct.Active {
+		return OrderLine{}, &orderValidationError{message: fmt.Sprintf("%s is no longer available", orderedProduct.Name)}
+	}
+	if !slices.Contains(brands, orderedProduct.Brand) {
+		return OrderLine{}, &orderValidationError{message: fmt.Sprintf("%s is not part of your brands", orderedProduct.Name)}
+	}
+
+	return OrderLine{
+		ProductID: item.ProductID,
+		Name:      orderedProduct.Name,
+		Brand:     orderedProduct.Brand,
+		SKU:       orderedProduct.SKU,
+		Quantity:  item.Quantity,
+		UnitPrice: orderedProduct.UnitPrice,
+	}, nil
+}
+
+// notificationStatus converts the result of a notification into the value recorded on the order.
+func notificationStatus(err error) string {
+	if err != nil {
+		log.Printf("Order notification failed: %v", err)
+		return "failed"
+	}
+	return "sent"
+}
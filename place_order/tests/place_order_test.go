@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestPlaceOrderRequestValidate(t *testing.T) {
+	propertyIndex := 0
+
+	tests := []struct {
+		name    string
+		request function.PlaceOrderRequest
+		wantErr bool
+	}{
+		{
+			name:    "Valid order",
+			request: function.PlaceOrderRequest{PropertyIndex: &propertyIndex, Items: []function.OrderItem{{ProductID: "p1", Quantity: 2}}},
+		},
+		{
+			name:    "Missing property",
+			request: function.PlaceOrderRequest{Items: []function.OrderItem{{ProductID: "p1", Quantity: 2}}},
+			wantErr: true,
+		},
+		{
+			name:    "No items",
+			request: function.PlaceOrderRequest{PropertyIndex: &propertyIndex},
+			wantErr: true,
+		},
+		{
+			name:    "Item without a product",
+			request: function.PlaceOrderRequest{PropertyIndex: &propertyIndex, Items: []function.OrderItem{{Quantity: 2}}},
+			wantErr: true,
+		},
+		{
+			name:    "Zero quantity",
+			request: function.PlaceOrderRequest{PropertyIndex: &propertyIndex, Items: []function.OrderItem{{ProductID: "p1", Quantity: 2}, {ProductID: "p2"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		if err := tt.request.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestPriceOrderLine(t *testing.T) {
+	item := function.OrderItem{ProductID: "p1", Quantity: 3}
+	brands := []string{"ProBlend"}
+
+	tests := []struct {
+		name    string
+		product function.Product
+		wantErr bool
+	}{
+		{name: "Active product of the caller's brand", product: function.Product{Name: "Glass Cleaner", Brand: "ProBlend", SKU: "PB-GC-1G", UnitPrice: 18.5, Active: true}},
+		{name: "Discontinued product", product: function.Product{Name: "Floor Finish", Brand: "ProBlend", UnitPrice: 89, Active: false}, wantErr: true},
+		{name: "Product of another brand", product: function.Product{Name: "Pool Shock", Brand: "Husky", UnitPrice: 12, Active: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		line, err := function.PriceOrderLine(item, tt.product, brands)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if err == nil && (line.ProductID != "p1" || line.Quantity != 3 || line.UnitPrice != tt.product.UnitPrice || line.SKU != tt.product.SKU) {
+			t.Errorf("[%s] Expected the line to be priced from the catalog, got %+v", tt.name, line)
+		}
+	}
+}
+
+func TestOrderTotal(t *testing.T) {
+	lines := []function.OrderLine{
+		{Quantity: 3, UnitPrice: 0.1},
+		{Quantity: 2, UnitPrice: 18.555},
+	}
+
+	if got := function.OrderTotal(lines); got != 37.41 {
+		t.Errorf("Expected the total rounded to cents, 37.41, got %v", got)
+	}
+	if got := function.OrderTotal(nil); got != 0 {
+		t.Errorf("Expected an empty order to total 0, got %v", got)
+	}
+}
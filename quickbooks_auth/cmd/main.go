@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+	"github.com/joho/godotenv"
+)
+
+func main(){
+	
+	//Only for local development
+	if os.Getenv("ENV") == "DEBUG"{
+		//Load the env file
+		err := godotenv.Load("../keys/.env")
+		if err != nil{
+			log.Printf("Error occurred loading the env file: %v", err)
+		}
+		//Register firebase 
+		shared.InitFirebaseDebug(os.Getenv("FIREBASE_CREDENTIALS_DEBUG"))
+		
+		//Register quickbooks credentials
+		if err := quickbooks.InitQuickBooks(context.Background()); err != nil{
+			log.Fatalf("Error occurred initializing QuickBooks: %v", err)
+		}
+
+		http.Handle("/quickbooks-connect", http.HandlerFunc(function.QuickBooksConnect))
+		http.Handle("/quickbooks-callback", http.HandlerFunc(function.QuickBooksCallback))
+		http.Handle("/quickbooks-disconnect", http.HandlerFunc(function.QuickBooksDisconnect))
+		http.Handle("/quickbooks-disconnected", http.HandlerFunc(function.QuickBooksDisconnected))
+			
+		log.Print("quickbooks-auth started at: 4001")
+		err = http.ListenAndServe(":4001", nil)
+		if err != nil{
+			log.Printf("Error occurred when starting the server: %v", err)
+		} 
+	}
+}
@@ -0,0 +1,317 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	QUICKBOOKS_REVOKE_URL = "https://developer.api.intuit.com/v2/oauth2/tokens/revoke"
+
+	// Firestore collection recording when the connections of each realm were last checked after a
+	// disconnect redirect, keyed by realm ID
+	QUICKBOOKS_DISCONNECT_CHECKS_COLLECTION = "quickbooks_disconnect_checks"
+
+	// Minimum time between two checks of the connections of a realm
+	disconnectCheckInterval = 5 * time.Minute
+)
+
+// QuickBooksDisconnect disconnects one of the calling admin's QuickBooks companies. The refresh token is
+// revoked at Intuit, which also invalidates its access tokens, and the stored token data and realm mapping
+// are deleted. When the disconnected company was the admin's default one, another connected company
+// becomes the default.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: POST
+// URL Parameters:
+//   - realm_id: The QuickBooks company to disconnect (optional, defaults to the admin's default company)
+//
+// Success Response: 200 OK with the disconnected realm ID and the admin's new default realm ID
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func QuickBooksDisconnect(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	uid, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	realmID, connection, err := quickbooks.ResolveQuickBooksConnection(ctx, uid, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusNotFound, "This QuickBooks company is not connected for this account")
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading QuickBooks connection for uid %s: %v", uid, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading QuickBooks connection: "+err.Error())
+		return
+	}
+
+	// Revoke the token first, so a failure leaves the connection in place to try again
+	if err := revokeStoredToken(ctx, connection.TokenKey); err != nil {
+		log.Printf("Error revoking QuickBooks token %s: %v", connection.TokenKey, err)
+		firebase_shared.WriteJSONError(response, http.StatusBadGateway, "Error revoking the QuickBooks authorization, please try again")
+		return
+	}
+
+	defaultRealmID, err := removeConnection(ctx, uid, realmID, connection.TokenKey)
+	if err != nil {
+		log.Printf("QuickBooks token %s revoked but the connection could not be removed: %v", connection.TokenKey, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "QuickBooks was disconnected but the connection could not be removed: "+err.Error())
+		return
+	}
+
+	log.Printf("QuickBooks %s company %s disconnected by uid %s", quickbooks.QuickBooks.Environment, realmID, uid)
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "QuickBooks disconnected successfully", map[string]string{
+		"realm_id":         realmID,
+		"default_realm_id": defaultRealmID,
+	})
+}
+
+// QuickBooksDisconnected is the Disconnect URL of the Intuit app. Intuit redirects the browser here after a
+// user disconnects the app from within QuickBooks, with the company's realmId. Since the redirect is not
+// authenticated, a connection is only removed once QuickBooks rejects its access token and Intuit its
+// refresh token. Only connected realms are checked, each at most once per disconnectCheckInterval, so
+// that repeated requests cannot spend the app's QuickBooks API quota.
+//
+// Method: GET
+// Query Parameters (set by Intuit):
+//   - realmId: The QuickBooks company that was disconnected (required)
+//
+// Success Response: 200 OK with the number of connections removed
+// Error Response: 429 with a Retry-After header when the realm was checked recently, otherwise appropriate
+// HTTP status codes with descriptive error messages
+func QuickBooksDisconnected(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Only allow GET, Intuit redirects the browser here
+	if request.Method != http.MethodGet {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected GET request")
+		return
+	}
+
+	realmID := request.URL.Query().Get("realmId")
+	if realmID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Missing realmId parameter")
+		return
+	}
+
+	tokenSnapshots, err := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.TokensCollection).Where("realm_id", "==", realmID).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error reading QuickBooks tokens of realm %s: %v", realmID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading QuickBooks connections")
+		return
+	}
+	if len(tokenSnapshots) == 0 {
+		firebase_shared.WriteJSONSuccess(response, http.StatusOK, "QuickBooks disconnected", map[string]any{
+			"realm_id": realmID,
+			"removed":  0,
+		})
+		return
+	}
+
+	wait, err := claimDisconnectCheck(ctx, realmID, time.Now())
+	if err != nil {
+		log.Printf("Error recording the disconnect check of realm %s: %v", realmID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading QuickBooks connections")
+		return
+	}
+	if wait > 0 {
+		response.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		firebase_shared.WriteJSONError(response, http.StatusTooManyRequests, "The connections of this QuickBooks company were checked recently, please try again later")
+		return
+	}
+
+	// Every admin who connected the company holds their own token, check each of them
+	removed := 0
+	for _, tokenSnapshot := range tokenSnapshots {
+		tokenKey := tokenSnapshot.Ref.ID
+		storedToken, _ := tokenSnapshot.Data()["access_token"].(string)
+
+		// A cheap request with the stored token, which is only refreshed if QuickBooks rejects it
+		session := quickbooks.NewStoredTokenSession(realmID, tokenKey, storedToken)
+		err := session.Do(ctx, http.MethodGet, "companyinfo/"+realmID, nil, nil)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, quickbooks.ErrQuickBooksTokenRevoked) {
+			log.Printf("Error checking QuickBooks token %s: %v", tokenKey, err)
+			continue
+		}
+
+		uid := TokenOwner(tokenSnapshot.Data(), tokenKey, realmID)
+		if _, err := removeConnection(ctx, uid, realmID, tokenKey); err != nil {
+			log.Printf("Error removing QuickBooks connection %s: %v", tokenKey, err)
+			continue
+		}
+		removed++
+	}
+
+	log.Printf("QuickBooks %s company %s disconnected from Intuit, %d connection(s) removed", quickbooks.QuickBooks.Environment, realmID, removed)
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "QuickBooks disconnected", map[string]any{
+		"realm_id": realmID,
+		"removed":  removed,
+	})
+}
+
+// claimDisconnectCheck records that the connections of realmID are checked at now, unless they were
+// checked less than disconnectCheckInterval ago, in which case the time left to wait is returned.
+func claimDisconnectCheck(ctx context.Context, realmID string, now time.Time) (time.Duration, error) {
+	checkRef := firebase_shared.FirestoreClient.Collection(QUICKBOOKS_DISCONNECT_CHECKS_COLLECTION).Doc(realmID)
+
+	var wait time.Duration
+	err := firebase_shared.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		checkSnapshot, err := tx.Get(checkRef)
+		if err != nil && (checkSnapshot == nil || checkSnapshot.Exists()) {
+			return err
+		}
+
+		lastCheckedAt := time.Time{}
+		if checkSnapshot.Exists() {
+			lastCheckedAt, _ = checkSnapshot.Data()["last_checked_at"].(time.Time)
+		}
+		if wait = DisconnectCheckWait(lastCheckedAt, now); wait > 0 {
+			return nil
+		}
+		return tx.Set(checkRef, map[string]any{"last_checked_at": now})
+	})
+	return wait, err
+}
+
+// DisconnectCheckWait returns how long to wait before the connections of a realm last checked at
+// lastCheckedAt can be checked again, zero if they can be checked at now.
+func DisconnectCheckWait(lastCheckedAt time.Time, now time.Time) time.Duration {
+	return max(lastCheckedAt.Add(disconnectCheckInterval).Sub(now), 0)
+}
+
+// revokeStoredToken revokes the refresh token of the token document at Intuit. A token that is already
+// missing or no longer valid counts as revoked.
+func revokeStoredToken(ctx context.Context, tokenKey string) error {
+	tokenSnapshot, err := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.TokensCollection).Doc(tokenKey).Get(ctx)
+	if tokenSnapshot != nil && !tokenSnapshot.Exists() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	refreshToken, _ := tokenSnapshot.Data()["refresh_token"].(string)
+	if refreshToken == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{"token": refreshToken})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, QUICKBOOKS_REVOKE_URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(quickbooks.QuickBooks.ClientID, quickbooks.QuickBooks.ClientSecret)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := quickbooks.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Intuit answers 400 for a token that was already revoked or expired
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("revoke endpoint returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// removeConnection deletes the token document and the realm from the admin's connections. If the realm was
+// the admin's default company, the most recently connected remaining company becomes the default. The new
+// default realm ID is returned, empty when the admin has no company left.
+func removeConnection(ctx context.Context, uid string, realmID string, tokenKey string) (string, error) {
+	connectionsRef := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.ConnectionsCollection).Doc(uid)
+	tokenRef := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.TokensCollection).Doc(tokenKey)
+
+	defaultRealmID := ""
+	err := firebase_shared.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		connectionsSnapshot, err := tx.Get(connectionsRef)
+		if connectionsSnapshot != nil && !connectionsSnapshot.Exists() {
+			return tx.Delete(tokenRef)
+		}
+		if err != nil {
+			return err
+		}
+
+		var connections quickbooks.QuickBooksConnections
+		if err := connectionsSnapshot.DataTo(&connections); err != nil {
+			return err
+		}
+		delete(connections.Realms, realmID)
+
+		defaultRealmID = connections.DefaultRealmID
+		if defaultRealmID == realmID {
+			defaultRealmID = LatestConnection(connections.Realms)
+		}
+
+		updates := []firestore.Update{
+			{FieldPath: firestore.FieldPath{"realms", realmID}, Value: firestore.Delete},
+			{Path: "default_realm_id", Value: defaultRealmID},
+		}
+		if err := tx.Update(connectionsRef, updates); err != nil {
+			return err
+		}
+		return tx.Delete(tokenRef)
+	})
+	return defaultRealmID, err
+}
+
+// TokenOwner returns the UID of the admin who holds the token document tokenKey of the company realmID.
+// Token documents written before the uid field was stored are keyed {uid}_{realmId}.
+func TokenOwner(tokenData map[string]any, tokenKey string, realmID string) string {
+	if uid, _ := tokenData["uid"].(string); uid != "" {
+		return uid
+	}
+	return strings.TrimSuffix(tokenKey, "_"+realmID)
+}
+
+// LatestConnection returns the realm ID of the most recently connected company, or an empty string.
+func LatestConnection(realms map[string]quickbooks.QuickBooksConnection) string {
+	latestRealmID := ""
+	var latestConnectedAt time.Time
+	for realmID, connection := range realms {
+		if latestRealmID == "" || connection.ConnectedAt.After(latestConnectedAt) {
+			latestRealmID = realmID
+			latestConnectedAt = connection.ConnectedAt
+		}
+	}
+	return latestRealmID
+}
@@ -0,0 +1,320 @@
+package function
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	QUICKBOOKS_AUTHORIZE_URL = "https://appcenter.intuit.com/connect/oauth2"
+	QUICKBOOKS_SCOPE         = "com.intuit.quickbooks.accounting"
+
+	// How long an admin has to finish the Intuit consent screen before the state expires
+	stateTTL = 10 * time.Minute
+)
+
+// Global variables holding the QuickBooks OAuth2 configuration not shared with the other QuickBooks
+// functions. The app credentials are loaded by InitQuickBooks.
+var (
+	QUICKBOOKS_REDIRECT_URI string
+	QUICKBOOKS_STATE_SECRET string
+)
+
+// oauthState is the payload signed into the OAuth2 state parameter so that the
+// callback can bind the returned authorization code to the admin who started the flow.
+type oauthState struct {
+	UID       string `json:"uid"`   // Firebase UID of the admin who started the flow
+	ExpiresAt int64  `json:"exp"`   // Unix timestamp after which the state is rejected
+	Nonce     string `json:"nonce"` // Random value so that two states are never identical
+}
+
+// init loads the QuickBooks app configuration and registers the Cloud Functions.
+// In production mode (ENV != DEBUG), it retrieves secrets from Google Secret Manager.
+// In debug mode, it falls back to environment variables for local testing.
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+
+		projectID, err := metadata.ProjectIDWithContext(ctx)
+		if err != nil {
+			log.Fatalf("Failed to retrieve project ID from metadata: %v", err)
+		}
+
+		// Intuit only redirects to the URIs registered for the environment's app
+		secrets := map[string]*string{
+			quickbooks.QuickBooks.SecretName("REDIRECT_URI"): &QUICKBOOKS_REDIRECT_URI,
+			"QUICKBOOKS_STATE_SECRET":                        &QUICKBOOKS_STATE_SECRET,
+		}
+		for name, target := range secrets {
+			secretPath := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, name)
+			*target, err = shared.GetSecretFromGCP(secretPath)
+			if err != nil {
+				log.Fatalf("Failed to fetch %s from Secret Manager: %v", name, err)
+			}
+		}
+
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-connect", QuickBooksConnect)
+		functions.HTTP("quickbooks-callback", QuickBooksCallback)
+		functions.HTTP("quickbooks-disconnect", QuickBooksDisconnect)
+		functions.HTTP("quickbooks-disconnected", QuickBooksDisconnected)
+	} else {
+		// Local development using environment variables
+		QUICKBOOKS_REDIRECT_URI = os.Getenv("QUICKBOOKS_REDIRECT_URI")
+		QUICKBOOKS_STATE_SECRET = os.Getenv("QUICKBOOKS_STATE_SECRET")
+	}
+}
+
+// QuickBooksConnect starts the QuickBooks OAuth2 flow for the calling admin. It builds
+// Intuit's authorize URL with a signed state bound to the admin's Firebase UID.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: GET
+// Success Response: 200 OK with {"auth_url": "..."}; the client navigates the browser to it
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func QuickBooksConnect(response http.ResponseWriter, request *http.Request) {
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is GET
+	if request.Method != http.MethodGet {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected GET request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	uid, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if quickbooks.QuickBooks.ClientID == "" || QUICKBOOKS_REDIRECT_URI == "" || QUICKBOOKS_STATE_SECRET == "" {
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "QuickBooks configuration incomplete")
+		return
+	}
+
+	state, err := signState(uid, time.Now().Add(stateTTL))
+	if err != nil {
+		log.Printf("Error signing OAuth state for uid %s: %v", uid, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error starting QuickBooks authorization")
+		return
+	}
+
+	query := url.Values{}
+	query.Set("client_id", quickbooks.QuickBooks.ClientID)
+	query.Set("response_type", "code")
+	query.Set("scope", QUICKBOOKS_SCOPE)
+	query.Set("redirect_uri", QUICKBOOKS_REDIRECT_URI)
+	query.Set("state", state)
+
+	authURL := fmt.Sprintf("%s?%s", QUICKBOOKS_AUTHORIZE_URL, query.Encode())
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "QuickBooks authorization URL created", map[string]string{
+		"auth_url": authURL,
+	})
+}
+
+// QuickBooksCallback is the redirect URI registered with Intuit. It verifies the signed state,
+// exchanges the authorization code for tokens and stores them, together with the realmId,
+// in Firestore under the admin's UID.
+//
+// Method: GET
+// Query Parameters (set by Intuit):
+//   - code: The authorization code (required)
+//   - state: The signed state created by QuickBooksConnect (required)
+//   - realmId: The QuickBooks company ID the admin connected (required)
+//
+// Success Response: 200 OK with the connected realm ID
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func QuickBooksCallback(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Only allow GET, Intuit redirects the browser here
+	if request.Method != http.MethodGet {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected GET request")
+		return
+	}
+
+	if quickbooks.QuickBooks.ClientID == "" || quickbooks.QuickBooks.ClientSecret == "" || QUICKBOOKS_STATE_SECRET == "" {
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "QuickBooks configuration incomplete")
+		return
+	}
+
+	query := request.URL.Query()
+
+	// Intuit reports a denied consent or any other failure through the error parameter
+	if intuitError := query.Get("error"); intuitError != "" {
+		log.Printf("QuickBooks authorization failed: %s", intuitError)
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "QuickBooks authorization failed: "+intuitError)
+		return
+	}
+
+	code := query.Get("code")
+	realmID := query.Get("realmId")
+	if code == "" || realmID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Missing code or realmId parameter")
+		return
+	}
+
+	// Verify the state and recover the admin UID it was issued for
+	uid, err := verifyState(query.Get("state"), time.Now())
+	if err != nil {
+		log.Printf("Invalid OAuth state: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid or expired authorization state. Please connect again.")
+		return
+	}
+
+	// Exchange the authorization code for an access and refresh token
+	tokenResponse, err := exchangeAuthorizationCode(ctx, code)
+	if err != nil {
+		log.Printf("Error exchanging authorization code for uid %s: %v", uid, err)
+		firebase_shared.WriteJSONError(response, http.StatusBadGateway, "Error exchanging QuickBooks authorization code")
+		return
+	}
+
+	// Store the token data keyed by the admin UID and the connected company
+	now := time.Now()
+	tokenKey := connectionKey(uid, realmID)
+	tokenData := map[string]any{
+		"access_token":             tokenResponse.AccessToken,
+		"refresh_token":            tokenResponse.RefreshToken,
+		"token_type":               tokenResponse.TokenType,
+		"expires_at":               now.Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+		"refresh_token_expires_at": now.Add(time.Duration(tokenResponse.RefreshTokenExpiresIn) * time.Second),
+		"realm_id":                 realmID,
+		"uid":                      uid,
+		"updated_at":               now,
+	}
+
+	if _, err := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.TokensCollection).Doc(tokenKey).Set(ctx, tokenData); err != nil {
+		log.Printf("Firestore write error: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error storing QuickBooks tokens")
+		return
+	}
+
+	// Register the company for the admin and make it the default one for later calls
+	connection := map[string]any{
+		"default_realm_id": realmID,
+		"realms": map[string]any{
+			realmID: map[string]any{
+				"token_key":    tokenKey,
+				"connected_at": now,
+			},
+		},
+	}
+
+	if _, err := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.ConnectionsCollection).Doc(uid).Set(ctx, connection, firestore.MergeAll); err != nil {
+		log.Printf("Firestore write error: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error storing QuickBooks connection")
+		return
+	}
+
+	log.Printf("QuickBooks %s company %s connected by uid %s", quickbooks.QuickBooks.Environment, realmID, uid)
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "QuickBooks connected successfully", map[string]string{
+		"realm_id":    realmID,
+		"environment": quickbooks.QuickBooks.Environment,
+	})
+}
+
+// connectionKey returns the token document ID for an admin's connection to a QuickBooks company.
+func connectionKey(uid, realmID string) string {
+	return uid + "_" + realmID
+}
+
+// exchangeAuthorizationCode trades the authorization code returned by Intuit for tokens.
+func exchangeAuthorizationCode(ctx context.Context, code string) (*quickbooks.TokenResponse, error) {
+	return quickbooks.RequestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {QUICKBOOKS_REDIRECT_URI},
+	})
+}
+
+// signState encodes the admin UID and an expiry into a state string signed with HMAC-SHA256.
+// The format is base64url(payload) + "." + base64url(signature).
+func signState(uid string, expiresAt time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(oauthState{
+		UID:       uid,
+		ExpiresAt: expiresAt.Unix(),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	signature := base64.RawURLEncoding.EncodeToString(stateSignature(encodedPayload))
+	return encodedPayload + "." + signature, nil
+}
+
+// verifyState checks the signature and expiry of a state created by signState and returns its UID.
+func verifyState(state string, now time.Time) (string, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(state, ".")
+	if !found {
+		return "", errors.New("malformed state")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return "", errors.New("malformed state signature")
+	}
+	if !hmac.Equal(signature, stateSignature(encodedPayload)) {
+		return "", errors.New("state signature mismatch")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", errors.New("malformed state payload")
+	}
+
+	var decoded oauthState
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return "", errors.New("malformed state payload")
+	}
+	if decoded.UID == "" {
+		return "", errors.New("state has no uid")
+	}
+	if now.Unix() > decoded.ExpiresAt {
+		return "", errors.New("state expired")
+	}
+	return decoded.UID, nil
+}
+
+// stateSignature computes the HMAC-SHA256 of the encoded state payload.
+func stateSignature(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, []byte(QUICKBOOKS_STATE_SECRET))
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+func TestLatestConnection(t *testing.T) {
+	connectedAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		realms map[string]quickbooks.QuickBooksConnection
+		want   string
+	}{
+		{name: "No company left", realms: nil, want: ""},
+		{
+			name:   "One company",
+			realms: map[string]quickbooks.QuickBooksConnection{"111": {TokenKey: "uid_111", ConnectedAt: connectedAt}},
+			want:   "111",
+		},
+		{
+			name: "Most recently connected company",
+			realms: map[string]quickbooks.QuickBooksConnection{
+				"111": {TokenKey: "uid_111", ConnectedAt: connectedAt},
+				"222": {TokenKey: "uid_222", ConnectedAt: connectedAt.AddDate(0, 1, 0)},
+				"333": {TokenKey: "uid_333", ConnectedAt: connectedAt.AddDate(0, 0, 1)},
+			},
+			want: "222",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := function.LatestConnection(tt.realms); got != tt.want {
+			t.Errorf("[%s] Expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestTokenOwner(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenData map[string]any
+		tokenKey  string
+		want      string
+	}{
+		{name: "Stored uid", tokenData: map[string]any{"uid": "admin1"}, tokenKey: "admin1_111", want: "admin1"},
+		{name: "Token written before the uid was stored", tokenData: map[string]any{}, tokenKey: "admin1_111", want: "admin1"},
+		{name: "UID containing an underscore", tokenData: map[string]any{}, tokenKey: "admin_one_111", want: "admin_one"},
+	}
+
+	for _, tt := range tests {
+		if got := function.TokenOwner(tt.tokenData, tt.tokenKey, "111"); got != tt.want {
+			t.Errorf("[%s] Expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDisconnectCheckWait(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		lastCheckedAt time.Time
+		want          time.Duration
+	}{
+		{name: "Never checked", lastCheckedAt: time.Time{}, want: 0},
+		{name: "Checked a minute ago", lastCheckedAt: now.Add(-time.Minute), want: 4 * time.Minute},
+		{name: "Checked just now", lastCheckedAt: now, want: 5 * time.Minute},
+		{name: "Checked long ago", lastCheckedAt: now.Add(-time.Hour), want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := function.DisconnectCheckWait(tt.lastCheckedAt, now); got != tt.want {
+			t.Errorf("[%s] Expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestQuickBooksCallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		method     string
+		wantStatus int
+	}{
+		{
+			name:       "Wrong HTTP method",
+			query:      "?code=abc&realmId=123&state=abc.def",
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "Authorization denied by the user",
+			query:      "?error=access_denied&state=abc.def",
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing code",
+			query:      "?realmId=123&state=abc.def",
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing realmId",
+			query:      "?code=abc&state=abc.def",
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Forged state",
+			query:      "?code=abc&realmId=123&state=eyJ1aWQiOiJhZG1pbiIsImV4cCI6OTk5OTk5OTk5OX0.Zm9yZ2Vk",
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Malformed state",
+			query:      "?code=abc&realmId=123&state=not-a-state",
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/quickbooks-callback"+tt.query, nil)
+			res := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(function.QuickBooksCallback)
+			handler.ServeHTTP(res, req)
+
+			if res.Code != tt.wantStatus {
+				t.Errorf("[%s] Expected status %v, got %v", tt.name, tt.wantStatus, res.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package function
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	AGING_CURRENT = "current" // Not yet due
+	AGING_1_30    = "1_30"    // 1 to 30 days past due
+	AGING_31_60   = "31_60"   // 31 to 60 days past due
+	AGING_61_90   = "61_90"   // 61 to 90 days past due
+	AGING_OVER_90 = "over_90" // More than 90 days past due
+
+	// Date layout of QuickBooks' TxnDate and DueDate
+	quickBooksDateLayout = "2006-01-02"
+)
+
+// Aging is an open balance split by how long it is past due.
+type Aging struct {
+	Current float64 `json:"current"`
+	Days30  float64 `json:"1_30"`
+	Days60  float64 `json:"31_60"`
+	Days90  float64 `json:"61_90"`
+	Over90  float64 `json:"over_90"`
+}
+
+// Add adds amount to the bucket.
+func (aging *Aging) Add(bucket string, amount float64) {
+	switch bucket {
+	case AGING_CURRENT:
+		aging.Current = roundCents(aging.Current + amount)
+	case AGING_1_30:
+		aging.Days30 = roundCents(aging.Days30 + amount)
+	case AGING_31_60:
+		aging.Days60 = roundCents(aging.Days60 + amount)
+	case AGING_61_90:
+		aging.Days90 = roundCents(aging.Days90 + amount)
+	default:
+		aging.Over90 = roundCents(aging.Over90 + amount)
+	}
+}
+
+// AgingBucket returns the aging bucket of an invoice due on dueDate (YYYY-MM-DD) as of now. Invoices
+// without a valid due date are treated as due on their transaction date, and as current if neither is set.
+func AgingBucket(dueDate string, txnDate string, now time.Time) string {
+	due, err := time.Parse(quickBooksDateLayout, dueDate)
+	if err != nil {
+		due, err = time.Parse(quickBooksDateLayout, txnDate)
+		if err != nil {
+			return AGING_CURRENT
+		}
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	daysPastDue := int(today.Sub(due).Hours() / 24)
+	switch {
+	case daysPastDue <= 0:
+		return AGING_CURRENT
+	case daysPastDue <= 30:
+		return AGING_1_30
+	case daysPastDue <= 60:
+		return AGING_31_60
+	case daysPastDue <= 90:
+		return AGING_61_90
+	default:
+		return AGING_OVER_90
+	}
+}
+
+// roundCents rounds an amount to two decimals so that sums of invoice balances do not drift.
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+	"github.com/joho/godotenv"
+)
+
+func main(){
+	
+	//Only for local development
+	if os.Getenv("ENV") == "DEBUG"{
+		//Load the env file
+		err := godotenv.Load("../keys/.env")
+		if err != nil{
+			log.Printf("Error occurred loading the env file: %v", err)
+		}
+		//Register firebase 
+		shared.InitFirebaseDebug(os.Getenv("FIREBASE_CREDENTIALS_DEBUG"))
+		
+		//Register quickbooks credentials
+		if err := quickbooks.InitQuickBooks(context.Background()); err != nil{
+			log.Fatalf("Error occurred initializing QuickBooks: %v", err)
+		}
+
+		http.Handle("/quickbooks-fetch-balances", http.HandlerFunc(function.FetchBalances))
+		http.Handle("/quickbooks-record-payment", http.HandlerFunc(function.RecordPayment))
+			
+		log.Print("quickbooks-balances started at: 4007")
+		err = http.ListenAndServe(":4007", nil)
+		if err != nil{
+			log.Printf("Error occurred when starting the server: %v", err)
+		} 
+	}
+}
\ No newline at end of file
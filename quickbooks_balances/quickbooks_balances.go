@@ -0,0 +1,342 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// Maximum number of results QuickBooks returns for one query
+	queryPageSize = 1000
+
+	// Number of customer IDs looked up per Customer query
+	customersPerQuery = 100
+)
+
+// OpenInvoice is an invoice with an open balance.
+type OpenInvoice struct {
+	ID        string  `json:"id"`
+	DocNumber string  `json:"doc_number"`
+	TxnDate   string  `json:"txn_date"`
+	DueDate   string  `json:"due_date"`
+	Total     float64 `json:"total"`
+	Balance   float64 `json:"balance"`
+	Aging     string  `json:"aging"` // Aging bucket of the invoice
+}
+
+// CustomerBalance is the open balance of one QuickBooks customer, linked to the portal user with the same email.
+type CustomerBalance struct {
+	UID                  string        `json:"uid,omitempty"` // Empty when no portal user has the customer's email
+	Email                string        `json:"email"`
+	DisplayName          string        `json:"displayName"`
+	QuickBooksCustomerID string        `json:"quickbooks_customer_id"`
+	OpenBalance          float64       `json:"open_balance"`
+	Aging                Aging         `json:"aging"`
+	LastPaymentDate      string        `json:"last_payment_date,omitempty"`
+	LastPaymentAmount    float64       `json:"last_payment_amount,omitempty"`
+	OpenInvoices         []OpenInvoice `json:"open_invoices"`
+}
+
+// BalancesReport is the response of FetchBalances.
+type BalancesReport struct {
+	RealmID     string            `json:"realm_id"`
+	AsOf        string            `json:"as_of"`
+	OpenBalance float64           `json:"open_balance"` // Sum over every customer
+	Aging       Aging             `json:"aging"`        // Sum over every customer
+	Customers   []CustomerBalance `json:"customers"`
+}
+
+// quickBooksInvoice holds the Invoice fields used for the balances.
+type quickBooksInvoice struct {
+	ID          string  `json:"Id"`
+	DocNumber   string  `json:"DocNumber"`
+	TxnDate     string  `json:"TxnDate"`
+	DueDate     string  `json:"DueDate"`
+	TotalAmt    float64 `json:"TotalAmt"`
+	Balance     float64 `json:"Balance"`
+	CustomerRef struct {
+		Value string `json:"value"`
+		Name  string `json:"name"`
+	} `json:"CustomerRef"`
+}
+
+// quickBooksPayment holds the Payment fields used for the last payment of each customer.
+type quickBooksPayment struct {
+	TxnDate     string  `json:"TxnDate"`
+	TotalAmt    float64 `json:"TotalAmt"`
+	CustomerRef struct {
+		Value string `json:"value"`
+	} `json:"CustomerRef"`
+}
+
+// quickBooksCustomer holds the Customer fields used to match portal users.
+type quickBooksCustomer struct {
+	ID               string `json:"Id"`
+	DisplayName      string `json:"DisplayName"`
+	PrimaryEmailAddr *struct {
+		Address string `json:"Address"`
+	} `json:"PrimaryEmailAddr"`
+}
+
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-fetch-balances", FetchBalances)
+		functions.HTTP("quickbooks-record-payment", RecordPayment)
+	}
+}
+
+// FetchBalances lists the open invoices of every QuickBooks customer with their open balance split in
+// aging buckets, and links each customer to the portal user with the same email so the admin dashboard
+// can show the balances next to the accounts returned by fetch-accounts.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: GET
+// URL Parameters:
+//   - realm_id: The QuickBooks company to report on (optional, defaults to the admin's default company)
+//   - uid: Only report the balance of this portal user (optional)
+//
+// Success Response: 200 OK with a BalancesReport
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func FetchBalances(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is GET
+	if request.Method != http.MethodGet {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected GET request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	adminUID, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Connect to the admin's QuickBooks company
+	session, err := quickbooks.OpenQuickBooksSession(ctx, adminUID, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", adminUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	report, err := buildBalancesReport(ctx, session, time.Now())
+	if err != nil {
+		log.Printf("Error building balances report: %v", err)
+		firebase_shared.WriteJSONError(response, quickbooks.QuickBooksErrorStatus(err), "Error fetching balances from QuickBooks: "+err.Error())
+		return
+	}
+
+	// Narrow the report down to a single portal user
+	if uid := request.URL.Query().Get("uid"); uid != "" {
+		customers := []CustomerBalance{}
+		report.OpenBalance = 0
+		report.Aging = Aging{}
+		for _, customer := range report.Customers {
+			if customer.UID == uid {
+				customers = append(customers, customer)
+				report.OpenBalance = roundCents(report.OpenBalance + customer.OpenBalance)
+				addAging(&report.Aging, customer.Aging)
+			}
+		}
+		report.Customers = customers
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Fetched balances successfully", report)
+}
+
+// buildBalancesReport groups the open invoices by customer and matches the customers to portal users by email.
+func buildBalancesReport(ctx context.Context, session *quickbooks.QuickBooksSession, now time.Time) (*BalancesReport, error) {
+	invoices, err := fetchOpenInvoices(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BalancesReport{RealmID: session.RealmID, AsOf: now.Format(quickBooksDateLayout), Customers: []CustomerBalance{}}
+	balances := map[string]*CustomerBalance{}
+	customerIDs := []string{}
+	for _, invoice := range invoices {
+		balance, ok := balances[invoice.CustomerRef.Value]
+		if !ok {
+			balance = &CustomerBalance{
+				QuickBooksCustomerID: invoice.CustomerRef.Value,
+				DisplayName:          invoice.CustomerRef.Name,
+				OpenInvoices:         []OpenInvoice{},
+			}
+			balances[invoice.CustomerRef.Value] = balance
+			customerIDs = append(customerIDs, invoice.CustomerRef.Value)
+		}
+
+		bucket := AgingBucket(invoice.DueDate, invoice.TxnDate, now)
+		balance.OpenInvoices = append(balance.OpenInvoices, OpenInvoice{
+			ID:        invoice.ID,
+			DocNumber: invoice.DocNumber,
+			TxnDate:   invoice.TxnDate,
+			DueDate:   invoice.DueDate,
+			Total:     invoice.TotalAmt,
+			Balance:   invoice.Balance,
+			Aging:     bucket,
+		})
+		balance.OpenBalance = roundCents(balance.OpenBalance + invoice.Balance)
+		balance.Aging.Add(bucket, invoice.Balance)
+		report.OpenBalance = roundCents(report.OpenBalance + invoice.Balance)
+		report.Aging.Add(bucket, invoice.Balance)
+	}
+
+	// Link the customers to portal users through their email
+	customers, err := fetchCustomers(ctx, session, customerIDs)
+	if err != nil {
+		return nil, err
+	}
+	users, err := portalUsersByEmail(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, customer := range customers {
+		balance := balances[customer.ID]
+		if balance == nil || customer.PrimaryEmailAddr == nil {
+			continue
+		}
+		balance.Email = customer.PrimaryEmailAddr.Address
+		balance.UID = users[strings.ToLower(balance.Email)]
+	}
+
+	// Most recent payment of each customer
+	payments, err := fetchRecentPayments(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	for _, payment := range payments {
+		balance := balances[payment.CustomerRef.Value]
+		if balance != nil && payment.TxnDate > balance.LastPaymentDate {
+			balance.LastPaymentDate = payment.TxnDate
+			balance.LastPaymentAmount = payment.TotalAmt
+		}
+	}
+
+	for _, customerID := range customerIDs {
+		report.Customers = append(report.Customers, *balances[customerID])
+	}
+	// Largest balances first
+	sort.SliceStable(report.Customers, func(i, j int) bool {
+		return report.Customers[i].OpenBalance > report.Customers[j].OpenBalance
+	})
+	return report, nil
+}
+
+// fetchOpenInvoices pages through every invoice with an open balance.
+func fetchOpenInvoices(ctx context.Context, session *quickbooks.QuickBooksSession) ([]quickBooksInvoice, error) {
+	invoices := []quickBooksInvoice{}
+	for startPosition := 1; ; startPosition += queryPageSize {
+		var page struct {
+			QueryResponse struct {
+				Invoice []quickBooksInvoice `json:"Invoice"`
+			} `json:"QueryResponse"`
+		}
+		statement := fmt.Sprintf("select * from Invoice where Balance > '0' ORDERBY DueDate STARTPOSITION %d MAXRESULTS %d", startPosition, queryPageSize)
+		if err := session.Query(ctx, statement, &page); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, page.QueryResponse.Invoice...)
+		if len(page.QueryResponse.Invoice) < queryPageSize {
+			return invoices, nil
+		}
+	}
+}
+
+// fetchCustomers looks up the customers with the given IDs.
+func fetchCustomers(ctx context.Context, session *quickbooks.QuickBooksSession, customerIDs []string) ([]quickBooksCustomer, error) {
+	customers := []quickBooksCustomer{}
+	for start := 0; start < len(customerIDs); start += customersPerQuery {
+		end := min(start+customersPerQuery, len(customerIDs))
+
+		quoted := make([]string, 0, end-start)
+		for _, customerID := range customerIDs[start:end] {
+			quoted = append(quoted, "'"+quickbooks.EscapeQueryValue(customerID)+"'")
+		}
+
+		var page struct {
+			QueryResponse struct {
+				Customer []quickBooksCustomer `json:"Customer"`
+			} `json:"QueryResponse"`
+		}
+		statement := fmt.Sprintf("select * from Customer where Id IN (%s) MAXRESULTS %d", strings.Join(quoted, ", "), customersPerQuery)
+		if err := session.Query(ctx, statement, &page); err != nil {
+			return nil, err
+		}
+		customers = append(customers, page.QueryResponse.Customer...)
+	}
+	return customers, nil
+}
+
+// fetchRecentPayments returns the latest payments received, newest first.
+func fetchRecentPayments(ctx context.Context, session *quickbooks.QuickBooksSession) ([]quickBooksPayment, error) {
+	var page struct {
+		QueryResponse struct {
+			Payment []quickBooksPayment `json:"Payment"`
+		} `json:"QueryResponse"`
+	}
+	statement := fmt.Sprintf("select * from Payment ORDERBY TxnDate DESC MAXRESULTS %d", queryPageSize)
+	if err := session.Query(ctx, statement, &page); err != nil {
+		return nil, err
+	}
+	return page.QueryResponse.Payment, nil
+}
+
+// portalUsersByEmail maps the lowercase email of every customer account to its UID. Staff accounts, whose
+// role claim is not customer, are left out.
+func portalUsersByEmail(ctx context.Context) (map[string]string, error) {
+	users := map[string]string{}
+	iter := firebase_shared.AuthClient.Users(ctx, "")
+	for {
+		userRecord, err := iter.Next()
+		if err == iterator.Done {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if accounts.RoleFromClaims(userRecord.CustomClaims) == accounts.ROLE_CUSTOMER && userRecord.Email != "" {
+			users[strings.ToLower(userRecord.Email)] = userRecord.UID
+		}
+	}
+}
+
+// addAging adds every bucket of other to aging.
+func addAging(aging *Aging, other Aging) {
+	aging.Add(AGING_CURRENT, other.Current)
+	aging.Add(AGING_1_30, other.Days30)
+	aging.Add(AGING_31_60, other.Days60)
+	aging.Add(AGING_61_90, other.Days90)
+	aging.Add(AGING_OVER_90, other.Over90)
+}
@@ -0,0 +1,221 @@
+package function
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	// Firestore collection mirroring the QuickBooks invoices, kept up to date by the quickbooks-webhook function
+	INVOICES_COLLECTION = "invoices"
+
+	// Header clients can use to make retries of the same payment safe
+	IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+	INVOICE_STATUS_OPEN           = "open"
+	INVOICE_STATUS_PARTIALLY_PAID = "partially_paid"
+	INVOICE_STATUS_PAID           = "paid"
+)
+
+// RecordPaymentRequest defines the structure of the incoming JSON request
+type RecordPaymentRequest struct {
+	InvoiceID string  `json:"invoice_id"` // QuickBooks invoice the payment is for (required)
+	Amount    float64 `json:"amount"`     // Amount received, at most the open balance of the invoice (required)
+	TxnDate   string  `json:"txn_date"`   // Date the payment was received formatted as YYYY-MM-DD (optional, defaults to today)
+	Reference string  `json:"reference"`  // Check or transfer number (optional)
+	Memo      string  `json:"memo"`       // Internal note stored on the payment (optional)
+}
+
+// quickBooksPaymentRequest is the Payment created in QuickBooks.
+type quickBooksPaymentRequest struct {
+	CustomerRef   map[string]string `json:"CustomerRef"`
+	TotalAmt      float64           `json:"TotalAmt"`
+	TxnDate       string            `json:"TxnDate,omitempty"`
+	PaymentRefNum string            `json:"PaymentRefNum,omitempty"`
+	PrivateNote   string            `json:"PrivateNote,omitempty"`
+	Line          []paymentLine     `json:"Line"`
+}
+
+// paymentLine applies part of a payment to a transaction.
+type paymentLine struct {
+	Amount    float64     `json:"Amount"`
+	LinkedTxn []linkedTxn `json:"LinkedTxn"`
+}
+
+// linkedTxn is a reference from one QuickBooks transaction to another.
+type linkedTxn struct {
+	TxnID   string `json:"TxnId"`
+	TxnType string `json:"TxnType"`
+}
+
+// RecordPayment records a payment received outside QuickBooks, such as a check, against an invoice
+// and updates the invoice's balance in the invoices collection.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: POST
+// URL Parameters:
+//   - realm_id: The QuickBooks company of the invoice (optional, defaults to the admin's default company)
+//
+// Headers:
+//   - Idempotency-Key: Key identifying the payment, retries with the same key do not record it twice (optional)
+//
+// Request Body: JSON matching RecordPaymentRequest structure
+// Success Response: 200 OK with the QuickBooks payment response
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func RecordPayment(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	adminUID, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	var paymentRequest RecordPaymentRequest
+	if err := json.NewDecoder(request.Body).Decode(&paymentRequest); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if paymentRequest.InvoiceID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "invoice_id is required")
+		return
+	}
+	if !quickbooks.IsEntityID(paymentRequest.InvoiceID) {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "invoice_id must be a QuickBooks invoice ID")
+		return
+	}
+	if paymentRequest.Amount <= 0 {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	}
+	if paymentRequest.TxnDate != "" {
+		if _, err := time.Parse(quickBooksDateLayout, paymentRequest.TxnDate); err != nil {
+			firebase_shared.WriteJSONError(response, http.StatusBadRequest, "txn_date must be formatted as YYYY-MM-DD")
+			return
+		}
+	}
+
+	// Connect to the admin's QuickBooks company
+	session, err := quickbooks.OpenQuickBooksSession(ctx, adminUID, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", adminUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	// The payment is recorded for the invoice's customer and cannot exceed what is still owed
+	var found struct {
+		Invoice quickBooksInvoice `json:"Invoice"`
+	}
+	if err := session.Do(ctx, http.MethodGet, "invoice/"+paymentRequest.InvoiceID, nil, &found); err != nil {
+		log.Printf("Error fetching invoice %s: %v", paymentRequest.InvoiceID, err)
+		firebase_shared.WriteJSONError(response, quickbooks.QuickBooksErrorStatus(err), "Error fetching the invoice: "+err.Error())
+		return
+	}
+	if found.Invoice.ID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusNotFound, "No invoice found with the given ID")
+		return
+	}
+	invoice := found.Invoice
+	if roundCents(paymentRequest.Amount) > roundCents(invoice.Balance) {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, fmt.Sprintf("Amount cannot exceed the open balance of %.2f", invoice.Balance))
+		return
+	}
+
+	payment := quickBooksPaymentRequest{
+		CustomerRef:   map[string]string{"value": invoice.CustomerRef.Value},
+		TotalAmt:      roundCents(paymentRequest.Amount),
+		TxnDate:       paymentRequest.TxnDate,
+		PaymentRefNum: paymentRequest.Reference,
+		PrivateNote:   paymentRequest.Memo,
+	}
+	payment.Line = []paymentLine{{
+		Amount:    payment.TotalAmt,
+		LinkedTxn: []linkedTxn{{TxnID: invoice.ID, TxnType: "Invoice"}},
+	}}
+
+	// Pass a requestid so QuickBooks ignores a retried payment
+	path := "payment"
+	if idempotencyKey := request.Header.Get(IDEMPOTENCY_KEY_HEADER); idempotencyKey != "" {
+		sum := sha256.Sum256([]byte(adminUID + ":" + idempotencyKey))
+		path += "?requestid=" + hex.EncodeToString(sum[:16])
+	}
+
+	var created map[string]any
+	if err := session.Do(ctx, http.MethodPost, path, payment, &created); err != nil {
+		log.Printf("Error recording payment for invoice %s: %v", invoice.ID, err)
+		quickbooks.WriteQuickBooksError(response, err, "Error recording the payment in QuickBooks")
+		return
+	}
+
+	// Update the invoice mirror right away rather than waiting for the webhook. The balance is read back from
+	// QuickBooks, as other payments may have been applied meanwhile or a retried request may have been ignored.
+	if err := storeInvoiceBalance(ctx, session, invoice.ID); err != nil {
+		log.Printf("Payment recorded but invoice %s could not be updated: %v", invoice.ID, err)
+		firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Payment recorded successfully, but the invoice could not be updated", created)
+		return
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Payment recorded successfully", created)
+}
+
+// storeInvoiceBalance reads the invoice from QuickBooks and stores its balance and status in the invoices collection.
+func storeInvoiceBalance(ctx context.Context, session *quickbooks.QuickBooksSession, invoiceID string) error {
+	var found struct {
+		Invoice quickBooksInvoice `json:"Invoice"`
+	}
+	if err := session.Do(ctx, http.MethodGet, "invoice/"+invoiceID, nil, &found); err != nil {
+		return err
+	}
+	invoice := found.Invoice
+
+	status := INVOICE_STATUS_OPEN
+	switch {
+	case invoice.Balance <= 0:
+		status = INVOICE_STATUS_PAID
+	case invoice.Balance < invoice.TotalAmt:
+		status = INVOICE_STATUS_PARTIALLY_PAID
+	}
+
+	_, err := firebase_shared.FirestoreClient.Collection(INVOICES_COLLECTION).Doc(session.RealmID+"_"+invoice.ID).Set(ctx, map[string]any{
+		"invoice_id":   invoice.ID,
+		"realm_id":     session.RealmID,
+		"doc_number":   invoice.DocNumber,
+		"customer_ref": invoice.CustomerRef.Value,
+		"total":        invoice.TotalAmt,
+		"balance":      invoice.Balance,
+		"status":       status,
+		"synced_at":    time.Now(),
+	}, firestore.MergeAll)
+	return err
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestAgingBucket(t *testing.T) {
+	now := time.Date(2025, 6, 30, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		dueDate string
+		txnDate string
+		want    string
+	}{
+		{name: "Due in the future", dueDate: "2025-07-15", want: function.AGING_CURRENT},
+		{name: "Due today", dueDate: "2025-06-30", want: function.AGING_CURRENT},
+		{name: "1 day past due", dueDate: "2025-06-29", want: function.AGING_1_30},
+		{name: "30 days past due", dueDate: "2025-05-31", want: function.AGING_1_30},
+		{name: "31 days past due", dueDate: "2025-05-30", want: function.AGING_31_60},
+		{name: "75 days past due", dueDate: "2025-04-16", want: function.AGING_61_90},
+		{name: "91 days past due", dueDate: "2025-03-31", want: function.AGING_OVER_90},
+		{name: "No due date uses the transaction date", txnDate: "2025-05-01", want: function.AGING_31_60},
+		{name: "No dates", want: function.AGING_CURRENT},
+	}
+
+	for _, tt := range tests {
+		if got := function.AgingBucket(tt.dueDate, tt.txnDate, now); got != tt.want {
+			t.Errorf("[%s] Expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAgingAdd(t *testing.T) {
+	var aging function.Aging
+	aging.Add(function.AGING_CURRENT, 10.10)
+	aging.Add(function.AGING_CURRENT, 20.20)
+	aging.Add(function.AGING_OVER_90, 5)
+
+	if aging.Current != 30.30 {
+		t.Errorf("Expected current 30.30, got %v", aging.Current)
+	}
+	if aging.Over90 != 5 || aging.Days30 != 0 {
+		t.Errorf("Expected only over_90 to be 5, got %+v", aging)
+	}
+}
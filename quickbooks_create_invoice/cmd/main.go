@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 
 	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
 	"github.com/joho/godotenv"
 )
 
@@ -23,7 +25,9 @@ func main(){
 		shared.InitFirebaseDebug(os.Getenv("FIREBASE_CREDENTIALS_DEBUG"))
 		
 		//Register quickbooks credentials
-		shared.InitQuickBooksDebug()
+		if err := quickbooks.InitQuickBooks(context.Background()); err != nil{
+			log.Fatalf("Error occurred initializing QuickBooks: %v", err)
+		}
 
 		http.Handle("/quickbooks-create-invoice", http.HandlerFunc(function.CreateInvoice))
 			
@@ -0,0 +1,186 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	// Firestore collection recording how each created invoice was emailed, keyed by {realmId}_{invoiceId}
+	INVOICE_DELIVERIES_COLLECTION = "invoice_deliveries"
+
+	// Email the invoice with QuickBooks' own invoice email
+	EMAIL_MODE_QUICKBOOKS = "quickbooks"
+
+	// Email the invoice PDF as an attachment through the send-mail function
+	EMAIL_MODE_SENDGRID = "sendgrid"
+
+	deliverySent   = "sent"
+	deliveryFailed = "failed"
+)
+
+// InvoiceDelivery is the outcome of emailing an invoice, stored in the invoice_deliveries collection
+// and returned as email_delivery in the CreateInvoice response.
+type InvoiceDelivery struct {
+	InvoiceID string    `firestore:"invoice_id" json:"invoice_id"`
+	RealmID   string    `firestore:"realm_id" json:"realm_id"`
+	OrderID   string    `firestore:"order_id,omitempty" json:"order_id,omitempty"`
+	Mode      string    `firestore:"mode" json:"mode"`
+	Recipient string    `firestore:"recipient,omitempty" json:"recipient,omitempty"`
+	Status    string    `firestore:"status" json:"status"` // sent or failed
+	Error     string    `firestore:"error,omitempty" json:"error,omitempty"`
+	SentBy    string    `firestore:"sent_by" json:"sent_by"`
+	SentAt    time.Time `firestore:"sent_at" json:"sent_at"`
+}
+
+// deliverInvoice emails the created invoice to the customer's Firebase Auth email with the requested
+// mode and records the outcome. A failed delivery does not undo the invoice, it is only reported.
+func deliverInvoice(ctx context.Context, session *quickbooks.QuickBooksSession, authorization string, uid string, mode string, invoice *QuickBooksInvoiceResponse, customerRef string, orderID string) *InvoiceDelivery {
+	delivery := &InvoiceDelivery{
+		InvoiceID: invoice.Invoice.ID,
+		RealmID:   session.RealmID,
+		OrderID:   orderID,
+		Mode:      mode,
+		SentBy:    uid,
+		SentAt:    time.Now(),
+	}
+
+	email, name, err := customerEmail(ctx, session.RealmID, customerRef)
+	if err == nil {
+		delivery.Recipient = email
+		err = SendInvoiceEmail(ctx, session, authorization, mode, invoice, email, name)
+	}
+	delivery.SetResult(err)
+
+	if _, err := firebase_shared.FirestoreClient.Collection(INVOICE_DELIVERIES_COLLECTION).Doc(session.RealmID+"_"+invoice.Invoice.ID).Set(ctx, delivery); err != nil {
+		delivery.Error = fmt.Sprintf("%s (the delivery could not be recorded: %v)", delivery.Error, err)
+	}
+	return delivery
+}
+
+// SetResult records the outcome of emailing the invoice, err being nil when the email was sent.
+func (delivery *InvoiceDelivery) SetResult(err error) {
+	delivery.Status = deliverySent
+	delivery.Error = ""
+	if err != nil {
+		delivery.Status = deliveryFailed
+		delivery.Error = err.Error()
+	}
+}
+
+// SendInvoiceEmail emails the invoice to email with the requested mode: QuickBooks' own invoice email, or
+// the invoice PDF attached to an email sent through the send-mail function.
+func SendInvoiceEmail(ctx context.Context, session *quickbooks.QuickBooksSession, authorization string, mode string, invoice *QuickBooksInvoiceResponse, email string, name string) error {
+	switch mode {
+	case EMAIL_MODE_QUICKBOOKS:
+		// QuickBooks rejects the send request unless its empty body is declared as application/octet-stream
+		path := fmt.Sprintf("invoice/%s/send?sendTo=%s", invoice.Invoice.ID, url.QueryEscape(email))
+		return session.PostEmpty(ctx, path, "application/octet-stream", nil)
+	case EMAIL_MODE_SENDGRID:
+		return sendInvoiceMail(ctx, session, authorization, invoice, email, name)
+	default:
+		return fmt.Errorf("unknown email mode %q", mode)
+	}
+}
+
+// customerEmail returns the Firebase Auth email and name of the portal user linked to the QuickBooks customer
+// of the company realmID.
+func customerEmail(ctx context.Context, realmID string, customerRef string) (string, string, error) {
+	usersCollection := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION)
+	userSnapshots, err := usersCollection.WherePath(firestore.FieldPath{quickbooks.QuickBooks.CustomerIDsField, realmID}, "==", customerRef).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Users synced before the customer IDs were kept per company
+	if len(userSnapshots) == 0 {
+		userSnapshots, err = usersCollection.Where("quickbooks_realm_id", "==", realmID).Where("quickbooks_customer_id", "==", customerRef).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if len(userSnapshots) == 0 {
+		return "", "", errors.New("no portal user is linked to the QuickBooks customer")
+	}
+
+	userRecord, err := firebase_shared.AuthClient.GetUser(ctx, userSnapshots[0].Ref.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if userRecord.Email == "" {
+		return "", "", errors.New("the customer has no email address")
+	}
+	return userRecord.Email, userRecord.DisplayName, nil
+}
+
+// sendInvoiceMail downloads the invoice PDF and sends it as an attachment through the send-mail function,
+// forwarding the admin's Authorization header.
+func sendInvoiceMail(ctx context.Context, session *quickbooks.QuickBooksSession, authorization string, invoice *QuickBooksInvoiceResponse, email string, name string) error {
+	sendMailURL := os.Getenv("SEND_MAIL_URL")
+	templateID := os.Getenv("INVOICE_EMAIL_TEMPLATE_ID")
+	if sendMailURL == "" || templateID == "" {
+		return errors.New("SEND_MAIL_URL or INVOICE_EMAIL_TEMPLATE_ID is not configured")
+	}
+
+	pdf, err := session.Download(ctx, "invoice/"+invoice.Invoice.ID+"/pdf", "application/pdf")
+	if err != nil {
+		return err
+	}
+	defer pdf.Close()
+
+	content, err := io.ReadAll(pdf)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"recipients":  map[string]string{email: name},
+		"template_id": templateID,
+		"data": map[string]any{
+			"name":           name,
+			"invoice_number": invoice.Invoice.DocNumber,
+		},
+		"attachments": []map[string]string{{
+			"content":  base64.StdEncoding.EncodeToString(content),
+			"type":     "application/pdf",
+			"filename": fmt.Sprintf("invoice-%s.pdf", invoice.Invoice.DocNumber),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendMailURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// send-mail passes SendGrid's status through, which accepts the email with 202
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("send-mail returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -3,9 +3,10 @@ module github.com/HarshMohanSason/AHSChemicalsGCFunctions
 go 1.24.2
 
 require (
-	cloud.google.com/go/compute/metadata v0.7.0
+	cloud.google.com/go/firestore v1.18.0
 	github.com/GoogleCloudPlatform/functions-framework-go v1.9.2
-	github.com/HarshMohanSason/AHSChemicalsGCShared v1.12.8
+	github.com/HarshMohanSason/AHSChemicalsGCShared v1.13.0
+	github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts v1.0.0
 	github.com/joho/godotenv v1.5.1
 )
 
@@ -14,7 +15,7 @@ require (
 	cloud.google.com/go v0.120.0 // indirect
 	cloud.google.com/go/auth v0.16.2 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.8 // indirect
-	cloud.google.com/go/firestore v1.18.0 // indirect
+	cloud.google.com/go/compute/metadata v0.7.0 // indirect
 	cloud.google.com/go/iam v1.5.2 // indirect
 	cloud.google.com/go/longrunning v0.6.7 // indirect
 	cloud.google.com/go/monitoring v1.24.2 // indirect
@@ -73,3 +74,5 @@ require (
 	google.golang.org/grpc v1.73.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 )
+
+replace github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts => ../AHSChemicalsGCShared/shared/accounts
@@ -0,0 +1,172 @@
+package function
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+)
+
+const (
+	// Firestore collection mapping idempotency keys to the QuickBooks invoice they created
+	INVOICE_REQUESTS_COLLECTION = "invoice_requests"
+
+	// Header clients can use instead of the idempotency_key body field
+	IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 255
+
+	// Length of the requestid sent to QuickBooks, which accepts at most 50 characters
+	quickBooksRequestIDLength = 32
+
+	// How long a pending request is assumed to still be running. A request pending for longer stopped
+	// before it could record its outcome and is retried.
+	invoiceRequestTimeout = 2 * time.Minute
+
+	invoiceRequestPending   = "pending"
+	invoiceRequestCompleted = "completed"
+	invoiceRequestFailed    = "failed"
+)
+
+// InvoiceRequestAction is what to do with a request, given the idempotency record of its key.
+type InvoiceRequestAction string
+
+const (
+	INVOICE_REQUEST_START  InvoiceRequestAction = "start"  // First request with the key, record it as pending
+	INVOICE_REQUEST_REPLAY InvoiceRequestAction = "replay" // Return the stored response of the completed request
+	INVOICE_REQUEST_RETRY  InvoiceRequestAction = "retry"  // The previous request failed or stopped, send it again
+)
+
+// ErrIdempotencyKeyReused is returned when a key is replayed with a different request body.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// ErrInvoiceRequestInProgress is returned when a request with the same key is still being processed.
+var ErrInvoiceRequestInProgress = errors.New("a request with the same idempotency key is in progress")
+
+// InvoiceRequestRecord is the Firestore document stored per idempotency key.
+type InvoiceRequestRecord struct {
+	UID                 string         `firestore:"uid"`                             // Admin who sent the request
+	RequestHash         string         `firestore:"request_hash"`                    // Hash of the original request
+	Status              string         `firestore:"status"`                          // pending, completed or failed
+	QuickBooksInvoiceID string         `firestore:"quickbooks_invoice_id,omitempty"` // Set once the invoice is created
+	Response            map[string]any `firestore:"response,omitempty"`              // QuickBooks response returned on replays
+	CreatedAt           time.Time      `firestore:"created_at"`
+	UpdatedAt           time.Time      `firestore:"updated_at"`
+}
+
+// quickBooksRequestID derives a stable QuickBooks requestid from the admin UID and the idempotency key,
+// so retries of the same request are also deduplicated by Intuit.
+func quickBooksRequestID(uid string, idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(uid + ":" + idempotencyKey))
+	return hex.EncodeToString(sum[:])[:quickBooksRequestIDLength]
+}
+
+// orderRequestID derives the QuickBooks requestid of the invoice of a portal order from the order ID, so
+// that an order is only invoiced once whoever requests it.
+func orderRequestID(orderID string) string {
+	sum := sha256.Sum256([]byte("order:" + orderID))
+	return hex.EncodeToString(sum[:])[:quickBooksRequestIDLength]
+}
+
+// hashRequest fingerprints the request so a reused key with a different payload can be detected.
+func hashRequest(realmID string, body []byte) string {
+	sum := sha256.Sum256(append([]byte(realmID+":"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// DecideInvoiceRequest returns what to do with a request hashed to requestHash, given record, the
+// idempotency record of its key or nil if there is none. A completed request is replayed, and a failed
+// one, or one pending for longer than invoiceRequestTimeout, is retried. ErrIdempotencyKeyReused is
+// returned for a different request with the same key, and ErrInvoiceRequestInProgress while the request
+// is pending.
+func DecideInvoiceRequest(record *InvoiceRequestRecord, requestHash string, now time.Time) (InvoiceRequestAction, error) {
+	if record == nil {
+		return INVOICE_REQUEST_START, nil
+	}
+	if record.RequestHash != requestHash {
+		return "", ErrIdempotencyKeyReused
+	}
+	switch {
+	case record.Status == invoiceRequestCompleted:
+		return INVOICE_REQUEST_REPLAY, nil
+	case record.Status == invoiceRequestPending && now.Sub(record.UpdatedAt) < invoiceRequestTimeout:
+		return "", ErrInvoiceRequestInProgress
+	default:
+		return INVOICE_REQUEST_RETRY, nil
+	}
+}
+
+// beginInvoiceRequest looks up the idempotency record for requestID. If the request already completed,
+// the stored QuickBooks response is returned and the caller should replay it. Otherwise the record is
+// marked pending and a nil response is returned, see DecideInvoiceRequest.
+func beginInvoiceRequest(ctx context.Context, requestID string, uid string, requestHash string) (map[string]any, error) {
+	docRef := firebase_shared.FirestoreClient.Collection(INVOICE_REQUESTS_COLLECTION).Doc(requestID)
+
+	var storedResponse map[string]any
+	err := firebase_shared.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		storedResponse = nil
+
+		docSnapshot, err := tx.Get(docRef)
+		if err != nil && (docSnapshot == nil || docSnapshot.Exists()) {
+			return err
+		}
+
+		var record *InvoiceRequestRecord
+		if docSnapshot.Exists() {
+			record = &InvoiceRequestRecord{}
+			if err := docSnapshot.DataTo(record); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		action, err := DecideInvoiceRequest(record, requestHash, now)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case INVOICE_REQUEST_REPLAY:
+			storedResponse = record.Response
+			return nil
+		case INVOICE_REQUEST_RETRY:
+			// QuickBooks dedupes the retried request through the requestid
+			return tx.Update(docRef, []firestore.Update{
+				{Path: "status", Value: invoiceRequestPending},
+				{Path: "updated_at", Value: now},
+			})
+		default:
+			return tx.Create(docRef, InvoiceRequestRecord{
+				UID:         uid,
+				RequestHash: requestHash,
+				Status:      invoiceRequestPending,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			})
+		}
+	})
+	return storedResponse, err
+}
+
+// completeInvoiceRequest stores the created invoice so replays of the key return the same result.
+func completeInvoiceRequest(ctx context.Context, requestID string, invoiceID string, invoiceResponse map[string]any) error {
+	_, err := firebase_shared.FirestoreClient.Collection(INVOICE_REQUESTS_COLLECTION).Doc(requestID).Update(ctx, []firestore.Update{
+		{Path: "status", Value: invoiceRequestCompleted},
+		{Path: "quickbooks_invoice_id", Value: invoiceID},
+		{Path: "response", Value: invoiceResponse},
+		{Path: "updated_at", Value: time.Now()},
+	})
+	return err
+}
+
+// failInvoiceRequest marks the request as failed so that a retry with the same key is attempted again.
+func failInvoiceRequest(ctx context.Context, requestID string) error {
+	_, err := firebase_shared.FirestoreClient.Collection(INVOICE_REQUESTS_COLLECTION).Doc(requestID).Update(ctx, []firestore.Update{
+		{Path: "status", Value: invoiceRequestFailed},
+		{Path: "updated_at", Value: time.Now()},
+	})
+	return err
+}
@@ -0,0 +1,208 @@
+package function
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum length QuickBooks accepts for CustomerMemo
+	maxMemoLength = 1000
+
+	// Date layout QuickBooks expects for DueDate
+	dueDateLayout = "2006-01-02"
+)
+
+// InvoiceRequest is the JSON body accepted by CreateInvoice.
+// When OrderID is set, the invoice fields except EmailMode are ignored and the invoice is assembled from the order.
+type InvoiceRequest struct {
+	OrderID        string            `json:"order_id"`        // Approved portal order to build the invoice from (optional)
+	CustomerRef    string            `json:"customer_ref"`    // QuickBooks customer ID (required)
+	Lines          []InvoiceLine     `json:"lines"`           // Line items of the invoice (required)
+	ShipTo         map[string]string `json:"ship_to"`         // Property with fields: street, city, county, state, postal (required)
+	DueDate        string            `json:"due_date"`        // Due date formatted as YYYY-MM-DD (optional)
+	Memo           string            `json:"memo"`            // Message shown to the customer on the invoice (optional)
+	EmailMode      string            `json:"email_mode"`      // Email the invoice after creation: "quickbooks" or "sendgrid" (optional)
+	IdempotencyKey string            `json:"idempotency_key"` // Same as the Idempotency-Key header (optional)
+}
+
+// InvoiceLine is a single line item of an InvoiceRequest.
+type InvoiceLine struct {
+	ItemRef     string  `json:"item_ref"`    // QuickBooks item ID (required)
+	Description string  `json:"description"` // Line description (optional)
+	Quantity    float64 `json:"quantity"`    // Quantity, must be greater than zero (required)
+	UnitPrice   float64 `json:"unit_price"`  // Price per unit, cannot be negative (required)
+	TaxCode     string  `json:"tax_code"`    // "TAX" or "NON" (optional)
+}
+
+// FieldError describes a validation failure of a single request field.
+type FieldError struct {
+	Field   string `json:"field"`   // Path of the field, e.g. lines[0].quantity
+	Message string `json:"message"` // Human readable reason
+}
+
+// ValidationErrors is the list of field errors found in a request.
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, fieldError := range errs {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the invoice request and returns every field error found, or nil if it is valid.
+func (invoice *InvoiceRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, message string) {
+		errs = append(errs, FieldError{Field: field, Message: message})
+	}
+
+	if strings.TrimSpace(invoice.CustomerRef) == "" {
+		add("customer_ref", "Customer is required")
+	}
+
+	if len(invoice.Lines) == 0 {
+		add("lines", "At least one line item is required")
+	}
+	for i, line := range invoice.Lines {
+		prefix := fmt.Sprintf("lines[%d]", i)
+		if strings.TrimSpace(line.ItemRef) == "" {
+			add(prefix+".item_ref", "Item is required")
+		}
+		if line.Quantity <= 0 {
+			add(prefix+".quantity", "Quantity must be greater than zero")
+		}
+		if line.UnitPrice < 0 {
+			add(prefix+".unit_price", "Unit price cannot be negative")
+		}
+		if line.TaxCode != "" && line.TaxCode != "TAX" && line.TaxCode != "NON" {
+			add(prefix+".tax_code", "Tax code must be TAX or NON")
+		}
+	}
+
+	if len(invoice.ShipTo) == 0 {
+		add("ship_to", "Ship-to property is required")
+	} else {
+		for _, key := range []string{"street", "city", "county", "state", "postal"} {
+			if strings.TrimSpace(invoice.ShipTo[key]) == "" {
+				add("ship_to."+key, fmt.Sprintf("No %s found in the ship-to property", key))
+			}
+		}
+	}
+
+	if invoice.DueDate != "" {
+		if _, err := time.Parse(dueDateLayout, invoice.DueDate); err != nil {
+			add("due_date", "Due date must be formatted as YYYY-MM-DD")
+		}
+	}
+
+	if len(invoice.Memo) > maxMemoLength {
+		add("memo", fmt.Sprintf("Memo cannot be longer than %d characters", maxMemoLength))
+	}
+
+	if invoice.EmailMode != "" && invoice.EmailMode != EMAIL_MODE_QUICKBOOKS && invoice.EmailMode != EMAIL_MODE_SENDGRID {
+		add("email_mode", fmt.Sprintf("Email mode must be %q or %q", EMAIL_MODE_QUICKBOOKS, EMAIL_MODE_SENDGRID))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// QuickBooksRef is a reference to another QuickBooks entity.
+type QuickBooksRef struct {
+	Value string `json:"value"`
+}
+
+// QuickBooksAddress is a QuickBooks PhysicalAddress.
+type QuickBooksAddress struct {
+	Line1                  string `json:"Line1,omitempty"`
+	City                   string `json:"City,omitempty"`
+	CountrySubDivisionCode string `json:"CountrySubDivisionCode,omitempty"`
+	PostalCode             string `json:"PostalCode,omitempty"`
+}
+
+// QuickBooksSalesItemLineDetail holds the item specific fields of a sales line.
+type QuickBooksSalesItemLineDetail struct {
+	ItemRef    QuickBooksRef  `json:"ItemRef"`
+	Qty        float64        `json:"Qty"`
+	UnitPrice  float64        `json:"UnitPrice"`
+	TaxCodeRef *QuickBooksRef `json:"TaxCodeRef,omitempty"`
+}
+
+// QuickBooksLine is a line of a QuickBooks v3 Invoice.
+type QuickBooksLine struct {
+	DetailType          string                        `json:"DetailType"`
+	Amount              float64                       `json:"Amount"`
+	Description         string                        `json:"Description,omitempty"`
+	SalesItemLineDetail QuickBooksSalesItemLineDetail `json:"SalesItemLineDetail"`
+}
+
+// QuickBooksInvoiceResponse holds the fields of the invoice endpoint response this function uses.
+type QuickBooksInvoiceResponse struct {
+	Invoice struct {
+		ID        string `json:"Id"`
+		DocNumber string `json:"DocNumber"`
+	} `json:"Invoice"`
+}
+
+// QuickBooksInvoice is the QuickBooks v3 Invoice JSON sent to the invoice endpoint.
+type QuickBooksInvoice struct {
+	CustomerRef  QuickBooksRef      `json:"CustomerRef"`
+	Line         []QuickBooksLine   `json:"Line"`
+	ShipAddr     *QuickBooksAddress `json:"ShipAddr,omitempty"`
+	DueDate      string             `json:"DueDate,omitempty"`
+	CustomerMemo *QuickBooksRef     `json:"CustomerMemo,omitempty"`
+}
+
+// ToQuickBooksInvoice translates a validated request into the QuickBooks v3 Invoice JSON.
+func (invoice *InvoiceRequest) ToQuickBooksInvoice() *QuickBooksInvoice {
+	quickBooksInvoice := &QuickBooksInvoice{
+		CustomerRef: QuickBooksRef{Value: invoice.CustomerRef},
+		Line:        make([]QuickBooksLine, 0, len(invoice.Lines)),
+		ShipAddr:    propertyToAddress(invoice.ShipTo),
+		DueDate:     invoice.DueDate,
+	}
+
+	for _, line := range invoice.Lines {
+		detail := QuickBooksSalesItemLineDetail{
+			ItemRef:   QuickBooksRef{Value: line.ItemRef},
+			Qty:       line.Quantity,
+			UnitPrice: line.UnitPrice,
+		}
+		if line.TaxCode != "" {
+			detail.TaxCodeRef = &QuickBooksRef{Value: line.TaxCode}
+		}
+
+		quickBooksInvoice.Line = append(quickBooksInvoice.Line, QuickBooksLine{
+			DetailType:          "SalesItemLineDetail",
+			Amount:              math.Round(line.Quantity*line.UnitPrice*100) / 100,
+			Description:         line.Description,
+			SalesItemLineDetail: detail,
+		})
+	}
+
+	if invoice.Memo != "" {
+		quickBooksInvoice.CustomerMemo = &QuickBooksRef{Value: invoice.Memo}
+	}
+	return quickBooksInvoice
+}
+
+// propertyToAddress maps a portal property (street, city, county, state, postal) to a QuickBooks address.
+// QuickBooks addresses have no county field, so the county is not sent.
+func propertyToAddress(property map[string]string) *QuickBooksAddress {
+	if len(property) == 0 {
+		return nil
+	}
+	return &QuickBooksAddress{
+		Line1:                  property["street"],
+		City:                   property["city"],
+		CountrySubDivisionCode: property["state"],
+		PostalCode:             property["postal"],
+	}
+}
@@ -0,0 +1,165 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	ORDERS_COLLECTION = "orders"
+	USERS_COLLECTION  = "users"
+
+	// Only approved orders can be invoiced, which moves them to invoiced, see the update-order-status function
+	ORDER_STATUS_APPROVED = "approved"
+	ORDER_STATUS_INVOICED = "invoiced"
+)
+
+var (
+	// ErrOrderNotFound is returned when the requested order does not exist.
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrOrderAlreadyInvoiced is returned when a QuickBooks invoice was already created for the order.
+	ErrOrderAlreadyInvoiced = errors.New("order has already been invoiced")
+
+	// ErrOrderNotApproved is returned when the order has not been approved by an admin yet.
+	ErrOrderNotApproved = errors.New("order has not been approved")
+)
+
+// Order is an order placed in the portal, stored in the orders collection by the place-order function.
+type Order struct {
+	CustomerUID         string            `firestore:"customer_uid"`                    // UID of the customer the order is for
+	Property            map[string]string `firestore:"property"`                        // Copy of the property to ship to at the time of the order
+	Items               []OrderLine       `firestore:"items"`                           // Products, quantities and prices ordered
+	Status              string            `firestore:"status"`                          // Lifecycle status of the order
+	DueDate             string            `firestore:"due_date,omitempty"`              // Invoice due date formatted as YYYY-MM-DD
+	Memo                string            `firestore:"memo,omitempty"`                  // Message shown to the customer on the invoice
+	QuickBooksInvoiceID string            `firestore:"quickbooks_invoice_id,omitempty"` // Set once the order has been invoiced
+}
+
+// OrderLine is a product of an Order, priced when the order was placed.
+type OrderLine struct {
+	ProductID string  `firestore:"product_id"` // Document ID in the products collection
+	Name      string  `firestore:"name"`
+	Quantity  float64 `firestore:"quantity"`
+	UnitPrice float64 `firestore:"unit_price"`
+}
+
+// buildInvoiceFromOrder loads the order and assembles the invoice request for the QuickBooks company
+// realmID. The invoice bills the lines and prices the customer ordered and ships to the property the
+// order was placed for, whatever the catalog or the customer's properties say today; only the customer's
+// QuickBooks customer ID is read from their users document. ValidationErrors is returned when the order
+// is incomplete, or the customer or products are not synced to the company.
+func buildInvoiceFromOrder(ctx context.Context, orderID string, realmID string) (*InvoiceRequest, error) {
+	orderSnapshot, err := firebase_shared.FirestoreClient.Collection(ORDERS_COLLECTION).Doc(orderID).Get(ctx)
+	if orderSnapshot != nil && !orderSnapshot.Exists() {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var order Order
+	if err := orderSnapshot.DataTo(&order); err != nil {
+		return nil, err
+	}
+	if order.QuickBooksInvoiceID != "" {
+		return nil, ErrOrderAlreadyInvoiced
+	}
+	if order.Status != ORDER_STATUS_APPROVED {
+		return nil, ErrOrderNotApproved
+	}
+	if order.CustomerUID == "" {
+		return nil, ValidationErrors{{Field: "customer_uid", Message: "Order has no customer"}}
+	}
+
+	userSnapshot, err := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(order.CustomerUID).Get(ctx)
+	if userSnapshot != nil && !userSnapshot.Exists() {
+		return nil, ValidationErrors{{Field: "customer_uid", Message: "No user found with the given UID"}}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var errs ValidationErrors
+	customerID := quickbooks.CustomerIDs(userSnapshot.Data())[realmID]
+	if customerID == "" {
+		errs = append(errs, FieldError{Field: "customer_uid", Message: "Customer is not linked to a customer of this QuickBooks company"})
+	}
+	if len(order.Property) == 0 {
+		errs = append(errs, FieldError{Field: "property", Message: "Order has no property to ship to"})
+	}
+	if len(order.Items) == 0 {
+		errs = append(errs, FieldError{Field: "items", Message: "At least one product is required"})
+	}
+
+	invoice := &InvoiceRequest{
+		CustomerRef: customerID,
+		ShipTo:      order.Property,
+		DueDate:     order.DueDate,
+		Memo:        order.Memo,
+	}
+
+	for i, line := range order.Items {
+		// Products are named after the QuickBooks item of the company they were imported from
+		itemID, found := quickbooks.ItemID(realmID, line.ProductID)
+		if !found {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("items[%d].product_id", i), Message: fmt.Sprintf("%s is not a product of this QuickBooks company", line.Name)})
+			continue
+		}
+
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			ItemRef:     itemID,
+			Description: line.Name,
+			Quantity:    line.Quantity,
+			UnitPrice:   line.UnitPrice,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return invoice, nil
+}
+
+// markOrderInvoiced writes the created QuickBooks invoice back onto the order and moves an approved order
+// to invoiced on behalf of uid, so that it can no longer be cancelled, see the update-order-status
+// function. The order is read in the transaction, an order cancelled in the meantime keeps its status.
+func markOrderInvoiced(ctx context.Context, orderID string, realmID string, uid string, invoice *QuickBooksInvoiceResponse) error {
+	orderRef := firebase_shared.FirestoreClient.Collection(ORDERS_COLLECTION).Doc(orderID)
+	return firebase_shared.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		orderSnapshot, err := tx.Get(orderRef)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		updates := []firestore.Update{
+			{Path: "quickbooks_invoice_id", Value: invoice.Invoice.ID},
+			{Path: "quickbooks_doc_number", Value: invoice.Invoice.DocNumber},
+			{Path: "quickbooks_realm_id", Value: realmID},
+			{Path: "invoiced_at", Value: now},
+		}
+		if status, _ := orderSnapshot.Data()["status"].(string); status == ORDER_STATUS_APPROVED {
+			// Same fields as the history entries of update-order-status
+			change := map[string]any{
+				"from":       ORDER_STATUS_APPROVED,
+				"to":         ORDER_STATUS_INVOICED,
+				"changed_by": uid,
+				"changed_at": now,
+				"note":       "QuickBooks invoice " + invoice.Invoice.DocNumber,
+			}
+			updates = append(updates,
+				firestore.Update{Path: "status", Value: ORDER_STATUS_INVOICED},
+				firestore.Update{Path: "updated_at", Value: now},
+				firestore.Update{Path: "history", Value: firestore.ArrayUnion(change)},
+			)
+		}
+		return tx.Update(orderRef, updates)
+	})
+}
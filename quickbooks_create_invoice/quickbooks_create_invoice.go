@@ -1,33 +1,50 @@
 package function
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
-	"time"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
-	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
 	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
-	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/utils"
 )
 
 func init() {
 	if os.Getenv("ENV") != "DEBUG" {
 		ctx := context.Background()
-		quickbooks.InitQuickBooksProd(ctx)
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
 		firebase_shared.InitFirebaseProd(nil)
 
 		functions.HTTP("quickbooks-create-invoice", CreateInvoice)
 	}
 }
 
+// CreateInvoice creates an invoice in the admin's connected QuickBooks company.
+//
+// Authorization: Requires a valid Bearer token of a role with the create_invoice permission.
+// Method: POST
+// URL Parameters:
+//   - realm_id: The QuickBooks company to create the invoice in (optional, defaults to the admin's default company)
+//
+// Headers:
+//   - Idempotency-Key: Key identifying the request, retries with the same key return the first result
+//     (optional, ignored for an order, which is always keyed on its ID)
+//
+// Request Body: JSON matching the InvoiceRequest struct, or {"order_id": "..."} to build the invoice
+// from an approved portal order and write the QuickBooks invoice ID back onto it
+// Success Response: 200 OK with the QuickBooks invoice response, plus email_delivery when email_mode is set
+// Error Response: 400 with field-level errors for an invalid invoice, otherwise appropriate HTTP status
+// codes with descriptive error messages
 func CreateInvoice(response http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 
@@ -42,72 +59,186 @@ func CreateInvoice(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Authenticate Firebase admin user
-	uid, err := firebase_shared.GetUIDIfAdmin(request)
+	// Ensure that the caller's role allows creating invoices
+	token, err := accounts.AuthorizeCaller(ctx, firebase_shared.AuthClient, request, accounts.PERMISSION_CREATE_INVOICE)
 	if err != nil {
-		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		firebase_shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
 		return
 	}
+	uid := token.UID
 
-	// Get valid QuickBooks access token
-	tokenData, err := quickbooks.EnsureValidAccessToken(ctx, uid)
+	// Decode and validate the invoice request before contacting QuickBooks
+	defer request.Body.Close()
+	requestBody, err := io.ReadAll(request.Body)
 	if err != nil {
-		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Error reading request body: "+err.Error())
 		return
 	}
 
-	// Read and parse the request body
-	defer request.Body.Close()
-	body, err := io.ReadAll(request.Body)
-	if err != nil {
-		firebase_shared..WriteJSONError(response, http.StatusBadRequest, "Error reading request body: "+err.Error())
+	var invoiceRequest InvoiceRequest
+	if err := json.Unmarshal(requestBody, &invoiceRequest); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	var invoicePayload map[string]any
-	if err := json.Unmarshal(body, &invoicePayload); err != nil {
-		firebase_shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+	// Replay the stored result if this idempotency key already created an invoice
+	idempotencyKey := request.Header.Get(IDEMPOTENCY_KEY_HEADER)
+	if idempotencyKey == "" {
+		idempotencyKey = invoiceRequest.IdempotencyKey
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, fmt.Sprintf("Idempotency key cannot be longer than %d characters", maxIdempotencyKeyLength))
 		return
 	}
 
-	// Build the QuickBooks API request
-	apiURL := fmt.Sprintf("%s/v3/company/%s/invoice", quickbooks.QUICKBOOKS_API_URL, realmID)
+	// An order is always keyed on its ID, whoever invoices it and whatever key they send, so that concurrent
+	// requests for the same order share one idempotency record and one QuickBooks requestid
+	requestID := ""
+	requestHash := hashRequest(request.URL.Query().Get("realm_id"), requestBody)
+	if invoiceRequest.OrderID != "" {
+		requestID = orderRequestID(invoiceRequest.OrderID)
+		requestHash = hashRequest(request.URL.Query().Get("realm_id"), []byte(invoiceRequest.OrderID))
+	} else if idempotencyKey != "" {
+		requestID = quickBooksRequestID(uid, idempotencyKey)
+	}
+	if requestID != "" {
+		storedResponse, err := beginInvoiceRequest(ctx, requestID, uid, requestHash)
+		if errors.Is(err, ErrIdempotencyKeyReused) {
+			firebase_shared.WriteJSONError(response, http.StatusUnprocessableEntity, "Idempotency key was already used for a different invoice")
+			return
+		}
+		if errors.Is(err, ErrInvoiceRequestInProgress) {
+			firebase_shared.WriteJSONError(response, http.StatusConflict, "This invoice is already being created, retry shortly")
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading idempotency record %s: %v", requestID, err)
+			firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading idempotency record: "+err.Error())
+			return
+		}
+		if storedResponse != nil {
+			firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Invoice created successfully", storedResponse)
+			return
+		}
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(body))
+	// Release the idempotency key for a retry if the invoice is not created
+	invoiceCreated := false
+	defer func() {
+		if requestID != "" && !invoiceCreated {
+			if err := failInvoiceRequest(context.WithoutCancel(ctx), requestID); err != nil {
+				log.Printf("Error marking idempotency record %s as failed: %v", requestID, err)
+			}
+		}
+	}()
+
+	// Resolve which QuickBooks company the invoice goes to. Orders are invoiced with the customer and
+	// products synced to that company.
+	realmID, connection, err := quickbooks.ResolveQuickBooksConnection(ctx, uid, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account. Please connect QuickBooks first.")
+		return
+	}
 	if err != nil {
-		shared.WriteJSONError(response, http.StatusInternalServerError, "Error creating QuickBooks request: "+err.Error())
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading QuickBooks connection: "+err.Error())
 		return
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tokenData["access_token"].(string)))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
 
-	// Execute the API request
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		shared.WriteJSONError(response, http.StatusInternalServerError, "Error sending request to QuickBooks API: "+err.Error())
+	// Assemble the invoice server-side when it is built from a portal order
+	orderID := invoiceRequest.OrderID
+	if orderID != "" {
+		orderInvoice, err := buildInvoiceFromOrder(ctx, orderID, realmID)
+		var validationErrors ValidationErrors
+		switch {
+		case errors.Is(err, ErrOrderNotFound):
+			firebase_shared.WriteJSONError(response, http.StatusNotFound, "No order found with the given ID")
+			return
+		case errors.Is(err, ErrOrderAlreadyInvoiced):
+			firebase_shared.WriteJSONError(response, http.StatusConflict, "This order has already been invoiced")
+			return
+		case errors.Is(err, ErrOrderNotApproved):
+			firebase_shared.WriteJSONError(response, http.StatusConflict, "Only approved orders can be invoiced")
+			return
+		case errors.As(err, &validationErrors):
+			writeValidationErrors(response, validationErrors)
+			return
+		case err != nil:
+			log.Printf("Error building invoice from order %s: %v", orderID, err)
+			firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the order: "+err.Error())
+			return
+		}
+		orderInvoice.EmailMode = invoiceRequest.EmailMode
+		invoiceRequest = *orderInvoice
+	}
+
+	if errs := invoiceRequest.Validate(); errs != nil {
+		writeValidationErrors(response, errs)
 		return
 	}
-	defer resp.Body.Close()
 
-	// Read and parse QuickBooks response
-	respBody, err := io.ReadAll(resp.Body)
+	// Get valid QuickBooks access token for the connected company
+	session, err := quickbooks.NewQuickBooksSession(ctx, realmID, connection.TokenKey)
 	if err != nil {
-		shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading QuickBooks response: "+err.Error())
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
 		return
 	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		shared.WriteJSONError(response, resp.StatusCode, fmt.Sprintf("QuickBooks API Error: %s", string(respBody)))
+	// Create the invoice, passing the requestid so Intuit dedupes retries as well
+	path := "invoice"
+	if requestID != "" {
+		path += "?requestid=" + requestID
+	}
+
+	var respBody json.RawMessage
+	if err := session.Do(ctx, http.MethodPost, path, invoiceRequest.ToQuickBooksInvoice(), &respBody); err != nil {
+		log.Printf("Error creating invoice for uid %s: %v", uid, err)
+		quickbooks.WriteQuickBooksError(response, err, "Error creating the QuickBooks invoice")
 		return
 	}
 
 	var invoiceResponse map[string]any
 	if err := json.Unmarshal(respBody, &invoiceResponse); err != nil {
-		shared.WriteJSONError(response, http.StatusInternalServerError, "Error parsing QuickBooks response JSON: "+err.Error())
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error parsing QuickBooks response JSON: "+err.Error())
+		return
+	}
+	var createdInvoice QuickBooksInvoiceResponse
+	if err := json.Unmarshal(respBody, &createdInvoice); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error parsing QuickBooks response JSON: "+err.Error())
 		return
 	}
+	invoiceCreated = true
+
+	// Email the invoice to the customer when requested
+	if invoiceRequest.EmailMode != "" {
+		invoiceResponse["email_delivery"] = deliverInvoice(ctx, session, request.Header.Get("Authorization"), uid, invoiceRequest.EmailMode, &createdInvoice, invoiceRequest.CustomerRef, orderID)
+	}
+
+	// Record the result so that replays of the idempotency key return this invoice
+	if requestID != "" {
+		if err := completeInvoiceRequest(ctx, requestID, createdInvoice.Invoice.ID, invoiceResponse); err != nil {
+			log.Printf("Error storing idempotency record %s: %v", requestID, err)
+		}
+	}
+
+	// Link the created invoice to the order it was built from
+	if orderID != "" {
+		if err := markOrderInvoiced(ctx, orderID, realmID, uid, &createdInvoice); err != nil {
+			log.Printf("Invoice created but order %s could not be updated: %v", orderID, err)
+			firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Invoice created successfully, but the order could not be updated", invoiceResponse)
+			return
+		}
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Invoice created successfully", invoiceResponse)
+}
 
-	shared.WriteJSONSuccess(response, http.StatusOK, "Invoice created successfully", invoiceResponse)
+// writeValidationErrors responds with 400 Bad Request and the list of field errors so the
+// frontend can show each message next to the offending field.
+func writeValidationErrors(response http.ResponseWriter, errs ValidationErrors) {
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(response).Encode(map[string]any{
+		"error":  "Invalid invoice",
+		"fields": errs,
+	})
 }
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+// deliveryServers starts a QuickBooks API serving the invoice PDF and a send-mail function answering
+// with sendMailStatus, and returns the requests each of them received.
+func deliveryServers(t *testing.T, sendMailStatus int) (*quickbooks.QuickBooksSession, *[]*http.Request, *[]map[string]any) {
+	quickBooksRequests := []*http.Request{}
+	quickBooksServer := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		quickBooksRequests = append(quickBooksRequests, request)
+		if request.URL.Path == "/v3/company/123/invoice/130/pdf" {
+			response.Write([]byte("%PDF-1.4"))
+			return
+		}
+		response.Write([]byte(`{"Invoice":{"Id":"130"}}`))
+	}))
+	t.Cleanup(quickBooksServer.Close)
+
+	sendMailBodies := []map[string]any{}
+	sendMailServer := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var body map[string]any
+		json.NewDecoder(request.Body).Decode(&body)
+		sendMailBodies = append(sendMailBodies, body)
+		response.WriteHeader(sendMailStatus)
+	}))
+	t.Cleanup(sendMailServer.Close)
+
+	previous := quickbooks.QuickBooks
+	quickbooks.QuickBooks = &quickbooks.QuickBooksConfig{APIURL: quickBooksServer.URL}
+	t.Cleanup(func() { quickbooks.QuickBooks = previous })
+	t.Setenv("SEND_MAIL_URL", sendMailServer.URL)
+	t.Setenv("INVOICE_EMAIL_TEMPLATE_ID", "d-invoice")
+
+	session := &quickbooks.QuickBooksSession{RealmID: "123", AccessToken: "access-token"}
+	return session, &quickBooksRequests, &sendMailBodies
+}
+
+func createdInvoice() *function.QuickBooksInvoiceResponse {
+	invoice := &function.QuickBooksInvoiceResponse{}
+	invoice.Invoice.ID = "130"
+	invoice.Invoice.DocNumber = "1037"
+	return invoice
+}
+
+func TestSendInvoiceEmailWithQuickBooks(t *testing.T) {
+	session, quickBooksRequests, sendMailBodies := deliveryServers(t, http.StatusAccepted)
+
+	err := function.SendInvoiceEmail(context.Background(), session, "Bearer token", function.EMAIL_MODE_QUICKBOOKS, createdInvoice(), "carol@example.com", "Carol")
+	if err != nil {
+		t.Fatalf("Expected the invoice to be sent, got %v", err)
+	}
+	if len(*quickBooksRequests) != 1 || len(*sendMailBodies) != 0 {
+		t.Fatalf("Expected one QuickBooks request and no email, got %d and %d", len(*quickBooksRequests), len(*sendMailBodies))
+	}
+
+	request := (*quickBooksRequests)[0]
+	if request.Method != http.MethodPost || request.URL.Path != "/v3/company/123/invoice/130/send" {
+		t.Errorf("Expected a POST to the invoice send endpoint, got %s %s", request.Method, request.URL.Path)
+	}
+	if sendTo := request.URL.Query().Get("sendTo"); sendTo != "carol@example.com" {
+		t.Errorf("Expected the invoice to be sent to the customer, got %q", sendTo)
+	}
+	if contentType := request.Header.Get("Content-Type"); contentType != "application/octet-stream" {
+		t.Errorf("Expected Content-Type application/octet-stream, got %q", contentType)
+	}
+}
+
+func TestSendInvoiceEmailWithSendGrid(t *testing.T) {
+	session, quickBooksRequests, sendMailBodies := deliveryServers(t, http.StatusAccepted)
+
+	err := function.SendInvoiceEmail(context.Background(), session, "Bearer token", function.EMAIL_MODE_SENDGRID, createdInvoice(), "carol@example.com", "Carol")
+	if err != nil {
+		t.Fatalf("Expected the email to be accepted, got %v", err)
+	}
+	if len(*quickBooksRequests) != 1 || (*quickBooksRequests)[0].URL.Path != "/v3/company/123/invoice/130/pdf" {
+		t.Errorf("Expected only the invoice PDF to be requested from QuickBooks, got %d requests", len(*quickBooksRequests))
+	}
+	if len(*sendMailBodies) != 1 {
+		t.Fatalf("Expected one email, got %d", len(*sendMailBodies))
+	}
+
+	body := (*sendMailBodies)[0]
+	if body["template_id"] != "d-invoice" {
+		t.Errorf("Expected the invoice template, got %v", body["template_id"])
+	}
+	if attachments, _ := body["attachments"].([]any); len(attachments) != 1 {
+		t.Errorf("Expected the invoice PDF to be attached, got %v", body["attachments"])
+	}
+}
+
+func TestSendInvoiceEmailRejected(t *testing.T) {
+	session, _, _ := deliveryServers(t, http.StatusBadRequest)
+
+	err := function.SendInvoiceEmail(context.Background(), session, "Bearer token", function.EMAIL_MODE_SENDGRID, createdInvoice(), "carol@example.com", "Carol")
+	if err == nil {
+		t.Error("Expected the email rejected by SendGrid to fail the delivery")
+	}
+
+	err = function.SendInvoiceEmail(context.Background(), session, "Bearer token", "fax", createdInvoice(), "carol@example.com", "Carol")
+	if err == nil {
+		t.Error("Expected an unknown email mode to fail the delivery")
+	}
+}
+
+func TestInvoiceDeliverySetResult(t *testing.T) {
+	delivery := &function.InvoiceDelivery{InvoiceID: "130", Mode: function.EMAIL_MODE_SENDGRID}
+
+	delivery.SetResult(errors.New("send-mail returned 400: invalid recipient"))
+	if delivery.Status != "failed" || delivery.Error != "send-mail returned 400: invalid recipient" {
+		t.Errorf("Expected a failed delivery with its error, got %q and %q", delivery.Status, delivery.Error)
+	}
+
+	// A retried delivery that succeeds no longer reports the previous error
+	delivery.SetResult(nil)
+	if delivery.Status != "sent" || delivery.Error != "" {
+		t.Errorf("Expected a sent delivery without error, got %q and %q", delivery.Status, delivery.Error)
+	}
+}
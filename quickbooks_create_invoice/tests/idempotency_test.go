@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestDecideInvoiceRequest(t *testing.T) {
+	now := time.Now()
+	record := func(status string, updatedAt time.Time) *function.InvoiceRequestRecord {
+		return &function.InvoiceRequestRecord{RequestHash: "hash", Status: status, UpdatedAt: updatedAt}
+	}
+
+	tests := []struct {
+		name       string
+		record     *function.InvoiceRequestRecord
+		hash       string
+		wantAction function.InvoiceRequestAction
+		wantErr    error
+	}{
+		{name: "First Request", record: nil, hash: "hash", wantAction: function.INVOICE_REQUEST_START},
+		{name: "Replay Of Completed Request", record: record("completed", now.Add(-time.Hour)), hash: "hash", wantAction: function.INVOICE_REQUEST_REPLAY},
+		{name: "Completed Key With Different Payload", record: record("completed", now.Add(-time.Hour)), hash: "other", wantErr: function.ErrIdempotencyKeyReused},
+		{name: "Pending Key With Different Payload", record: record("pending", now), hash: "other", wantErr: function.ErrIdempotencyKeyReused},
+		{name: "Request In Flight", record: record("pending", now.Add(-10*time.Second)), hash: "hash", wantErr: function.ErrInvoiceRequestInProgress},
+		{name: "Request Stopped While Pending", record: record("pending", now.Add(-10*time.Minute)), hash: "hash", wantAction: function.INVOICE_REQUEST_RETRY},
+		{name: "Failed Request", record: record("failed", now.Add(-time.Second)), hash: "hash", wantAction: function.INVOICE_REQUEST_RETRY},
+	}
+
+	for _, tt := range tests {
+		action, err := function.DecideInvoiceRequest(tt.record, tt.hash, now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if action != tt.wantAction {
+			t.Errorf("[%s] Expected action %q, got %q", tt.name, tt.wantAction, action)
+		}
+	}
+}
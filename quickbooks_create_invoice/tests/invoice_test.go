@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func validInvoice() function.InvoiceRequest {
+	return function.InvoiceRequest{
+		CustomerRef: "58",
+		Lines: []function.InvoiceLine{
+			{ItemRef: "12", Quantity: 2, UnitPrice: 19.99, TaxCode: "TAX"},
+		},
+		ShipTo: map[string]string{
+			"street": "123 Main St",
+			"city":   "San Jose",
+			"county": "Santa Clara",
+			"state":  "California",
+			"postal": "95112",
+		},
+		DueDate: "2025-08-01",
+		Memo:    "Thank you for your business",
+	}
+}
+
+func TestInvoiceRequestValidate(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Modify         func(invoice *function.InvoiceRequest)
+		ExpectedFields []string
+	}{
+		{
+			Name:           "Valid Request",
+			Modify:         func(invoice *function.InvoiceRequest) {},
+			ExpectedFields: nil,
+		},
+		{
+			Name:           "Missing Customer",
+			Modify:         func(invoice *function.InvoiceRequest) { invoice.CustomerRef = "" },
+			ExpectedFields: []string{"customer_ref"},
+		},
+		{
+			Name:           "No Line Items",
+			Modify:         func(invoice *function.InvoiceRequest) { invoice.Lines = nil },
+			ExpectedFields: []string{"lines"},
+		},
+		{
+			Name: "Invalid Line Item",
+			Modify: func(invoice *function.InvoiceRequest) {
+				invoice.Lines[0] = function.InvoiceLine{Quantity: 0, UnitPrice: -1, TaxCode: "VAT"}
+			},
+			ExpectedFields: []string{"lines[0].item_ref", "lines[0].quantity", "lines[0].unit_price", "lines[0].tax_code"},
+		},
+		{
+			Name:           "Missing Ship-To Postal",
+			Modify:         func(invoice *function.InvoiceRequest) { delete(invoice.ShipTo, "postal") },
+			ExpectedFields: []string{"ship_to.postal"},
+		},
+		{
+			Name:           "Invalid Due Date",
+			Modify:         func(invoice *function.InvoiceRequest) { invoice.DueDate = "08/01/2025" },
+			ExpectedFields: []string{"due_date"},
+		},
+		{
+			Name:           "Unknown Email Mode",
+			Modify:         func(invoice *function.InvoiceRequest) { invoice.EmailMode = "fax" },
+			ExpectedFields: []string{"email_mode"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			invoice := validInvoice()
+			testCase.Modify(&invoice)
+
+			errs := invoice.Validate()
+			if len(errs) != len(testCase.ExpectedFields) {
+				t.Fatalf("expected %d field errors, got %v", len(testCase.ExpectedFields), errs)
+			}
+			for i, field := range testCase.ExpectedFields {
+				if errs[i].Field != field {
+					t.Errorf("expected error on %s, got %s", field, errs[i].Field)
+				}
+			}
+		})
+	}
+}
+
+func TestToQuickBooksInvoice(t *testing.T) {
+	invoice := validInvoice()
+	quickBooksInvoice := invoice.ToQuickBooksInvoice()
+
+	if quickBooksInvoice.CustomerRef.Value != "58" {
+		t.Errorf("expected customer ref 58, got %s", quickBooksInvoice.CustomerRef.Value)
+	}
+	if len(quickBooksInvoice.Line) != 1 || quickBooksInvoice.Line[0].Amount != 39.98 {
+		t.Errorf("expected one line with amount 39.98, got %+v", quickBooksInvoice.Line)
+	}
+	if quickBooksInvoice.ShipAddr == nil || quickBooksInvoice.ShipAddr.PostalCode != "95112" {
+		t.Errorf("expected ship address with postal 95112, got %+v", quickBooksInvoice.ShipAddr)
+	}
+	if quickBooksInvoice.CustomerMemo == nil || quickBooksInvoice.CustomerMemo.Value != invoice.Memo {
+		t.Errorf("expected customer memo to be set, got %+v", quickBooksInvoice.CustomerMemo)
+	}
+}
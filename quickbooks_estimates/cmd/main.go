@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+	"github.com/joho/godotenv"
+)
+
+func main(){
+	
+	//Only for local development
+	if os.Getenv("ENV") == "DEBUG"{
+		//Load the env file
+		err := godotenv.Load("../keys/.env")
+		if err != nil{
+			log.Printf("Error occurred loading the env file: %v", err)
+		}
+		//Register firebase 
+		shared.InitFirebaseDebug(os.Getenv("FIREBASE_CREDENTIALS_DEBUG"))
+		
+		//Register quickbooks credentials
+		if err := quickbooks.InitQuickBooks(context.Background()); err != nil{
+			log.Fatalf("Error occurred initializing QuickBooks: %v", err)
+		}
+
+		http.Handle("/quickbooks-create-quote", http.HandlerFunc(function.CreateQuote))
+		http.Handle("/quickbooks-respond-quote", http.HandlerFunc(function.RespondToQuote))
+		http.Handle("/quickbooks-convert-quote", http.HandlerFunc(function.ConvertQuote))
+			
+		log.Print("quickbooks-estimates started at: 4008")
+		err = http.ListenAndServe(":4008", nil)
+		if err != nil{
+			log.Printf("Error occurred when starting the server: %v", err)
+		} 
+	}
+}
\ No newline at end of file
@@ -0,0 +1,134 @@
+package function
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+// ConvertQuoteRequest defines the structure of the incoming JSON request
+type ConvertQuoteRequest struct {
+	QuoteID string `json:"quote_id"` // Document ID of an accepted quote in the quotes collection (required)
+}
+
+// invoiceResponse is the response of the invoice endpoint.
+type invoiceResponse struct {
+	Invoice QuickBooksInvoice `json:"Invoice"`
+}
+
+// ConvertQuote creates a QuickBooks Invoice from an accepted quote. The invoice is linked to the estimate
+// through LinkedTxn, which also closes the estimate in QuickBooks.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: POST
+// Request Body: JSON matching ConvertQuoteRequest structure
+// Success Response: 200 OK with the created QuickBooks invoice
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func ConvertQuote(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	adminUID, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	var convertRequest ConvertQuoteRequest
+	if err := json.NewDecoder(request.Body).Decode(&convertRequest); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if convertRequest.QuoteID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "quote_id is required")
+		return
+	}
+
+	quoteRef := firebase_shared.FirestoreClient.Collection(QUOTES_COLLECTION).Doc(convertRequest.QuoteID)
+	quoteSnapshot, err := quoteRef.Get(ctx)
+	if quoteSnapshot != nil && !quoteSnapshot.Exists() {
+		firebase_shared.WriteJSONError(response, http.StatusNotFound, "No quote found with the given ID")
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading quote %s: %v", convertRequest.QuoteID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the quote: "+err.Error())
+		return
+	}
+
+	var quote Quote
+	if err := quoteSnapshot.DataTo(&quote); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the quote: "+err.Error())
+		return
+	}
+	if quote.Status != QUOTE_STATUS_ACCEPTED {
+		firebase_shared.WriteJSONError(response, http.StatusConflict, fmt.Sprintf("Only accepted quotes can be converted, this quote is %s", quote.Status))
+		return
+	}
+
+	// Connect to the company the estimate was created in
+	session, err := quickbooks.OpenQuickBooksSession(ctx, adminUID, quote.QuickBooksRealmID)
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "The QuickBooks company of this quote is not connected for this account. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", adminUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	invoice := QuickBooksInvoice{
+		CustomerRef: &QuickBooksRef{Value: quote.QuickBooksCustomerID},
+		Line:        quickBooksLines(quote.Items),
+		ShipAddr:    propertyToAddress(quote.Property),
+		LinkedTxn:   []QuickBooksLinkedTxn{{TxnID: quote.QuickBooksEstimateID, TxnType: "Estimate"}},
+	}
+
+	// A requestid derived from the quote makes QuickBooks ignore a retried conversion
+	sum := sha256.Sum256([]byte("quote:" + convertRequest.QuoteID))
+	path := "invoice?requestid=" + hex.EncodeToString(sum[:16])
+
+	var created invoiceResponse
+	if err := session.Do(ctx, http.MethodPost, path, invoice, &created); err != nil {
+		log.Printf("Error converting estimate %s: %v", quote.QuickBooksEstimateID, err)
+		quickbooks.WriteQuickBooksError(response, err, "Error creating the QuickBooks invoice")
+		return
+	}
+
+	_, err = quoteRef.Update(ctx, []firestore.Update{
+		{Path: "status", Value: QUOTE_STATUS_CONVERTED},
+		{Path: "quickbooks_invoice_id", Value: created.Invoice.ID},
+		{Path: "updated_at", Value: time.Now()},
+	})
+	if err != nil {
+		log.Printf("Invoice %s created but quote %s could not be updated: %v", created.Invoice.ID, convertRequest.QuoteID, err)
+		firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Invoice created successfully, but the quote could not be updated", created.Invoice)
+		return
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Quote converted to invoice successfully", created.Invoice)
+}
@@ -0,0 +1,287 @@
+package function
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// portalUser holds the users collection fields a quote is validated against. The customer's QuickBooks
+// customer IDs are read with quickbooks.CustomerIDs, since they are stored per company.
+type portalUser struct {
+	Brands     []string            `firestore:"brands"`
+	Properties []map[string]string `firestore:"properties"`
+}
+
+// product holds the products collection fields used to price a quote.
+type product struct {
+	Name             string  `firestore:"name"`
+	Brand            string  `firestore:"brand"`
+	UnitPrice        float64 `firestore:"unit_price"`
+	Active           bool    `firestore:"active"`
+	QuickBooksItemID string  `firestore:"quickbooks_item_id"`
+}
+
+// estimateResponse is the response of the estimate endpoints.
+type estimateResponse struct {
+	Estimate QuickBooksEstimate `json:"Estimate"`
+}
+
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-create-quote", CreateQuote)
+		functions.HTTP("quickbooks-respond-quote", RespondToQuote)
+		functions.HTTP("quickbooks-convert-quote", ConvertQuote)
+	}
+}
+
+// CreateQuote creates a QuickBooks Estimate for a customer and stores it as a pending quote the customer
+// can accept or reject from the portal. The quoted products must belong to the customer's brands and the
+// estimate is shipped to one of the customer's properties.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: POST
+// URL Parameters:
+//   - realm_id: The QuickBooks company to create the estimate in (optional, defaults to the admin's default company)
+//
+// Headers:
+//   - Idempotency-Key: Key identifying the quote, retries with the same key do not create it twice (optional)
+//
+// Request Body: JSON matching the QuoteRequest struct
+// Success Response: 200 OK with the quote ID and the stored quote
+// Error Response: 400 with field-level errors for an invalid quote, otherwise appropriate HTTP status
+// codes with descriptive error messages
+func CreateQuote(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	adminUID, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	var quoteRequest QuoteRequest
+	if err := json.NewDecoder(request.Body).Decode(&quoteRequest); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if errs := quoteRequest.Validate(time.Now()); errs != nil {
+		writeValidationErrors(response, errs)
+		return
+	}
+
+	// The estimate is created with the customer and products synced to the company
+	session, err := quickbooks.OpenQuickBooksSession(ctx, adminUID, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", adminUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	// Check the quote against the customer's account and price it from the catalog
+	quote, err := buildQuote(ctx, &quoteRequest, session.RealmID)
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		writeValidationErrors(response, validationErrors)
+		return
+	}
+	if err != nil {
+		log.Printf("Error building quote for uid %s: %v", quoteRequest.CustomerUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the customer or products: "+err.Error())
+		return
+	}
+
+	estimate := QuickBooksEstimate{
+		CustomerRef:    &QuickBooksRef{Value: quote.QuickBooksCustomerID},
+		Line:           quickBooksLines(quote.Items),
+		ShipAddr:       propertyToAddress(quote.Property),
+		ExpirationDate: quote.ExpirationDate,
+		TxnStatus:      "Pending",
+	}
+	if quote.Memo != "" {
+		estimate.CustomerMemo = &QuickBooksRef{Value: quote.Memo}
+	}
+
+	// Pass a requestid so QuickBooks ignores a retried estimate, and derive the quote ID from it as well
+	path := "estimate"
+	quoteRef := firebase_shared.FirestoreClient.Collection(QUOTES_COLLECTION).NewDoc()
+	if idempotencyKey := request.Header.Get(IDEMPOTENCY_KEY_HEADER); idempotencyKey != "" {
+		sum := sha256.Sum256([]byte(adminUID + ":" + idempotencyKey))
+		requestID := hex.EncodeToString(sum[:16])
+		path += "?requestid=" + requestID
+		quoteRef = firebase_shared.FirestoreClient.Collection(QUOTES_COLLECTION).Doc(requestID)
+	}
+
+	var created estimateResponse
+	if err := session.Do(ctx, http.MethodPost, path, estimate, &created); err != nil {
+		log.Printf("Error creating estimate for uid %s: %v", quote.CustomerUID, err)
+		quickbooks.WriteQuickBooksError(response, err, "Error creating the QuickBooks estimate")
+		return
+	}
+
+	now := time.Now()
+	quote.QuickBooksEstimateID = created.Estimate.ID
+	quote.QuickBooksDocNumber = created.Estimate.DocNumber
+	quote.Status = QUOTE_STATUS_PENDING
+	quote.CreatedBy = adminUID
+	quote.CreatedAt = now
+	quote.UpdatedAt = now
+
+	// A retry that was stored already keeps the quote as it is, the customer may have answered it meanwhile
+	_, err = quoteRef.Create(ctx, quote)
+	if status.Code(err) == codes.AlreadyExists {
+		err = nil
+	}
+	if err != nil {
+		log.Printf("Estimate %s created but the quote could not be stored: %v", created.Estimate.ID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, fmt.Sprintf("Estimate %s was created in QuickBooks but the quote could not be stored", created.Estimate.DocNumber))
+		return
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Quote created successfully", map[string]any{
+		"quote_id": quoteRef.ID,
+		"quote":    quote,
+	})
+}
+
+// buildQuote checks the request against the customer's properties and brands and prices every line,
+// using the catalog price unless the admin quoted another one. The customer and products must be synced
+// to the QuickBooks company realmID.
+func buildQuote(ctx context.Context, quoteRequest *QuoteRequest, realmID string) (*Quote, error) {
+	userSnapshot, err := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(quoteRequest.CustomerUID).Get(ctx)
+	if userSnapshot != nil && !userSnapshot.Exists() {
+		return nil, ValidationErrors{{Field: "customer_uid", Message: "No user found with the given UID"}}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user portalUser
+	if err := userSnapshot.DataTo(&user); err != nil {
+		return nil, err
+	}
+
+	var errs ValidationErrors
+	customerID := quickbooks.CustomerIDs(userSnapshot.Data())[realmID]
+	if customerID == "" {
+		errs = append(errs, FieldError{Field: "customer_uid", Message: "Customer is not linked to a customer of this QuickBooks company"})
+	}
+	propertyIndex := *quoteRequest.PropertyIndex
+	if propertyIndex >= len(user.Properties) {
+		errs = append(errs, FieldError{Field: "property_index", Message: "Selected property does not belong to the customer"})
+	}
+
+	// Fetch every quoted product in a single round trip, as imported from the estimate's company
+	productRefs := make([]*firestore.DocumentRef, 0, len(quoteRequest.Lines))
+	for _, line := range quoteRequest.Lines {
+		productRefs = append(productRefs, firebase_shared.FirestoreClient.Collection(PRODUCTS_COLLECTION).Doc(quickbooks.ProductDocumentID(realmID, line.ProductID)))
+	}
+	productSnapshots, err := firebase_shared.FirestoreClient.GetAll(ctx, productRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &Quote{
+		CustomerUID:          quoteRequest.CustomerUID,
+		PropertyIndex:        propertyIndex,
+		Memo:                 quoteRequest.Memo,
+		ExpirationDate:       quoteRequest.ExpirationDate,
+		QuickBooksCustomerID: customerID,
+		QuickBooksRealmID:    realmID,
+	}
+
+	total := 0.0
+	for i, line := range quoteRequest.Lines {
+		field := fmt.Sprintf("lines[%d].product_id", i)
+		if !productSnapshots[i].Exists() {
+			errs = append(errs, FieldError{Field: field, Message: "Product not found in this QuickBooks company"})
+			continue
+		}
+
+		var quotedProduct product
+		if err := productSnapshots[i].DataTo(&quotedProduct); err != nil {
+			return nil, err
+		}
+		if !quotedProduct.Active {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("%s is no longer available", quotedProduct.Name)})
+			continue
+		}
+		if !slices.Contains(user.Brands, quotedProduct.Brand) {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("%s is not part of the customer's brands", quotedProduct.Name)})
+			continue
+		}
+
+		item := QuoteItem{
+			ProductID:        productRefs[i].ID,
+			QuickBooksItemID: quotedProduct.QuickBooksItemID,
+			Name:             quotedProduct.Name,
+			Quantity:         line.Quantity,
+			UnitPrice:        quotedProduct.UnitPrice,
+		}
+		if line.UnitPrice != nil {
+			item.UnitPrice = *line.UnitPrice
+		}
+		quote.Items = append(quote.Items, item)
+		total += lineAmount(item)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	quote.Property = user.Properties[propertyIndex]
+	quote.Total = math.Round(total*100) / 100
+	return quote, nil
+}
+
+// writeValidationErrors responds with 400 Bad Request and the list of field errors so the
+// frontend can show each message next to the offending field.
+func writeValidationErrors(response http.ResponseWriter, errs ValidationErrors) {
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(response).Encode(map[string]any{
+		"error":  "Invalid quote",
+		"fields": errs,
+	})
+}
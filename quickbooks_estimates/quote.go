@@ -0,0 +1,224 @@
+package function
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	QUOTES_COLLECTION   = "quotes"
+	USERS_COLLECTION    = "users"
+	PRODUCTS_COLLECTION = "products"
+
+	QUOTE_STATUS_PENDING   = "pending"
+	QUOTE_STATUS_ACCEPTED  = "accepted"
+	QUOTE_STATUS_REJECTED  = "rejected"
+	QUOTE_STATUS_CONVERTED = "converted"
+
+	// Date layout QuickBooks expects for ExpirationDate
+	dateLayout = "2006-01-02"
+
+	// Header admins can use to make retries of the same quote safe
+	IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+)
+
+// QuoteRequest is the JSON body accepted by CreateQuote.
+type QuoteRequest struct {
+	CustomerUID    string      `json:"customer_uid"`    // Portal user the quote is for (required)
+	PropertyIndex  *int        `json:"property_index"`  // Index into the customer's properties to ship to (required)
+	Lines          []QuoteLine `json:"lines"`           // Quoted products (required)
+	ExpirationDate string      `json:"expiration_date"` // Last day the quote can be accepted, formatted as YYYY-MM-DD (optional)
+	Memo           string      `json:"memo"`            // Message shown to the customer on the estimate (optional)
+}
+
+// QuoteLine is a single quoted product of a QuoteRequest.
+type QuoteLine struct {
+	ProductID string   `json:"product_id"` // Document ID in the products collection (required)
+	Quantity  float64  `json:"quantity"`   // Quantity, must be greater than zero (required)
+	UnitPrice *float64 `json:"unit_price"` // Quoted price per unit (optional, defaults to the catalog price)
+}
+
+// FieldError describes a validation failure of a single request field.
+type FieldError struct {
+	Field   string `json:"field"`   // Path of the field, e.g. lines[0].quantity
+	Message string `json:"message"` // Human readable reason
+}
+
+// ValidationErrors is the list of field errors found in a request.
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, fieldError := range errs {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the fields of the quote request that do not depend on Firestore and returns every
+// field error found, or nil if they are valid.
+func (quote *QuoteRequest) Validate(now time.Time) ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, message string) {
+		errs = append(errs, FieldError{Field: field, Message: message})
+	}
+
+	if strings.TrimSpace(quote.CustomerUID) == "" {
+		add("customer_uid", "Customer is required")
+	}
+	if quote.PropertyIndex == nil || *quote.PropertyIndex < 0 {
+		add("property_index", "A property is required")
+	}
+
+	if len(quote.Lines) == 0 {
+		add("lines", "At least one product is required")
+	}
+	for i, line := range quote.Lines {
+		prefix := fmt.Sprintf("lines[%d]", i)
+		if strings.TrimSpace(line.ProductID) == "" {
+			add(prefix+".product_id", "Product is required")
+		}
+		if line.Quantity <= 0 {
+			add(prefix+".quantity", "Quantity must be greater than zero")
+		}
+		if line.UnitPrice != nil && *line.UnitPrice < 0 {
+			add(prefix+".unit_price", "Unit price cannot be negative")
+		}
+	}
+
+	if quote.ExpirationDate != "" {
+		if _, err := time.Parse(dateLayout, quote.ExpirationDate); err != nil {
+			add("expiration_date", "Expiration date must be formatted as YYYY-MM-DD")
+		} else if quote.ExpirationDate < now.Format(dateLayout) {
+			add("expiration_date", "Expiration date cannot be in the past")
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Quote is the document stored in the quotes collection.
+type Quote struct {
+	CustomerUID          string            `firestore:"customer_uid" json:"customer_uid"`
+	PropertyIndex        int               `firestore:"property_index" json:"property_index"`
+	Property             map[string]string `firestore:"property" json:"property"`
+	Items                []QuoteItem       `firestore:"items" json:"items"`
+	Total                float64           `firestore:"total" json:"total"`
+	Memo                 string            `firestore:"memo" json:"memo"`
+	ExpirationDate       string            `firestore:"expiration_date" json:"expiration_date"`
+	Status               string            `firestore:"status" json:"status"`
+	ResponseNote         string            `firestore:"response_note,omitempty" json:"response_note,omitempty"` // Reason given by the customer
+	QuickBooksCustomerID string            `firestore:"quickbooks_customer_id" json:"quickbooks_customer_id"`
+	QuickBooksRealmID    string            `firestore:"quickbooks_realm_id" json:"quickbooks_realm_id"`
+	QuickBooksEstimateID string            `firestore:"quickbooks_estimate_id" json:"quickbooks_estimate_id"`
+	QuickBooksDocNumber  string            `firestore:"quickbooks_doc_number" json:"quickbooks_doc_number"`
+	QuickBooksInvoiceID  string            `firestore:"quickbooks_invoice_id,omitempty" json:"quickbooks_invoice_id,omitempty"`
+	CreatedBy            string            `firestore:"created_by" json:"created_by"`
+	CreatedAt            time.Time         `firestore:"created_at" json:"created_at"`
+	UpdatedAt            time.Time         `firestore:"updated_at" json:"updated_at"`
+}
+
+// QuoteItem is a quoted product as stored on the quote.
+type QuoteItem struct {
+	ProductID        string  `firestore:"product_id" json:"product_id"`
+	QuickBooksItemID string  `firestore:"quickbooks_item_id" json:"quickbooks_item_id"`
+	Name             string  `firestore:"name" json:"name"`
+	Quantity         float64 `firestore:"quantity" json:"quantity"`
+	UnitPrice        float64 `firestore:"unit_price" json:"unit_price"`
+}
+
+// QuickBooksRef is a reference to another QuickBooks entity.
+type QuickBooksRef struct {
+	Value string `json:"value"`
+}
+
+// QuickBooksAddress is a QuickBooks PhysicalAddress.
+type QuickBooksAddress struct {
+	Line1                  string `json:"Line1,omitempty"`
+	City                   string `json:"City,omitempty"`
+	CountrySubDivisionCode string `json:"CountrySubDivisionCode,omitempty"`
+	PostalCode             string `json:"PostalCode,omitempty"`
+}
+
+// QuickBooksLine is a sales item line of a QuickBooks Estimate or Invoice.
+type QuickBooksLine struct {
+	DetailType          string  `json:"DetailType"`
+	Amount              float64 `json:"Amount"`
+	Description         string  `json:"Description,omitempty"`
+	SalesItemLineDetail struct {
+		ItemRef   QuickBooksRef `json:"ItemRef"`
+		Qty       float64       `json:"Qty"`
+		UnitPrice float64       `json:"UnitPrice"`
+	} `json:"SalesItemLineDetail"`
+}
+
+// QuickBooksLinkedTxn is a reference from one QuickBooks transaction to another.
+type QuickBooksLinkedTxn struct {
+	TxnID   string `json:"TxnId"`
+	TxnType string `json:"TxnType"`
+}
+
+// QuickBooksEstimate is the QuickBooks v3 Estimate JSON.
+type QuickBooksEstimate struct {
+	ID             string             `json:"Id,omitempty"`
+	SyncToken      string             `json:"SyncToken,omitempty"`
+	Sparse         bool               `json:"sparse,omitempty"`
+	DocNumber      string             `json:"DocNumber,omitempty"`
+	CustomerRef    *QuickBooksRef     `json:"CustomerRef,omitempty"`
+	Line           []QuickBooksLine   `json:"Line,omitempty"`
+	ShipAddr       *QuickBooksAddress `json:"ShipAddr,omitempty"`
+	ExpirationDate string             `json:"ExpirationDate,omitempty"`
+	CustomerMemo   *QuickBooksRef     `json:"CustomerMemo,omitempty"`
+	TxnStatus      string             `json:"TxnStatus,omitempty"` // Pending, Accepted, Closed or Rejected
+}
+
+// QuickBooksInvoice is the QuickBooks v3 Invoice JSON created from an accepted estimate.
+type QuickBooksInvoice struct {
+	ID          string                `json:"Id,omitempty"`
+	DocNumber   string                `json:"DocNumber,omitempty"`
+	CustomerRef *QuickBooksRef        `json:"CustomerRef,omitempty"`
+	Line        []QuickBooksLine      `json:"Line,omitempty"`
+	ShipAddr    *QuickBooksAddress    `json:"ShipAddr,omitempty"`
+	LinkedTxn   []QuickBooksLinkedTxn `json:"LinkedTxn,omitempty"`
+}
+
+// quickBooksLines translates the quoted items into QuickBooks sales item lines.
+func quickBooksLines(items []QuoteItem) []QuickBooksLine {
+	lines := make([]QuickBooksLine, 0, len(items))
+	for _, item := range items {
+		line := QuickBooksLine{
+			DetailType:  "SalesItemLineDetail",
+			Amount:      lineAmount(item),
+			Description: item.Name,
+		}
+		line.SalesItemLineDetail.ItemRef = QuickBooksRef{Value: item.QuickBooksItemID}
+		line.SalesItemLineDetail.Qty = item.Quantity
+		line.SalesItemLineDetail.UnitPrice = item.UnitPrice
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// lineAmount is the amount of a quoted item rounded to cents.
+func lineAmount(item QuoteItem) float64 {
+	return math.Round(item.Quantity*item.UnitPrice*100) / 100
+}
+
+// propertyToAddress maps a portal property (street, city, county, state, postal) to a QuickBooks address.
+// QuickBooks addresses have no county field, so the county is not sent.
+func propertyToAddress(property map[string]string) *QuickBooksAddress {
+	if len(property) == 0 {
+		return nil
+	}
+	return &QuickBooksAddress{
+		Line1:                  property["street"],
+		City:                   property["city"],
+		CountrySubDivisionCode: property["state"],
+		PostalCode:             property["postal"],
+	}
+}
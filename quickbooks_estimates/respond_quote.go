@@ -0,0 +1,197 @@
+package function
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const (
+	QUOTE_ACTION_ACCEPT = "accept"
+	QUOTE_ACTION_REJECT = "reject"
+)
+
+// RespondToQuoteRequest defines the structure of the incoming JSON request
+type RespondToQuoteRequest struct {
+	QuoteID string `json:"quote_id"` // Document ID in the quotes collection (required)
+	Action  string `json:"action"`   // "accept" or "reject" (required)
+	Note    string `json:"note"`     // Reason for the decision, shown to the admins (optional)
+}
+
+// RespondToQuote lets a customer accept or reject one of their pending quotes. The decision is written
+// to the quote first and then to the QuickBooks Estimate's status. The quote is put back to pending if the
+// estimate cannot be updated.
+//
+// Authorization: Requires a valid Bearer token of the customer the quote was created for.
+// Method: POST
+// Request Body: JSON matching RespondToQuoteRequest structure
+// Success Response: 200 OK with the quote's new status
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func RespondToQuote(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Authenticate the customer
+	token, err := verifyCaller(ctx, request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	var respondRequest RespondToQuoteRequest
+	if err := json.NewDecoder(request.Body).Decode(&respondRequest); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if respondRequest.QuoteID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "quote_id is required")
+		return
+	}
+
+	var status, txnStatus string
+	switch respondRequest.Action {
+	case QUOTE_ACTION_ACCEPT:
+		status, txnStatus = QUOTE_STATUS_ACCEPTED, "Accepted"
+	case QUOTE_ACTION_REJECT:
+		status, txnStatus = QUOTE_STATUS_REJECTED, "Rejected"
+	default:
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "action must be either accept or reject")
+		return
+	}
+
+	quoteRef := firebase_shared.FirestoreClient.Collection(QUOTES_COLLECTION).Doc(respondRequest.QuoteID)
+	quoteSnapshot, err := quoteRef.Get(ctx)
+	if quoteSnapshot != nil && !quoteSnapshot.Exists() {
+		firebase_shared.WriteJSONError(response, http.StatusNotFound, "No quote found with the given ID")
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading quote %s: %v", respondRequest.QuoteID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the quote: "+err.Error())
+		return
+	}
+
+	var quote Quote
+	if err := quoteSnapshot.DataTo(&quote); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the quote: "+err.Error())
+		return
+	}
+
+	// Quotes of other customers are reported as missing so their IDs cannot be probed
+	if quote.CustomerUID != token.UID {
+		firebase_shared.WriteJSONError(response, http.StatusNotFound, "No quote found with the given ID")
+		return
+	}
+	if quote.Status != QUOTE_STATUS_PENDING {
+		firebase_shared.WriteJSONError(response, http.StatusConflict, "This quote has already been "+quote.Status)
+		return
+	}
+	if quote.ExpirationDate != "" && quote.ExpirationDate < time.Now().Format(dateLayout) {
+		firebase_shared.WriteJSONError(response, http.StatusConflict, "This quote expired on "+quote.ExpirationDate)
+		return
+	}
+
+	// Customers have no QuickBooks connection of their own, so use the one of the quote's company
+	session, err := quickbooks.OpenRealmSession(ctx, quote.QuickBooksRealmID)
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for realm %s: %v", quote.QuickBooksRealmID, err)
+		firebase_shared.WriteJSONError(response, http.StatusServiceUnavailable, "Quotes are temporarily unavailable, please try again later")
+		return
+	}
+
+	// Record the decision before sending it to QuickBooks. The precondition makes a concurrent response to
+	// the same quote fail here, so only one decision ever reaches the estimate.
+	writeResult, err := quoteRef.Update(ctx, []firestore.Update{
+		{Path: "status", Value: status},
+		{Path: "response_note", Value: strings.TrimSpace(respondRequest.Note)},
+		{Path: "updated_at", Value: time.Now()},
+	}, firestore.LastUpdateTime(quoteSnapshot.UpdateTime))
+	if grpcstatus.Code(err) == codes.FailedPrecondition {
+		firebase_shared.WriteJSONError(response, http.StatusConflict, "This quote was answered meanwhile")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating quote %s: %v", respondRequest.QuoteID, err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error updating the quote: "+err.Error())
+		return
+	}
+
+	if err := updateEstimateStatus(ctx, session, respondRequest.QuoteID, quote.QuickBooksEstimateID, txnStatus); err != nil {
+		log.Printf("Error updating estimate %s: %v", quote.QuickBooksEstimateID, err)
+
+		// Put the quote back to pending so the customer can answer it again
+		_, revertErr := quoteRef.Update(ctx, []firestore.Update{
+			{Path: "status", Value: QUOTE_STATUS_PENDING},
+			{Path: "response_note", Value: firestore.Delete},
+			{Path: "updated_at", Value: time.Now()},
+		}, firestore.LastUpdateTime(writeResult.UpdateTime))
+		if revertErr != nil {
+			log.Printf("Quote %s is %s but estimate %s was not updated: %v", respondRequest.QuoteID, status, quote.QuickBooksEstimateID, revertErr)
+		}
+
+		quickbooks.WriteQuickBooksError(response, err, "Error updating the QuickBooks estimate")
+		return
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Quote "+status+" successfully", map[string]any{
+		"quote_id": respondRequest.QuoteID,
+		"status":   status,
+	})
+}
+
+// updateEstimateStatus sets the TxnStatus of the quote's estimate with a sparse update. QuickBooks rejects
+// updates without the current SyncToken, so the estimate is read first.
+func updateEstimateStatus(ctx context.Context, session *quickbooks.QuickBooksSession, quoteID string, estimateID string, txnStatus string) error {
+	var found estimateResponse
+	if err := session.Do(ctx, http.MethodGet, "estimate/"+estimateID, nil, &found); err != nil {
+		return err
+	}
+
+	update := QuickBooksEstimate{
+		ID:        found.Estimate.ID,
+		SyncToken: found.Estimate.SyncToken,
+		Sparse:    true,
+		TxnStatus: txnStatus,
+	}
+
+	// A requestid derived from the quote and decision makes QuickBooks ignore a retried update
+	sum := sha256.Sum256([]byte("quote:" + quoteID + ":" + txnStatus))
+	return session.Do(ctx, http.MethodPost, "estimate?requestid="+hex.EncodeToString(sum[:16]), update, nil)
+}
+
+// verifyCaller verifies the Firebase ID token of the request and returns it. GetUIDIfAdmin only accepts
+// admins, while quotes are answered by customers.
+func verifyCaller(ctx context.Context, request *http.Request) (*auth.Token, error) {
+	authorization := request.Header.Get("Authorization")
+	idToken, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || idToken == "" {
+		return nil, errors.New("Missing or invalid Authorization header")
+	}
+	return firebase_shared.AuthClient.VerifyIDToken(ctx, idToken)
+}
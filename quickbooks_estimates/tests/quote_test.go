@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestQuoteRequestValidate(t *testing.T) {
+	now := time.Date(2025, 6, 30, 15, 0, 0, 0, time.UTC)
+	property := 0
+	negativeProperty := -1
+	price := 12.5
+	negativePrice := -1.0
+
+	tests := []struct {
+		name   string
+		quote  function.QuoteRequest
+		fields []string
+	}{
+		{
+			name: "Valid quote",
+			quote: function.QuoteRequest{
+				CustomerUID:    "customer",
+				PropertyIndex:  &property,
+				Lines:          []function.QuoteLine{{ProductID: "product", Quantity: 2, UnitPrice: &price}},
+				ExpirationDate: "2025-06-30",
+			},
+		},
+		{
+			name:   "Missing fields",
+			quote:  function.QuoteRequest{},
+			fields: []string{"customer_uid", "property_index", "lines"},
+		},
+		{
+			name: "Invalid lines",
+			quote: function.QuoteRequest{
+				CustomerUID:   "customer",
+				PropertyIndex: &negativeProperty,
+				Lines:         []function.QuoteLine{{Quantity: 0, UnitPrice: &negativePrice}},
+			},
+			fields: []string{"property_index", "lines[0].product_id", "lines[0].quantity", "lines[0].unit_price"},
+		},
+		{
+			name: "Expired quote",
+			quote: function.QuoteRequest{
+				CustomerUID:    "customer",
+				PropertyIndex:  &property,
+				Lines:          []function.QuoteLine{{ProductID: "product", Quantity: 1}},
+				ExpirationDate: "2025-06-29",
+			},
+			fields: []string{"expiration_date"},
+		},
+		{
+			name: "Malformed expiration date",
+			quote: function.QuoteRequest{
+				CustomerUID:    "customer",
+				PropertyIndex:  &property,
+				Lines:          []function.QuoteLine{{ProductID: "product", Quantity: 1}},
+				ExpirationDate: "06/30/2025",
+			},
+			fields: []string{"expiration_date"},
+		},
+	}
+
+	for _, tt := range tests {
+		errs := tt.quote.Validate(now)
+		if len(errs) != len(tt.fields) {
+			t.Errorf("[%s] Expected %d errors, got %v", tt.name, len(tt.fields), errs)
+			continue
+		}
+		for i, field := range tt.fields {
+			if errs[i].Field != field {
+				t.Errorf("[%s] Expected error on %s, got %s", tt.name, field, errs[i].Field)
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	PRODUCTS_COLLECTION   = "products"
+	SYNC_STATE_COLLECTION = "sync_state"
+
+	// Maximum number of results QuickBooks returns for one query
+	itemsPageSize = 1000
+)
+
+// QuickBooksItem holds the Item fields this function imports.
+type QuickBooksItem struct {
+	ID                 string  `json:"Id"`
+	Name               string  `json:"Name"`
+	FullyQualifiedName string  `json:"FullyQualifiedName"`
+	Sku                string  `json:"Sku"`
+	Description        string  `json:"Description"`
+	Type               string  `json:"Type"`
+	Active             bool    `json:"Active"`
+	UnitPrice          float64 `json:"UnitPrice"`
+	ParentRef          *struct {
+		Value string `json:"value"`
+		Name  string `json:"name"`
+	} `json:"ParentRef"`
+	MetaData struct {
+		LastUpdatedTime string `json:"LastUpdatedTime"`
+	} `json:"MetaData"`
+}
+
+// itemQueryResponse is the response of an Item query.
+type itemQueryResponse struct {
+	QueryResponse struct {
+		Item []QuickBooksItem `json:"Item"`
+	} `json:"QueryResponse"`
+}
+
+// ImportResult summarizes an import run.
+type ImportResult struct {
+	RealmID         string    `json:"realm_id"`
+	Imported        int       `json:"imported"`          // Products created or updated
+	Skipped         int       `json:"skipped"`           // Categories, which are not products
+	Removed         int       `json:"removed"`           // Products of the company stored under the bare item ID by earlier imports
+	Incremental     bool      `json:"incremental"`       // Whether only items changed since the last run were fetched
+	LastUpdatedTime time.Time `json:"last_updated_time"` // Cursor used by the next incremental run
+}
+
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-import-items", ImportItems)
+	}
+}
+
+// ImportItems pulls Items from QuickBooks and stores them in the products collection with their brand,
+// SKU, unit price and active flag. The brand of a product is the QuickBooks category it belongs to.
+// After the first run only items changed since the previous run are fetched, using LastUpdatedTime.
+//
+// Products are named {realmId}_{itemId}, since item IDs of different companies, such as a sandbox and the
+// production company, collide. A full import removes the company's products named by the item ID alone.
+//
+// Authorization: Requires a valid Bearer token with 'admin' custom claim set to true.
+// Method: POST
+// URL Parameters:
+//   - realm_id: The QuickBooks company to import from (optional, defaults to the admin's default company)
+//   - full: Set to true to re-import every item instead of only the changed ones (optional)
+//
+// Success Response: 200 OK with an ImportResult
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func ImportItems(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Authenticate Firebase admin user
+	adminUID, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Connect to the admin's QuickBooks company
+	session, err := quickbooks.OpenQuickBooksSession(ctx, adminUID, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", adminUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	// Read the cursor of the previous run unless a full import is requested
+	stateRef := firebase_shared.FirestoreClient.Collection(SYNC_STATE_COLLECTION).Doc("quickbooks_items_" + session.RealmID)
+	var since time.Time
+	if request.URL.Query().Get("full") != "true" {
+		stateSnapshot, err := stateRef.Get(ctx)
+		if err != nil && (stateSnapshot == nil || stateSnapshot.Exists()) {
+			log.Printf("Error reading item sync state: %v", err)
+			firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading item sync state")
+			return
+		}
+		if stateSnapshot.Exists() {
+			if lastUpdated, ok := stateSnapshot.Data()["last_updated_time"].(time.Time); ok {
+				since = lastUpdated
+			}
+		}
+	}
+
+	result, err := importItems(ctx, session, since)
+	if err != nil {
+		log.Printf("Error importing QuickBooks items: %v", err)
+		firebase_shared.WriteJSONError(response, quickbooks.QuickBooksErrorStatus(err), "Error importing QuickBooks items: "+err.Error())
+		return
+	}
+
+	// Move the cursor forward so the next run only picks up newer changes
+	if _, err := stateRef.Set(ctx, map[string]any{
+		"last_updated_time": result.LastUpdatedTime,
+		"last_run_at":       time.Now(),
+	}); err != nil {
+		log.Printf("Error storing item sync state: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Items imported but the sync state could not be stored")
+		return
+	}
+
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Items imported successfully", result)
+}
+
+// importItems pages through the QuickBooks items changed after since (every item when since is zero)
+// and writes them to the products collection.
+func importItems(ctx context.Context, session *quickbooks.QuickBooksSession, since time.Time) (*ImportResult, error) {
+	result := &ImportResult{
+		RealmID:         session.RealmID,
+		Incremental:     !since.IsZero(),
+		LastUpdatedTime: since,
+	}
+
+	bulkWriter := firebase_shared.FirestoreClient.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+
+	for startPosition := 1; ; startPosition += itemsPageSize {
+		var page itemQueryResponse
+		if err := session.Query(ctx, ItemQuery(since, startPosition), &page); err != nil {
+			bulkWriter.End()
+			return nil, err
+		}
+
+		for _, item := range page.QueryResponse.Item {
+			if lastUpdated, err := time.Parse(time.RFC3339, item.MetaData.LastUpdatedTime); err == nil && lastUpdated.After(result.LastUpdatedTime) {
+				result.LastUpdatedTime = lastUpdated
+			}
+
+			// Categories only group items, they are used as the brand of the items below them
+			if item.Type == "Category" {
+				result.Skipped++
+				continue
+			}
+
+			productRef := firebase_shared.FirestoreClient.Collection(PRODUCTS_COLLECTION).Doc(quickbooks.ProductDocumentID(session.RealmID, item.ID))
+			job, err := bulkWriter.Set(productRef, ItemToProduct(item, session.RealmID), firestore.MergeAll)
+			if err != nil {
+				bulkWriter.End()
+				return nil, err
+			}
+			jobs = append(jobs, job)
+		}
+
+		if len(page.QueryResponse.Item) < itemsPageSize {
+			break
+		}
+	}
+
+	bulkWriter.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return nil, err
+		}
+	}
+	result.Imported = len(jobs)
+
+	// Every item was written under its new name, the ones named by the item ID alone are stale
+	if since.IsZero() {
+		removed, err := removeUnprefixedProducts(ctx, session.RealmID)
+		if err != nil {
+			return nil, err
+		}
+		result.Removed = removed
+	}
+	return result, nil
+}
+
+// ItemQuery returns the statement of the page of items starting at startPosition (1 for the first page),
+// changed after since or every item when since is zero. Items are ordered by their last update, so the
+// cursor of an interrupted run never skips an item.
+func ItemQuery(since time.Time, startPosition int) string {
+	// Inactive items are only returned when asked for explicitly, they are needed to deactivate products
+	filter := "Active IN (true, false)"
+	if !since.IsZero() {
+		filter += fmt.Sprintf(" AND MetaData.LastUpdatedTime > '%s'", since.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("select * from Item where %s ORDERBY MetaData.LastUpdatedTime STARTPOSITION %d MAXRESULTS %d", filter, startPosition, itemsPageSize)
+}
+
+// removeUnprefixedProducts deletes the products of the company that earlier imports named by the item ID
+// alone, and returns how many were deleted.
+func removeUnprefixedProducts(ctx context.Context, realmID string) (int, error) {
+	productSnapshots, err := firebase_shared.FirestoreClient.Collection(PRODUCTS_COLLECTION).Where("quickbooks_realm_id", "==", realmID).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	bulkWriter := firebase_shared.FirestoreClient.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+	for _, productSnapshot := range productSnapshots {
+		if productSnapshot.Ref.ID == quickbooks.ProductDocumentID(realmID, productSnapshot.Ref.ID) {
+			continue
+		}
+		job, err := bulkWriter.Delete(productSnapshot.Ref)
+		if err != nil {
+			bulkWriter.End()
+			return 0, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	bulkWriter.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return 0, err
+		}
+	}
+	return len(jobs), nil
+}
+
+// ItemToProduct normalizes a QuickBooks item into a products document.
+func ItemToProduct(item QuickBooksItem, realmID string) map[string]any {
+	// FullyQualifiedName is "Category:Item" when the reference carries no name
+	brand := ""
+	if item.ParentRef != nil {
+		brand = item.ParentRef.Name
+	}
+	if brand == "" {
+		if separator := strings.LastIndex(item.FullyQualifiedName, ":"); separator > 0 {
+			brand = item.FullyQualifiedName[:separator]
+		}
+	}
+
+	return map[string]any{
+		"name":                item.Name,
+		"name_lower":          strings.ToLower(item.Name),
+		"brand":               brand,
+		"sku":                 item.Sku,
+		"description":         item.Description,
+		"unit_price":          item.UnitPrice,
+		"active":              item.Active,
+		"quickbooks_item_id":  item.ID,
+		"quickbooks_realm_id": realmID,
+		"synced_at":           time.Now(),
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func TestItemToProduct(t *testing.T) {
+	tests := []struct {
+		name      string
+		item      string
+		wantBrand string
+	}{
+		{
+			name:      "Brand from the parent category",
+			item:      `{"Id": "7", "Name": "Glass Cleaner", "FullyQualifiedName": "ProBlend:Glass Cleaner", "ParentRef": {"value": "3", "name": "ProBlend"}}`,
+			wantBrand: "ProBlend",
+		},
+		{
+			name:      "Brand from the fully qualified name",
+			item:      `{"Id": "7", "Name": "Glass Cleaner", "FullyQualifiedName": "ProBlend:Glass Cleaner", "ParentRef": {"value": "3"}}`,
+			wantBrand: "ProBlend",
+		},
+		{
+			name:      "Nested categories",
+			item:      `{"Id": "7", "Name": "Glass Cleaner", "FullyQualifiedName": "Chemicals:ProBlend:Glass Cleaner"}`,
+			wantBrand: "Chemicals:ProBlend",
+		},
+		{
+			name:      "Item without a category",
+			item:      `{"Id": "7", "Name": "Glass Cleaner", "FullyQualifiedName": "Glass Cleaner"}`,
+			wantBrand: "",
+		},
+	}
+
+	for _, tt := range tests {
+		var item function.QuickBooksItem
+		if err := json.Unmarshal([]byte(tt.item), &item); err != nil {
+			t.Fatalf("[%s] %v", tt.name, err)
+		}
+
+		product := function.ItemToProduct(item, "9130")
+		if product["brand"] != tt.wantBrand {
+			t.Errorf("[%s] Expected brand %q, got %q", tt.name, tt.wantBrand, product["brand"])
+		}
+	}
+}
+
+func TestItemToProductFields(t *testing.T) {
+	var item function.QuickBooksItem
+	body := `{"Id": "7", "Name": "Glass Cleaner", "Sku": "PB-GC-1G", "Description": "1 gallon", "Type": "Inventory", "Active": false, "UnitPrice": 18.5}`
+	if err := json.Unmarshal([]byte(body), &item); err != nil {
+		t.Fatal(err)
+	}
+
+	product := function.ItemToProduct(item, "9130")
+	want := map[string]any{
+		"name":                "Glass Cleaner",
+		"name_lower":          "glass cleaner",
+		"sku":                 "PB-GC-1G",
+		"description":         "1 gallon",
+		"unit_price":          18.5,
+		"active":              false,
+		"quickbooks_item_id":  "7",
+		"quickbooks_realm_id": "9130",
+	}
+	for field, value := range want {
+		if product[field] != value {
+			t.Errorf("Expected %s to be %v, got %v", field, value, product[field])
+		}
+	}
+}
+
+func TestItemQuery(t *testing.T) {
+	full := function.ItemQuery(time.Time{}, 1)
+	if full != "select * from Item where Active IN (true, false) ORDERBY MetaData.LastUpdatedTime STARTPOSITION 1 MAXRESULTS 1000" {
+		t.Errorf("Unexpected full import statement %q", full)
+	}
+
+	since := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)
+	incremental := function.ItemQuery(since, 1001)
+	if incremental != "select * from Item where Active IN (true, false) AND MetaData.LastUpdatedTime > '2026-03-01T08:30:00Z' ORDERBY MetaData.LastUpdatedTime STARTPOSITION 1001 MAXRESULTS 1000" {
+		t.Errorf("Unexpected incremental import statement %q", incremental)
+	}
+}
@@ -0,0 +1,235 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	USERS_COLLECTION = "users"
+)
+
+var (
+	// ErrInvoiceNotOwned is returned when the invoice belongs to another customer than the caller.
+	ErrInvoiceNotOwned = errors.New("invoice does not belong to the caller")
+
+	// ErrRealmRequired is returned when a customer linked to several QuickBooks companies does not say which
+	// company the invoice belongs to.
+	ErrRealmRequired = errors.New("realm_id is required")
+)
+
+// QuickBooksInvoice holds the Invoice fields needed to check who the invoice belongs to.
+type QuickBooksInvoice struct {
+	ID          string `json:"Id"`
+	DocNumber   string `json:"DocNumber"`
+	CustomerRef struct {
+		Value string `json:"value"`
+	} `json:"CustomerRef"`
+}
+
+// QuickBooksCustomer holds the Customer fields needed to check who the invoice belongs to.
+type QuickBooksCustomer struct {
+	ID               string `json:"Id"`
+	PrimaryEmailAddr *struct {
+		Address string `json:"Address"`
+	} `json:"PrimaryEmailAddr"`
+}
+
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-invoice-pdf", InvoicePDF)
+	}
+}
+
+// InvoicePDF streams the PDF of a QuickBooks invoice. Customers can only download invoices billed to
+// the QuickBooks customer whose email matches their Firebase email, admins can download any invoice.
+//
+// Customers have no QuickBooks connection of their own, so their download uses the token of an admin
+// who connected a company the quickbooks-sync-customers function linked them to.
+//
+// Authentication: Requires a valid Firebase ID token in the Authorization header.
+// Method: GET
+// URL Parameters:
+//   - invoice_id: The QuickBooks invoice ID (required)
+//   - realm_id: The QuickBooks company of the invoice (optional, defaults to the admin's default company, or
+//     for customers to the company they are linked to, required when they are linked to several)
+//
+// Success Response: 200 OK with the application/pdf content
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func InvoicePDF(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is GET
+	if request.Method != http.MethodGet {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected GET request")
+		return
+	}
+
+	// Authenticate the Firebase user
+	token, err := verifyCaller(ctx, request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	invoiceID := request.URL.Query().Get("invoice_id")
+	if invoiceID == "" {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "invoice_id is required")
+		return
+	}
+	if !quickbooks.IsEntityID(invoiceID) {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "invoice_id must be a QuickBooks invoice ID")
+		return
+	}
+
+	// Admins use their own QuickBooks connection, customers the company they are linked to
+	isAdmin, _ := token.Claims["admin"].(bool)
+	var session *quickbooks.QuickBooksSession
+	if isAdmin {
+		session, err = quickbooks.OpenQuickBooksSession(ctx, token.UID, request.URL.Query().Get("realm_id"))
+	} else {
+		session, err = openCustomerSession(ctx, token.UID, request.URL.Query().Get("realm_id"))
+	}
+	if errors.Is(err, ErrRealmRequired) {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "realm_id is required for customers linked to several QuickBooks companies")
+		return
+	}
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", token.UID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired")
+		return
+	}
+
+	// Read the invoice to check that the caller may download it
+	var found struct {
+		Invoice QuickBooksInvoice `json:"Invoice"`
+	}
+	if err := session.Do(ctx, http.MethodGet, "invoice/"+invoiceID, nil, &found); err != nil || found.Invoice.ID == "" {
+		log.Printf("Error fetching invoice %s: %v", invoiceID, err)
+		firebase_shared.WriteJSONError(response, http.StatusNotFound, "No invoice found with the given ID")
+		return
+	}
+
+	if !isAdmin {
+		email, _ := token.Claims["email"].(string)
+		err := CheckInvoiceOwner(ctx, session, &found.Invoice, email)
+		if errors.Is(err, ErrInvoiceNotOwned) {
+			// Answer as if the invoice does not exist so invoice IDs of other customers cannot be probed
+			firebase_shared.WriteJSONError(response, http.StatusNotFound, "No invoice found with the given ID")
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking owner of invoice %s: %v", invoiceID, err)
+			firebase_shared.WriteJSONError(response, quickbooks.QuickBooksErrorStatus(err), "Error fetching the invoice customer")
+			return
+		}
+	}
+
+	pdf, err := session.Download(ctx, "invoice/"+invoiceID+"/pdf", "application/pdf")
+	if err != nil {
+		log.Printf("Error fetching PDF of invoice %s: %v", invoiceID, err)
+		firebase_shared.WriteJSONError(response, quickbooks.QuickBooksErrorStatus(err), "Error fetching the invoice PDF")
+		return
+	}
+	defer pdf.Close()
+
+	fileName := found.Invoice.DocNumber
+	if fileName == "" {
+		fileName = found.Invoice.ID
+	}
+	response.Header().Set("Content-Type", "application/pdf")
+	response.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"invoice-%s.pdf\"", fileName))
+	response.WriteHeader(http.StatusOK)
+
+	// Stream the PDF instead of holding it in memory
+	if _, err := io.Copy(response, pdf); err != nil {
+		log.Printf("Error streaming PDF of invoice %s: %v", invoiceID, err)
+	}
+}
+
+// openCustomerSession opens a session on the QuickBooks company the customer was synced to, using the
+// token of any admin who connected that company. requestedRealmID must be one of the customer's companies,
+// and may only be omitted when the customer is linked to a single one.
+func openCustomerSession(ctx context.Context, uid string, requestedRealmID string) (*quickbooks.QuickBooksSession, error) {
+	userSnapshot, err := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(uid).Get(ctx)
+	if userSnapshot != nil && !userSnapshot.Exists() {
+		return nil, quickbooks.ErrQuickBooksNotConnected
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	customerIDs := quickbooks.CustomerIDs(userSnapshot.Data())
+	if requestedRealmID != "" {
+		if customerIDs[requestedRealmID] == "" {
+			return nil, quickbooks.ErrQuickBooksNotConnected
+		}
+		return quickbooks.OpenRealmSession(ctx, requestedRealmID)
+	}
+
+	switch len(customerIDs) {
+	case 0:
+		return nil, quickbooks.ErrQuickBooksNotConnected
+	case 1:
+		for realmID := range customerIDs {
+			return quickbooks.OpenRealmSession(ctx, realmID)
+		}
+	}
+	return nil, ErrRealmRequired
+}
+
+// CheckInvoiceOwner returns ErrInvoiceNotOwned unless the primary email of the invoice's customer is email.
+func CheckInvoiceOwner(ctx context.Context, session *quickbooks.QuickBooksSession, invoice *QuickBooksInvoice, email string) error {
+	if email == "" || invoice.CustomerRef.Value == "" {
+		return ErrInvoiceNotOwned
+	}
+
+	var found struct {
+		Customer QuickBooksCustomer `json:"Customer"`
+	}
+	if err := session.Do(ctx, http.MethodGet, "customer/"+invoice.CustomerRef.Value, nil, &found); err != nil {
+		return err
+	}
+	if found.Customer.PrimaryEmailAddr == nil || !strings.EqualFold(found.Customer.PrimaryEmailAddr.Address, email) {
+		return ErrInvoiceNotOwned
+	}
+	return nil
+}
+
+// verifyCaller verifies the Firebase ID token of the request and returns it. GetUIDIfAdmin only accepts
+// admins, while customers can download their own invoices too.
+func verifyCaller(ctx context.Context, request *http.Request) (*auth.Token, error) {
+	authorization := request.Header.Get("Authorization")
+	idToken, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || idToken == "" {
+		return nil, errors.New("Missing or invalid Authorization header")
+	}
+	return firebase_shared.AuthClient.VerifyIDToken(ctx, idToken)
+}
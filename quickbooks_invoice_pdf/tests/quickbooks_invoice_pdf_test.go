@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+// customerServer stands in for the QuickBooks API, answering customer reads with body and status.
+func customerServer(t *testing.T, status int, body string) *quickbooks.QuickBooksSession {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/v3/company/123/customer/58" {
+			t.Errorf("Unexpected request to %s", request.URL.Path)
+		}
+		response.WriteHeader(status)
+		response.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	previous := quickbooks.QuickBooks
+	quickbooks.QuickBooks = &quickbooks.QuickBooksConfig{APIURL: server.URL}
+	t.Cleanup(func() { quickbooks.QuickBooks = previous })
+
+	return &quickbooks.QuickBooksSession{RealmID: "123", AccessToken: "access-token"}
+}
+
+func TestCheckInvoiceOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		email   string
+		wantErr error
+	}{
+		{name: "Customer's own invoice", status: http.StatusOK, body: `{"Customer":{"Id":"58","PrimaryEmailAddr":{"Address":"carol@example.com"}}}`, email: "carol@example.com"},
+		{name: "Email differs in case", status: http.StatusOK, body: `{"Customer":{"Id":"58","PrimaryEmailAddr":{"Address":"Carol@Example.com"}}}`, email: "carol@example.com"},
+		{name: "Invoice of another customer", status: http.StatusOK, body: `{"Customer":{"Id":"58","PrimaryEmailAddr":{"Address":"dave@example.com"}}}`, email: "carol@example.com", wantErr: function.ErrInvoiceNotOwned},
+		{name: "Customer without an email", status: http.StatusOK, body: `{"Customer":{"Id":"58"}}`, email: "carol@example.com", wantErr: function.ErrInvoiceNotOwned},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := customerServer(t, tt.status, tt.body)
+			invoice := &function.QuickBooksInvoice{ID: "130"}
+			invoice.CustomerRef.Value = "58"
+
+			if err := function.CheckInvoiceOwner(context.Background(), session, invoice, tt.email); !errors.Is(err, tt.wantErr) {
+				t.Errorf("[%s] Expected %v, got %v", tt.name, tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckInvoiceOwnerWithoutEmail(t *testing.T) {
+	// Callers without an email cannot own an invoice, QuickBooks is not asked
+	session := &quickbooks.QuickBooksSession{RealmID: "123", AccessToken: "access-token"}
+	invoice := &function.QuickBooksInvoice{ID: "130"}
+	invoice.CustomerRef.Value = "58"
+
+	if err := function.CheckInvoiceOwner(context.Background(), session, invoice, ""); !errors.Is(err, function.ErrInvoiceNotOwned) {
+		t.Errorf("Expected ErrInvoiceNotOwned, got %v", err)
+	}
+}
+
+func TestCheckInvoiceOwnerReportsQuickBooksErrors(t *testing.T) {
+	session := customerServer(t, http.StatusBadRequest, `{}`)
+	invoice := &function.QuickBooksInvoice{ID: "130"}
+	invoice.CustomerRef.Value = "58"
+
+	err := function.CheckInvoiceOwner(context.Background(), session, invoice, "carol@example.com")
+	if err == nil || errors.Is(err, function.ErrInvoiceNotOwned) {
+		t.Errorf("Expected the QuickBooks error to be returned rather than ErrInvoiceNotOwned, got %v", err)
+	}
+}
@@ -0,0 +1,563 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	USERS_COLLECTION = "users"
+
+	customerCreated = "created"
+	customerUpdated = "updated"
+
+	// Maximum length of a QuickBooks customer DisplayName
+	maxDisplayNameLength = 100
+)
+
+// ErrRealmRequired is returned when a caller without a QuickBooks connection of their own, such as a sales
+// rep, does not say which of several connected companies to sync with.
+var ErrRealmRequired = errors.New("realm_id is required")
+
+// AdminConnection is the token document of a QuickBooks company connected by a user who is still an owner
+// or admin.
+type AdminConnection struct {
+	RealmID  string
+	TokenKey string
+}
+
+// SyncCustomersRequest defines the structure of the incoming JSON request
+type SyncCustomersRequest struct {
+	UID string `json:"uid"` // Firebase User ID to sync (required unless all is set)
+	All bool   `json:"all"` // Sync every user in the users collection (optional)
+}
+
+// CustomerSyncResult reports the outcome of syncing a single user.
+type CustomerSyncResult struct {
+	UID                  string   `json:"uid"`
+	QuickBooksCustomerID string   `json:"quickbooks_customer_id,omitempty"`
+	PropertyCustomerIDs  []string `json:"quickbooks_property_customer_ids,omitempty"` // Sub-customer of each property, in the order of the properties
+	Action               string   `json:"action,omitempty"`                           // created or updated
+	Error                string   `json:"error,omitempty"`
+}
+
+// QuickBooksAddress is a QuickBooks PhysicalAddress.
+type QuickBooksAddress struct {
+	Line1                  string `json:"Line1,omitempty"`
+	City                   string `json:"City,omitempty"`
+	CountrySubDivisionCode string `json:"CountrySubDivisionCode,omitempty"`
+	PostalCode             string `json:"PostalCode,omitempty"`
+}
+
+// QuickBooksEmail is a QuickBooks EmailAddress.
+type QuickBooksEmail struct {
+	Address string `json:"Address"`
+}
+
+// QuickBooksPhone is a QuickBooks TelephoneNumber.
+type QuickBooksPhone struct {
+	FreeFormNumber string `json:"FreeFormNumber"`
+}
+
+// QuickBooksRef is a reference to another QuickBooks entity.
+type QuickBooksRef struct {
+	Value string `json:"value"`
+}
+
+// QuickBooksCustomer holds the Customer fields this function reads and writes.
+type QuickBooksCustomer struct {
+	ID               string             `json:"Id,omitempty"`
+	SyncToken        string             `json:"SyncToken,omitempty"`
+	Sparse           bool               `json:"sparse,omitempty"`
+	DisplayName      string             `json:"DisplayName,omitempty"`
+	PrimaryEmailAddr *QuickBooksEmail   `json:"PrimaryEmailAddr,omitempty"`
+	PrimaryPhone     *QuickBooksPhone   `json:"PrimaryPhone,omitempty"`
+	BillAddr         *QuickBooksAddress `json:"BillAddr,omitempty"`
+	ShipAddr         *QuickBooksAddress `json:"ShipAddr,omitempty"`
+	Job              bool               `json:"Job,omitempty"`            // Set on sub-customers
+	ParentRef        *QuickBooksRef     `json:"ParentRef,omitempty"`      // Parent of a sub-customer
+	BillWithParent   bool               `json:"BillWithParent,omitempty"` // Bill a sub-customer's invoices to its parent
+}
+
+// customerResponse is the response of the customer read, create and update endpoints.
+type customerResponse struct {
+	Customer QuickBooksCustomer `json:"Customer"`
+}
+
+// customerQueryResponse is the response of a Customer query.
+type customerQueryResponse struct {
+	QueryResponse struct {
+		Customer []QuickBooksCustomer `json:"Customer"`
+	} `json:"QueryResponse"`
+}
+
+// portalUser is the Firestore document stored per customer in the users collection.
+type portalUser struct {
+	Properties []map[string]string `firestore:"properties"`
+}
+
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-sync-customers", SyncCustomers)
+	}
+}
+
+// SyncCustomers finds or creates the QuickBooks Customer matching a portal user, by email and then
+// display name, and stores the QuickBooks customer ID on the user's Firestore document, keyed by the
+// company's realm ID. The customer is billed and shipped to the user's first property. QuickBooks keeps a
+// single address of each kind per customer, so a user with several properties also gets a sub-customer
+// per property, shipped to the property and billed with the customer, whose ID is stored on the property.
+//
+// Authorization: Requires a valid Bearer token of a role with the sync_customers permission. Sales reps
+// can only sync the customers assigned to them, and not all users at once. They have no QuickBooks
+// connection of their own, so their syncs use a company connected by a current owner or admin.
+// Method: POST
+// URL Parameters:
+//   - realm_id: The QuickBooks company to sync with (optional, defaults to the caller's default company, or
+//     for callers without a QuickBooks connection to the connected company, required when there are several)
+//
+// Request Body: JSON matching SyncCustomersRequest structure
+// Success Response: 200 OK with one CustomerSyncResult per user
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func SyncCustomers(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	// Ensure that the caller's role allows syncing customers. create-account and update-account forward the
+	// token of the admin or sales rep who saved the account.
+	token, err := accounts.AuthorizeCaller(ctx, firebase_shared.AuthClient, request, accounts.PERMISSION_SYNC_CUSTOMERS)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+	role := accounts.RoleFromClaims(token.Claims)
+
+	defer request.Body.Close()
+
+	var syncRequest SyncCustomersRequest
+	if err := json.NewDecoder(request.Body).Decode(&syncRequest); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if syncRequest.UID == "" && !syncRequest.All {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Either uid or all is required")
+		return
+	}
+
+	if accounts.IsScopedToAssignedAccounts(role) {
+		if syncRequest.All {
+			firebase_shared.WriteJSONError(response, http.StatusForbidden, "Your role only allows syncing the customers assigned to you")
+			return
+		}
+
+		userSnapshot, err := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(syncRequest.UID).Get(ctx)
+		if userSnapshot != nil && !userSnapshot.Exists() {
+			firebase_shared.WriteJSONError(response, http.StatusNotFound, "No user found with the given UID")
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading user %s: %v", syncRequest.UID, err)
+			firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading the user")
+			return
+		}
+		assignedRep, _ := userSnapshot.Data()[accounts.ASSIGNED_REP_FIELD].(string)
+		if !accounts.CanManageAccount(role, token.UID, assignedRep) {
+			firebase_shared.WriteJSONError(response, http.StatusForbidden, "This customer is not assigned to you")
+			return
+		}
+	}
+
+	// Connect to the caller's QuickBooks company
+	session, err := openSession(ctx, token.UID, role, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, ErrRealmRequired) {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "realm_id is required, several QuickBooks companies are connected")
+		return
+	}
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", token.UID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	// Sync a single user
+	if !syncRequest.All {
+		result := syncCustomer(ctx, session, syncRequest.UID)
+		if result.Error != "" {
+			firebase_shared.WriteJSONError(response, http.StatusBadGateway, result.Error)
+			return
+		}
+		firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Customer synced successfully", result)
+		return
+	}
+
+	// Sync every user, one at a time to stay within QuickBooks' rate limits
+	userSnapshots, err := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error listing users")
+		return
+	}
+
+	results := make([]CustomerSyncResult, 0, len(userSnapshots))
+	failed := 0
+	for _, userSnapshot := range userSnapshots {
+		result := syncCustomer(ctx, session, userSnapshot.Ref.ID)
+		if result.Error != "" {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	message := "Customers synced successfully"
+	if failed > 0 {
+		message = fmt.Sprintf("%d of %d customers could not be synced", failed, len(results))
+	}
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, message, results)
+}
+
+// syncCustomer links one portal user to a QuickBooks Customer and records the customer ID in Firestore.
+func syncCustomer(ctx context.Context, session *quickbooks.QuickBooksSession, uid string) CustomerSyncResult {
+	result := CustomerSyncResult{UID: uid}
+	fail := func(format string, args ...any) CustomerSyncResult {
+		result.Error = fmt.Sprintf(format, args...)
+		log.Printf("QuickBooks customer sync failed for uid %s: %s", uid, result.Error)
+		return result
+	}
+
+	userRecord, err := firebase_shared.AuthClient.GetUser(ctx, uid)
+	if err != nil {
+		return fail("Error fetching auth user: %v", err)
+	}
+
+	userSnapshot, err := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(uid).Get(ctx)
+	if err != nil {
+		return fail("No user document found: %v", err)
+	}
+	var user portalUser
+	if err := userSnapshot.DataTo(&user); err != nil {
+		return fail("Error reading user document: %v", err)
+	}
+
+	// Build the customer from the portal account
+	displayName := userRecord.DisplayName
+	if displayName == "" {
+		displayName = userRecord.Email
+	}
+	customer := QuickBooksCustomer{
+		DisplayName: displayName,
+	}
+	if userRecord.Email != "" {
+		customer.PrimaryEmailAddr = &QuickBooksEmail{Address: userRecord.Email}
+	}
+	if userRecord.PhoneNumber != "" {
+		customer.PrimaryPhone = &QuickBooksPhone{FreeFormNumber: userRecord.PhoneNumber}
+	}
+
+	// The customer is billed and shipped to the first property, the other properties get sub-customers below
+	if len(user.Properties) > 0 {
+		customer.BillAddr = PropertyToAddress(user.Properties[0])
+		customer.ShipAddr = PropertyToAddress(user.Properties[0])
+	}
+
+	existing, err := findCustomer(ctx, session, quickbooks.CustomerIDs(userSnapshot.Data())[session.RealmID], userRecord.Email, displayName)
+	if err != nil {
+		return fail("Error searching QuickBooks customers: %v", err)
+	}
+
+	var saved customerResponse
+	if existing == nil {
+		if err := session.Do(ctx, http.MethodPost, "customer", customer, &saved); err != nil {
+			return fail("Error creating QuickBooks customer: %v", err)
+		}
+		result.Action = customerCreated
+	} else {
+		// Sparse update so fields managed in QuickBooks are left untouched
+		customer.ID = existing.ID
+		customer.SyncToken = existing.SyncToken
+		customer.Sparse = true
+		customer.DisplayName = ""
+		if err := session.Do(ctx, http.MethodPost, "customer", customer, &saved); err != nil {
+			return fail("Error updating QuickBooks customer: %v", err)
+		}
+		result.Action = customerUpdated
+	}
+	result.QuickBooksCustomerID = saved.Customer.ID
+
+	if len(user.Properties) > 1 {
+		result.PropertyCustomerIDs, err = syncPropertyCustomers(ctx, session, &saved.Customer, user.Properties)
+		if err != nil {
+			return fail("Error syncing QuickBooks sub-customers of the properties: %v", err)
+		}
+	}
+
+	// Store the QuickBooks customer on the user's document, next to the IDs in the user's other companies,
+	// and the sub-customers on the properties. The properties are read again in the transaction so that
+	// an edit saved during the sync is not overwritten.
+	userRef := firebase_shared.FirestoreClient.Collection(USERS_COLLECTION).Doc(uid)
+	err = firebase_shared.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		updates := map[string]any{
+			quickbooks.QuickBooks.CustomerIDsField: map[string]any{session.RealmID: saved.Customer.ID},
+			"quickbooks_synced_at":                 time.Now(),
+		}
+		if len(result.PropertyCustomerIDs) > 0 {
+			snapshot, err := tx.Get(userRef)
+			if err != nil {
+				return err
+			}
+			var current portalUser
+			if err := snapshot.DataTo(&current); err != nil {
+				return err
+			}
+			updates["properties"] = SetPropertyCustomerIDs(current.Properties, user.Properties, result.PropertyCustomerIDs, session.RealmID)
+		}
+		return tx.Set(userRef, updates, firestore.MergeAll)
+	})
+	if err != nil {
+		return fail("Error storing QuickBooks customer ID: %v", err)
+	}
+	return result
+}
+
+// syncPropertyCustomers finds or creates a sub-customer of parent for every property, shipped to the
+// property and billed with the parent. Sub-customers are found by the ID stored on the property, then by
+// their display name, see PropertyCustomerName. Their IDs are returned in the order of properties.
+func syncPropertyCustomers(ctx context.Context, session *quickbooks.QuickBooksSession, parent *QuickBooksCustomer, properties []map[string]string) ([]string, error) {
+	customerIDs := make([]string, 0, len(properties))
+	for _, property := range properties {
+		subCustomer := QuickBooksCustomer{
+			DisplayName:    PropertyCustomerName(parent.DisplayName, property),
+			BillAddr:       PropertyToAddress(property),
+			ShipAddr:       PropertyToAddress(property),
+			Job:            true,
+			ParentRef:      &QuickBooksRef{Value: parent.ID},
+			BillWithParent: true,
+		}
+
+		existing, err := findCustomer(ctx, session, property[PropertyCustomerIDKey(session.RealmID)], "", subCustomer.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			subCustomer.ID = existing.ID
+			subCustomer.SyncToken = existing.SyncToken
+			subCustomer.Sparse = true
+			subCustomer.DisplayName = ""
+		}
+
+		var saved customerResponse
+		if err := session.Do(ctx, http.MethodPost, "customer", subCustomer, &saved); err != nil {
+			return nil, err
+		}
+		customerIDs = append(customerIDs, saved.Customer.ID)
+	}
+	return customerIDs, nil
+}
+
+// PropertyCustomerIDKey returns the property field holding the ID of the property's sub-customer in the
+// company realmID. Properties are plain string maps, so the realm ID is part of the key.
+func PropertyCustomerIDKey(realmID string) string {
+	return "quickbooks_customer_id_" + realmID
+}
+
+// SetPropertyCustomerIDs returns current, the properties of the users document, with the sub-customer IDs
+// of the company realmID stored on them. customerIDs are in the order of synced, the properties read
+// before syncing, and are only stored on a property whose address has not been changed since.
+func SetPropertyCustomerIDs(current []map[string]string, synced []map[string]string, customerIDs []string, realmID string) []map[string]string {
+	properties := make([]map[string]string, 0, len(current))
+	for i, property := range current {
+		updated := maps.Clone(property)
+		if i < len(synced) && i < len(customerIDs) && sameAddress(property, synced[i]) {
+			updated[PropertyCustomerIDKey(realmID)] = customerIDs[i]
+		}
+		properties = append(properties, updated)
+	}
+	return properties
+}
+
+// sameAddress reports whether both properties have the same address.
+func sameAddress(property map[string]string, other map[string]string) bool {
+	for _, field := range []string{"street", "city", "county", "state", "postal"} {
+		if property[field] != other[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// PropertyCustomerName returns the display name of the sub-customer of a property: the parent's display
+// name followed by the property's address. QuickBooks separates the names of sub-customers from their
+// parent's with a colon, so colons are left out, and cuts display names at 100 characters.
+func PropertyCustomerName(parentName string, property map[string]string) string {
+	var parts []string
+	for _, field := range []string{"street", "city", "state", "postal"} {
+		if value := strings.TrimSpace(property[field]); value != "" {
+			parts = append(parts, value)
+		}
+	}
+
+	name := strings.ReplaceAll(parentName+" - "+strings.Join(parts, ", "), ":", " ")
+	if runes := []rune(name); len(runes) > maxDisplayNameLength {
+		name = strings.TrimSpace(string(runes[:maxDisplayNameLength]))
+	}
+	return name
+}
+
+// openSession opens a session on the caller's QuickBooks company. Callers scoped to their assigned
+// customers, such as sales reps, have no QuickBooks connection of their own and use a company connected by
+// a current owner or admin: the requested one, or the only one. Other callers must connect QuickBooks.
+func openSession(ctx context.Context, uid string, role string, requestedRealmID string) (*quickbooks.QuickBooksSession, error) {
+	session, err := quickbooks.OpenQuickBooksSession(ctx, uid, requestedRealmID)
+	if !errors.Is(err, quickbooks.ErrQuickBooksNotConnected) || !accounts.IsScopedToAssignedAccounts(role) {
+		return session, err
+	}
+
+	connections, err := adminConnections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := ChooseAdminConnection(connections, requestedRealmID)
+	if err != nil {
+		return nil, err
+	}
+	return quickbooks.NewQuickBooksSession(ctx, connection.RealmID, connection.TokenKey)
+}
+
+// adminConnections returns the QuickBooks connections of the users who are still owners or admins. A token
+// stays stored when its user's role is changed, and is then no longer used on behalf of others.
+func adminConnections(ctx context.Context) ([]AdminConnection, error) {
+	tokenSnapshots, err := firebase_shared.FirestoreClient.Collection(quickbooks.QuickBooks.TokensCollection).Select("realm_id", "uid").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin := map[string]bool{}
+	connections := []AdminConnection{}
+	for _, tokenSnapshot := range tokenSnapshots {
+		realmID, _ := tokenSnapshot.Data()["realm_id"].(string)
+		uid, _ := tokenSnapshot.Data()["uid"].(string)
+		if realmID == "" || uid == "" {
+			continue
+		}
+
+		admin, checked := isAdmin[uid]
+		if !checked {
+			userRecord, err := firebase_shared.AuthClient.GetUser(ctx, uid)
+			if err != nil && !auth.IsUserNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				role := accounts.RoleFromClaims(userRecord.CustomClaims)
+				admin = role == accounts.ROLE_OWNER || role == accounts.ROLE_ADMIN
+			}
+			isAdmin[uid] = admin
+		}
+		if admin {
+			connections = append(connections, AdminConnection{RealmID: realmID, TokenKey: tokenSnapshot.Ref.ID})
+		}
+	}
+	return connections, nil
+}
+
+// ChooseAdminConnection returns the connection to the requested company, or to the only connected company
+// when none is requested. ErrRealmRequired is returned when several companies are connected, and
+// quickbooks.ErrQuickBooksNotConnected when the company is not connected by an owner or admin.
+func ChooseAdminConnection(connections []AdminConnection, requestedRealmID string) (*AdminConnection, error) {
+	var chosen *AdminConnection
+	for i, connection := range connections {
+		if requestedRealmID != "" && connection.RealmID != requestedRealmID {
+			continue
+		}
+		if chosen != nil && chosen.RealmID != connection.RealmID {
+			return nil, ErrRealmRequired
+		}
+		if chosen == nil {
+			chosen = &connections[i]
+		}
+	}
+	if chosen == nil {
+		return nil, quickbooks.ErrQuickBooksNotConnected
+	}
+	return chosen, nil
+}
+
+// findCustomer returns the QuickBooks Customer linked to the user: the stored customer ID first,
+// then a match on email, then a match on display name. nil is returned if none is found.
+func findCustomer(ctx context.Context, session *quickbooks.QuickBooksSession, customerID string, email string, displayName string) (*QuickBooksCustomer, error) {
+	if customerID != "" {
+		var found customerResponse
+		if err := session.Do(ctx, http.MethodGet, "customer/"+customerID, nil, &found); err == nil && found.Customer.ID != "" {
+			return &found.Customer, nil
+		}
+		// The stored customer may have been deleted or merged in QuickBooks, fall back to searching
+		log.Printf("Stored QuickBooks customer %s not found, searching by email and name", customerID)
+	}
+
+	statements := []string{}
+	if email != "" {
+		statements = append(statements, fmt.Sprintf("select * from Customer where PrimaryEmailAddr = '%s'", quickbooks.EscapeQueryValue(email)))
+	}
+	if displayName != "" {
+		statements = append(statements, fmt.Sprintf("select * from Customer where DisplayName = '%s'", quickbooks.EscapeQueryValue(displayName)))
+	}
+
+	for _, statement := range statements {
+		var found customerQueryResponse
+		if err := session.Query(ctx, statement, &found); err != nil {
+			return nil, err
+		}
+		if len(found.QueryResponse.Customer) > 0 {
+			return &found.QueryResponse.Customer[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// PropertyToAddress maps a portal property (street, city, county, state, postal) to a QuickBooks address.
+// QuickBooks addresses have no county field, so the county is not sent.
+func PropertyToAddress(property map[string]string) *QuickBooksAddress {
+	if len(property) == 0 {
+		return nil
+	}
+	return &QuickBooksAddress{
+		Line1:                  property["street"],
+		City:                   property["city"],
+		CountrySubDivisionCode: property["state"],
+		PostalCode:             property["postal"],
+	}
+}
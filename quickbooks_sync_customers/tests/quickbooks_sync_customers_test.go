@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+func TestPropertyCustomerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		parentName string
+		property   map[string]string
+		want       string
+	}{
+		{
+			name:       "Full address",
+			parentName: "Sunset Apartments",
+			property:   map[string]string{"street": "12 Main St", "city": "Fresno", "county": "Fresno", "state": "CA", "postal": "93701"},
+			want:       "Sunset Apartments - 12 Main St, Fresno, CA, 93701",
+		},
+		{
+			name:       "Missing fields are skipped",
+			parentName: "Sunset Apartments",
+			property:   map[string]string{"street": " 12 Main St ", "city": "", "state": "CA"},
+			want:       "Sunset Apartments - 12 Main St, CA",
+		},
+		{
+			name:       "Colons are left out",
+			parentName: "Sunset: West",
+			property:   map[string]string{"street": "Unit 4:B"},
+			want:       "Sunset  West - Unit 4 B",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := function.PropertyCustomerName(tt.parentName, tt.property); got != tt.want {
+			t.Errorf("[%s] Expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestPropertyCustomerNameLength(t *testing.T) {
+	parentName := strings.Repeat("é", 90)
+	name := function.PropertyCustomerName(parentName, map[string]string{"street": "1200 Long Industrial Parkway"})
+
+	if utf8.RuneCountInString(name) > 100 {
+		t.Errorf("Expected at most 100 characters, got %d", utf8.RuneCountInString(name))
+	}
+	if !utf8.ValidString(name) {
+		t.Errorf("Expected the name to be cut between characters, got %q", name)
+	}
+	if !strings.HasPrefix(name, parentName) {
+		t.Errorf("Expected the parent's name to be kept, got %q", name)
+	}
+}
+
+func TestPropertyToAddress(t *testing.T) {
+	address := function.PropertyToAddress(map[string]string{"street": "12 Main St", "city": "Fresno", "county": "Fresno", "state": "CA", "postal": "93701"})
+	if address == nil {
+		t.Fatal("Expected an address, got nil")
+	}
+	if address.Line1 != "12 Main St" || address.City != "Fresno" || address.CountrySubDivisionCode != "CA" || address.PostalCode != "93701" {
+		t.Errorf("Unexpected address %+v", *address)
+	}
+
+	if address := function.PropertyToAddress(nil); address != nil {
+		t.Errorf("Expected no address for an empty property, got %+v", *address)
+	}
+}
+
+func TestChooseAdminConnection(t *testing.T) {
+	connections := []function.AdminConnection{
+		{RealmID: "111", TokenKey: "admin1_111"},
+		{RealmID: "111", TokenKey: "admin2_111"},
+		{RealmID: "222", TokenKey: "admin1_222"},
+	}
+
+	tests := []struct {
+		name        string
+		connections []function.AdminConnection
+		realmID     string
+		wantKey     string
+		wantErr     error
+	}{
+		{name: "Requested company", connections: connections, realmID: "222", wantKey: "admin1_222"},
+		{name: "Company connected by several admins", connections: connections[:2], wantKey: "admin1_111"},
+		{name: "Several companies", connections: connections, wantErr: function.ErrRealmRequired},
+		{name: "Company not connected by an admin", connections: connections, realmID: "333", wantErr: quickbooks.ErrQuickBooksNotConnected},
+		{name: "No admin connection", connections: nil, wantErr: quickbooks.ErrQuickBooksNotConnected},
+	}
+
+	for _, tt := range tests {
+		connection, err := function.ChooseAdminConnection(tt.connections, tt.realmID)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if tt.wantErr == nil && connection.TokenKey != tt.wantKey {
+			t.Errorf("[%s] Expected %s, got %s", tt.name, tt.wantKey, connection.TokenKey)
+		}
+	}
+}
+
+func TestSetPropertyCustomerIDs(t *testing.T) {
+	synced := []map[string]string{
+		{"street": "12 Main St", "city": "Fresno", "state": "CA"},
+		{"street": "4 Oak Ave", "city": "Clovis", "state": "CA"},
+	}
+	current := []map[string]string{
+		{"street": "12 Main St", "city": "Fresno", "state": "CA", function.PropertyCustomerIDKey("999"): "7"},
+		{"street": "9 Elm St", "city": "Clovis", "state": "CA"}, // Edited during the sync
+		{"street": "1 New Rd", "city": "Fresno", "state": "CA"}, // Added during the sync
+	}
+
+	properties := function.SetPropertyCustomerIDs(current, synced, []string{"58", "59"}, "123")
+
+	if len(properties) != 3 {
+		t.Fatalf("Expected the 3 current properties, got %d", len(properties))
+	}
+	if got := properties[0][function.PropertyCustomerIDKey("123")]; got != "58" {
+		t.Errorf("Expected the unchanged property to get sub-customer 58, got %q", got)
+	}
+	if got := properties[0][function.PropertyCustomerIDKey("999")]; got != "7" {
+		t.Errorf("Expected the sub-customer of the other company to be kept, got %q", got)
+	}
+	if _, found := properties[1][function.PropertyCustomerIDKey("123")]; found {
+		t.Error("Expected the edited property not to get the sub-customer of its previous address")
+	}
+	if _, found := properties[2][function.PropertyCustomerIDKey("123")]; found {
+		t.Error("Expected the added property not to get a sub-customer")
+	}
+	if _, found := current[0][function.PropertyCustomerIDKey("123")]; found {
+		t.Error("Expected the current properties to be left unchanged")
+	}
+}
@@ -0,0 +1,416 @@
+package function
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	// Firestore collection logging every processed change notification
+	QB_EVENTS_COLLECTION = "qb_events"
+
+	// Firestore collection mirroring the QuickBooks invoices, keyed by {realmId}_{invoiceId}
+	INVOICES_COLLECTION = "invoices"
+
+	ORDERS_COLLECTION     = "orders"
+	SYNC_STATE_COLLECTION = "sync_state"
+
+	INVOICE_STATUS_OPEN           = "open"
+	INVOICE_STATUS_PARTIALLY_PAID = "partially_paid"
+	INVOICE_STATUS_PAID           = "paid"
+	INVOICE_STATUS_VOIDED         = "voided"
+	INVOICE_STATUS_DELETED        = "deleted"
+
+	eventSourceWebhook = "webhook"
+	eventSourceCDC     = "cdc"
+)
+
+// QuickBooksInvoice holds the Invoice fields mirrored into the invoices collection.
+type QuickBooksInvoice struct {
+	ID          string  `json:"Id"`
+	DocNumber   string  `json:"DocNumber"`
+	TxnDate     string  `json:"TxnDate"`
+	DueDate     string  `json:"DueDate"`
+	TotalAmt    float64 `json:"TotalAmt"`
+	Balance     float64 `json:"Balance"`
+	PrivateNote string  `json:"PrivateNote"`
+	CustomerRef struct {
+		Value string `json:"value"`
+		Name  string `json:"name"`
+	} `json:"CustomerRef"`
+	LinkedTxn []LinkedTxn `json:"LinkedTxn"`
+	MetaData  struct {
+		LastUpdatedTime string `json:"LastUpdatedTime"`
+	} `json:"MetaData"`
+}
+
+// QuickBooksPayment holds the Payment fields needed to find the invoices it paid.
+type QuickBooksPayment struct {
+	ID   string `json:"Id"`
+	Line []struct {
+		LinkedTxn []LinkedTxn `json:"LinkedTxn"`
+	} `json:"Line"`
+}
+
+// LinkedTxn is a reference from one QuickBooks transaction to another.
+type LinkedTxn struct {
+	TxnID   string `json:"TxnId"`
+	TxnType string `json:"TxnType"`
+}
+
+// cdcEntity is an entity returned by the change data capture endpoint. Deleted entities only carry their ID.
+type cdcEntity struct {
+	ID       string `json:"Id"`
+	Status   string `json:"status"`
+	MetaData struct {
+		LastUpdatedTime string `json:"LastUpdatedTime"`
+	} `json:"MetaData"`
+}
+
+// cdcResponse is the response of the change data capture endpoint.
+type cdcResponse struct {
+	CDCResponse []struct {
+		QueryResponse []struct {
+			Invoice []cdcEntity `json:"Invoice"`
+			Payment []cdcEntity `json:"Payment"`
+		} `json:"QueryResponse"`
+	} `json:"CDCResponse"`
+}
+
+// storeEvents records the invoice and payment changes of one company in the qb_events collection as not
+// processed yet. Changes are stored before they are applied, so that a change whose processing fails after
+// the notification was acknowledged is retried by the next catch-up (see pendingChanges).
+func storeEvents(ctx context.Context, realmID string, changes []EntityChange, source string) error {
+	for _, change := range changes {
+		if change.Name != "Invoice" && change.Name != "Payment" {
+			continue
+		}
+
+		_, err := eventRef(realmID, change).Set(ctx, map[string]any{
+			"realm_id":     realmID,
+			"entity":       change.Name,
+			"entity_id":    change.ID,
+			"operation":    change.Operation,
+			"last_updated": change.LastUpdated,
+			"source":       source,
+			"processed":    false,
+			"error":        "",
+			"received_at":  time.Now(),
+		}, firestore.MergeAll)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingChanges returns the stored changes of the company that were not processed successfully yet.
+func pendingChanges(ctx context.Context, realmID string) ([]EntityChange, error) {
+	eventSnapshots, err := firebase_shared.FirestoreClient.Collection(QB_EVENTS_COLLECTION).
+		Where("realm_id", "==", realmID).
+		Where("processed", "==", false).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]EntityChange, 0, len(eventSnapshots))
+	for _, eventSnapshot := range eventSnapshots {
+		event := eventSnapshot.Data()
+		name, _ := event["entity"].(string)
+		id, _ := event["entity_id"].(string)
+		operation, _ := event["operation"].(string)
+		lastUpdated, _ := event["last_updated"].(string)
+		changes = append(changes, EntityChange{Name: name, ID: id, Operation: operation, LastUpdated: lastUpdated})
+	}
+	return changes, nil
+}
+
+// mergeChanges appends the pending changes that are not among changes.
+func mergeChanges(changes []EntityChange, pending []EntityChange) []EntityChange {
+	for _, change := range pending {
+		if !slices.Contains(changes, change) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// processChanges applies the invoice and payment changes of one company, which were stored with
+// storeEvents, and records the outcome of each of them in the qb_events collection. It returns the number
+// of changes that could not be applied.
+func processChanges(ctx context.Context, realmID string, changes []EntityChange) int {
+	if len(changes) == 0 {
+		return 0
+	}
+
+	// Nobody is calling on behalf of the company, so use the token of any admin who connected it
+	session, sessionErr := quickbooks.OpenRealmSession(ctx, realmID)
+	if sessionErr != nil {
+		log.Printf("Error opening QuickBooks session for realm %s: %v", realmID, sessionErr)
+	}
+
+	failed := 0
+	var lastEvent time.Time
+	for _, change := range changes {
+		if change.Name != "Invoice" && change.Name != "Payment" {
+			continue
+		}
+
+		err := sessionErr
+		if err == nil {
+			err = applyChange(ctx, session, change)
+		}
+		if err != nil {
+			failed++
+			log.Printf("Error applying %s %s %s for realm %s: %v", change.Operation, change.Name, change.ID, realmID, err)
+		}
+
+		if err := recordEvent(ctx, realmID, change, err); err != nil {
+			log.Printf("Error recording %s %s event: %v", change.Name, change.ID, err)
+		}
+
+		if lastUpdated, err := time.Parse(time.RFC3339, change.LastUpdated); err == nil && lastUpdated.After(lastEvent) {
+			lastEvent = lastUpdated
+		}
+	}
+
+	// Remember the latest change so the next catch-up starts from there
+	if !lastEvent.IsZero() {
+		if stored, err := lastEventTime(ctx, realmID); err == nil && lastEvent.After(stored) {
+			_, err := firebase_shared.FirestoreClient.Collection(SYNC_STATE_COLLECTION).Doc("quickbooks_webhook_"+realmID).Set(ctx, map[string]any{
+				"last_event_at": lastEvent,
+			}, firestore.MergeAll)
+			if err != nil {
+				log.Printf("Error storing webhook sync state: %v", err)
+			}
+		}
+	}
+	return failed
+}
+
+// applyChange refreshes the invoices affected by the change from QuickBooks.
+func applyChange(ctx context.Context, session *quickbooks.QuickBooksSession, change EntityChange) error {
+	switch {
+	case change.Name == "Invoice" && change.Operation == "Delete":
+		return storeInvoiceStatus(ctx, session.RealmID, change.ID, map[string]any{
+			"invoice_id": change.ID,
+			"realm_id":   session.RealmID,
+			"status":     INVOICE_STATUS_DELETED,
+			"synced_at":  time.Now(),
+		})
+
+	case change.Name == "Invoice":
+		return refreshInvoice(ctx, session, change.ID, change.Operation == "Void")
+
+	case change.Name == "Payment" && change.Operation == "Delete":
+		// The deleted payment cannot be read anymore, refresh the invoices it was recorded against
+		invoiceSnapshots, err := firebase_shared.FirestoreClient.Collection(INVOICES_COLLECTION).
+			Where("realm_id", "==", session.RealmID).
+			Where("payment_ids", "array-contains", change.ID).
+			Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, invoiceSnapshot := range invoiceSnapshots {
+			invoiceID, _ := invoiceSnapshot.Data()["invoice_id"].(string)
+			if err := refreshInvoice(ctx, session, invoiceID, false); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		var found struct {
+			Payment QuickBooksPayment `json:"Payment"`
+		}
+		if err := session.Do(ctx, http.MethodGet, "payment/"+change.ID, nil, &found); err != nil {
+			return err
+		}
+		for _, line := range found.Payment.Line {
+			for _, linked := range line.LinkedTxn {
+				if linked.TxnType != "Invoice" {
+					continue
+				}
+				if err := refreshInvoice(ctx, session, linked.TxnID, false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// refreshInvoice reads the invoice from QuickBooks and stores its balance and status in the invoices
+// collection and on the portal order it was created from.
+func refreshInvoice(ctx context.Context, session *quickbooks.QuickBooksSession, invoiceID string, voided bool) error {
+	var found struct {
+		Invoice QuickBooksInvoice `json:"Invoice"`
+	}
+	if err := session.Do(ctx, http.MethodGet, "invoice/"+invoiceID, nil, &found); err != nil {
+		return err
+	}
+	invoice := found.Invoice
+
+	// Only webhook notifications carry the Void operation, catch-ups and later changes of a voided invoice
+	// arrive as updates. A voided invoice cannot be reopened, so a stored voided status is kept
+	voided = voided || IsVoided(invoice.TotalAmt, invoice.PrivateNote)
+	if !voided {
+		invoiceSnapshot, err := firebase_shared.FirestoreClient.Collection(INVOICES_COLLECTION).Doc(session.RealmID + "_" + invoice.ID).Get(ctx)
+		// Nothing is stored yet on the first change of the invoice
+		if invoiceSnapshot == nil || invoiceSnapshot.Exists() {
+			if err != nil {
+				return err
+			}
+			voided = invoiceSnapshot.Data()["status"] == INVOICE_STATUS_VOIDED
+		}
+	}
+
+	paymentIDs := []string{}
+	for _, linked := range invoice.LinkedTxn {
+		if linked.TxnType == "Payment" {
+			paymentIDs = append(paymentIDs, linked.TxnID)
+		}
+	}
+
+	return storeInvoiceStatus(ctx, session.RealmID, invoice.ID, map[string]any{
+		"invoice_id":            invoice.ID,
+		"realm_id":              session.RealmID,
+		"doc_number":            invoice.DocNumber,
+		"customer_ref":          invoice.CustomerRef.Value,
+		"customer_name":         invoice.CustomerRef.Name,
+		"txn_date":              invoice.TxnDate,
+		"due_date":              invoice.DueDate,
+		"total":                 invoice.TotalAmt,
+		"balance":               invoice.Balance,
+		"status":                InvoiceStatus(invoice.TotalAmt, invoice.Balance, voided),
+		"payment_ids":           paymentIDs,
+		"quickbooks_updated_at": invoice.MetaData.LastUpdatedTime,
+		"synced_at":             time.Now(),
+	})
+}
+
+// storeInvoiceStatus writes the invoice document and mirrors its status and balance onto the linked order.
+func storeInvoiceStatus(ctx context.Context, realmID string, invoiceID string, fields map[string]any) error {
+	_, err := firebase_shared.FirestoreClient.Collection(INVOICES_COLLECTION).Doc(realmID+"_"+invoiceID).Set(ctx, fields, firestore.MergeAll)
+	if err != nil {
+		return err
+	}
+
+	orderSnapshots, err := firebase_shared.FirestoreClient.Collection(ORDERS_COLLECTION).
+		Where("quickbooks_realm_id", "==", realmID).
+		Where("quickbooks_invoice_id", "==", invoiceID).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, orderSnapshot := range orderSnapshots {
+		updates := []firestore.Update{{Path: "invoice_status", Value: fields["status"]}}
+		if balance, ok := fields["balance"]; ok {
+			updates = append(updates, firestore.Update{Path: "invoice_balance", Value: balance})
+		}
+		if _, err := orderSnapshot.Ref.Update(ctx, updates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordEvent records the outcome of applying the change on its qb_events document.
+func recordEvent(ctx context.Context, realmID string, change EntityChange, applyErr error) error {
+	event := map[string]any{
+		"processed":    applyErr == nil,
+		"error":        "",
+		"processed_at": time.Now(),
+	}
+	if applyErr != nil {
+		event["error"] = applyErr.Error()
+	}
+
+	_, err := eventRef(realmID, change).Set(ctx, event, firestore.MergeAll)
+	return err
+}
+
+// eventRef returns the qb_events document of the change. The document ID is derived from the change, so a
+// notification Intuit delivers twice, or that is caught up on again, is stored once.
+func eventRef(realmID string, change EntityChange) *firestore.DocumentRef {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", realmID, change.Name, change.ID, change.Operation, change.LastUpdated)))
+	return firebase_shared.FirestoreClient.Collection(QB_EVENTS_COLLECTION).Doc(hex.EncodeToString(sum[:16]))
+}
+
+// lastEventTime returns the time of the latest change processed for the company, or zero if none was.
+func lastEventTime(ctx context.Context, realmID string) (time.Time, error) {
+	stateSnapshot, err := firebase_shared.FirestoreClient.Collection(SYNC_STATE_COLLECTION).Doc("quickbooks_webhook_" + realmID).Get(ctx)
+	if stateSnapshot != nil && !stateSnapshot.Exists() {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	lastEvent, _ := stateSnapshot.Data()["last_event_at"].(time.Time)
+	return lastEvent, nil
+}
+
+// fetchChanges returns the invoice and payment changes made after since, as webhook change notifications.
+func fetchChanges(ctx context.Context, session *quickbooks.QuickBooksSession, since time.Time) ([]EntityChange, error) {
+	var found cdcResponse
+	path := "cdc?entities=Invoice,Payment&changedSince=" + url.QueryEscape(since.Format(time.RFC3339))
+	if err := session.Do(ctx, http.MethodGet, path, nil, &found); err != nil {
+		return nil, err
+	}
+
+	changes := []EntityChange{}
+	add := func(name string, entities []cdcEntity) {
+		for _, entity := range entities {
+			operation := "Update"
+			if entity.Status == "Deleted" {
+				operation = "Delete"
+			}
+			changes = append(changes, EntityChange{
+				Name:        name,
+				ID:          entity.ID,
+				Operation:   operation,
+				LastUpdated: entity.MetaData.LastUpdatedTime,
+			})
+		}
+	}
+	for _, cdc := range found.CDCResponse {
+		for _, queryResponse := range cdc.QueryResponse {
+			add("Invoice", queryResponse.Invoice)
+			add("Payment", queryResponse.Payment)
+		}
+	}
+	return changes, nil
+}
+
+// InvoiceStatus derives the portal status of an invoice from its total and open balance.
+func InvoiceStatus(total float64, balance float64, voided bool) string {
+	switch {
+	case voided:
+		return INVOICE_STATUS_VOIDED
+	case balance <= 0:
+		return INVOICE_STATUS_PAID
+	case balance < total:
+		return INVOICE_STATUS_PARTIALLY_PAID
+	default:
+		return INVOICE_STATUS_OPEN
+	}
+}
+
+// IsVoided reports whether a QuickBooks invoice was voided, from its total and private note. QuickBooks
+// zeroes the amounts of a voided invoice and prefixes its private note with Voided.
+func IsVoided(total float64, privateNote string) bool {
+	return total == 0 && strings.HasPrefix(privateNote, "Voided")
+}
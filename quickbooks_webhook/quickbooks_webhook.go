@@ -0,0 +1,258 @@
+package function
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/cors"
+	firebase_shared "github.com/HarshMohanSason/AHSChemicalsGCShared/shared/firebase"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/quickbooks"
+)
+
+const (
+	// Header carrying the base64 HMAC-SHA256 of the payload, keyed with the webhook verifier token
+	INTUIT_SIGNATURE_HEADER = "intuit-signature"
+
+	// QuickBooks only keeps change data for the last 30 days
+	maxCDCLookback = 30 * 24 * time.Hour
+
+	// Lookback of the first catch-up run when no event was received yet
+	defaultCDCLookback = 24 * time.Hour
+)
+
+// QUICKBOOKS_WEBHOOK_VERIFIER_TOKEN is the verifier token of the Intuit app's webhook configuration.
+var QUICKBOOKS_WEBHOOK_VERIFIER_TOKEN string
+
+// WebhookPayload is the JSON body Intuit posts to the webhook.
+type WebhookPayload struct {
+	EventNotifications []struct {
+		RealmID         string `json:"realmId"`
+		DataChangeEvent struct {
+			Entities []EntityChange `json:"entities"`
+		} `json:"dataChangeEvent"`
+	} `json:"eventNotifications"`
+}
+
+// EntityChange is a single change notification of a QuickBooks entity.
+type EntityChange struct {
+	Name        string `json:"name"`        // Entity type, e.g. Invoice or Payment
+	ID          string `json:"id"`          // QuickBooks ID of the entity
+	Operation   string `json:"operation"`   // Create, Update, Delete, Merge, Void or Emailed
+	LastUpdated string `json:"lastUpdated"` // Time of the change
+}
+
+func init() {
+	if os.Getenv("ENV") != "DEBUG" {
+		ctx := context.Background()
+		if err := quickbooks.InitQuickBooks(ctx); err != nil {
+			log.Fatalf("Failed to initialize QuickBooks: %v", err)
+		}
+
+		projectID, err := metadata.ProjectIDWithContext(ctx)
+		if err != nil {
+			log.Fatalf("Failed to retrieve project ID from metadata: %v", err)
+		}
+
+		// Each environment's webhook is signed with the verifier token of its own Intuit app
+		verifierTokenName := quickbooks.QuickBooks.SecretName("WEBHOOK_VERIFIER_TOKEN")
+		verifierTokenPath := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, verifierTokenName)
+		QUICKBOOKS_WEBHOOK_VERIFIER_TOKEN, err = shared.GetSecretFromGCP(verifierTokenPath)
+		if err != nil {
+			log.Fatalf("Failed to fetch %s from Secret Manager: %v", verifierTokenName, err)
+		}
+		firebase_shared.InitFirebaseProd(nil)
+
+		functions.HTTP("quickbooks-webhook", QuickBooksWebhook)
+	} else {
+		// Local development using environment variables
+		QUICKBOOKS_WEBHOOK_VERIFIER_TOKEN = os.Getenv("QUICKBOOKS_WEBHOOK_VERIFIER_TOKEN")
+	}
+}
+
+// QuickBooksWebhook receives Intuit webhook notifications and records invoice and payment changes made in
+// QuickBooks in the qb_events and invoices collections, so that for example an invoice paid in QuickBooks
+// shows as paid in the portal.
+//
+// Notifications are acknowledged once their changes are stored and processed afterwards. With mode=cdc the
+// function instead catches up on changes that were missed, using QuickBooks' change data capture, and
+// retries the stored changes that could not be processed. This is meant to be called by an admin or a
+// scheduler, after an outage and regularly.
+//
+// Authorization: The intuit-signature header must match the payload. In cdc mode, requires a valid Bearer
+// token with 'admin' custom claim set to true.
+// Method: POST
+// URL Parameters:
+//   - mode: Set to cdc to catch up on missed changes (optional)
+//   - realm_id: The QuickBooks company to catch up on in cdc mode (optional, defaults to the admin's default company)
+//   - since: Catch up on changes after this RFC3339 time in cdc mode (optional, defaults to the last received event)
+//
+// Success Response: 200 OK
+// Error Response: Appropriate HTTP status codes with descriptive error messages. Intuit retries the
+// notification when the response is not successful, that is when its changes could not be stored.
+func QuickBooksWebhook(response http.ResponseWriter, request *http.Request) {
+	// Handle CORS preflight requests
+	if cors.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Ensure method is POST
+	if request.Method != http.MethodPost {
+		firebase_shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Expected POST request")
+		return
+	}
+
+	if request.URL.Query().Get("mode") == "cdc" {
+		catchUp(response, request)
+		return
+	}
+
+	defer request.Body.Close()
+	payload, err := io.ReadAll(request.Body)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Error reading request body")
+		return
+	}
+
+	// Reject notifications that were not signed by Intuit
+	if !VerifySignature(payload, request.Header.Get(INTUIT_SIGNATURE_HEADER), QUICKBOOKS_WEBHOOK_VERIFIER_TOKEN) {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "Invalid intuit-signature")
+		return
+	}
+
+	var notification WebhookPayload
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusBadRequest, "Invalid webhook payload")
+		return
+	}
+
+	// Store the changes first, Intuit retries the notification when they could not be stored
+	ctx := request.Context()
+	for _, event := range notification.EventNotifications {
+		if err := storeEvents(ctx, event.RealmID, event.DataChangeEvent.Entities, eventSourceWebhook); err != nil {
+			log.Printf("Error storing webhook events for realm %s: %v", event.RealmID, err)
+			firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error storing webhook events")
+			return
+		}
+	}
+
+	// Acknowledge before processing, as Intuit expects a response within seconds. Changes that fail to
+	// process stay pending and are retried by the next catch-up.
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Webhook received successfully", nil)
+	if flusher, ok := response.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for _, event := range notification.EventNotifications {
+		if failed := processChanges(ctx, event.RealmID, event.DataChangeEvent.Entities); failed > 0 {
+			log.Printf("%d changes of realm %s could not be processed and are left pending", failed, event.RealmID)
+		}
+	}
+}
+
+// catchUp fetches the invoice and payment changes since the last received event through the CDC
+// endpoint and processes them like webhook notifications.
+func catchUp(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Authenticate Firebase admin user
+	adminUID, err := firebase_shared.GetUIDIfAdmin(request)
+	if err != nil {
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Connect to the admin's QuickBooks company
+	session, err := quickbooks.OpenQuickBooksSession(ctx, adminUID, request.URL.Query().Get("realm_id"))
+	if errors.Is(err, quickbooks.ErrQuickBooksNotConnected) {
+		firebase_shared.WriteJSONError(response, http.StatusPreconditionFailed, "No QuickBooks company connected for this account. Please connect QuickBooks first.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening QuickBooks session for uid %s: %v", adminUID, err)
+		firebase_shared.WriteJSONError(response, http.StatusUnauthorized, "QuickBooks authorization invalid or expired. Please authenticate again.")
+		return
+	}
+
+	since := time.Now().Add(-defaultCDCLookback)
+	if value := request.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			firebase_shared.WriteJSONError(response, http.StatusBadRequest, "since must be an RFC3339 time")
+			return
+		}
+	} else if lastEvent, err := lastEventTime(ctx, session.RealmID); err != nil {
+		log.Printf("Error reading webhook sync state: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading webhook sync state")
+		return
+	} else if !lastEvent.IsZero() {
+		since = lastEvent
+	}
+	if oldest := time.Now().Add(-maxCDCLookback); since.Before(oldest) {
+		since = oldest
+	}
+
+	changes, err := fetchChanges(ctx, session, since)
+	if err != nil {
+		log.Printf("Error fetching QuickBooks changes: %v", err)
+		firebase_shared.WriteJSONError(response, quickbooks.QuickBooksErrorStatus(err), "Error fetching QuickBooks changes: "+err.Error())
+		return
+	}
+
+	if err := storeEvents(ctx, session.RealmID, changes, eventSourceCDC); err != nil {
+		log.Printf("Error storing QuickBooks changes: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error storing QuickBooks changes")
+		return
+	}
+
+	// Retry the stored changes that failed earlier as well
+	pending, err := pendingChanges(ctx, session.RealmID)
+	if err != nil {
+		log.Printf("Error reading pending QuickBooks changes: %v", err)
+		firebase_shared.WriteJSONError(response, http.StatusInternalServerError, "Error reading pending QuickBooks changes")
+		return
+	}
+	changes = mergeChanges(changes, pending)
+
+	failed := processChanges(ctx, session.RealmID, changes)
+	result := map[string]any{
+		"realm_id": session.RealmID,
+		"since":    since,
+		"changes":  len(changes),
+		"failed":   failed,
+	}
+	if failed > 0 {
+		firebase_shared.WriteJSONSuccess(response, http.StatusOK, fmt.Sprintf("%d of %d changes could not be processed", failed, len(changes)), result)
+		return
+	}
+	firebase_shared.WriteJSONSuccess(response, http.StatusOK, "Changes caught up successfully", result)
+}
+
+// VerifySignature reports whether signature is the base64 HMAC-SHA256 of payload keyed with verifierToken.
+func VerifySignature(payload []byte, signature string, verifierToken string) bool {
+	if signature == "" || verifierToken == "" {
+		return false
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(verifierToken))
+	mac.Write(payload)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
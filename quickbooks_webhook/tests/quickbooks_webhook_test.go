@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+)
+
+func sign(payload string, verifierToken string) string {
+	mac := hmac.New(sha256.New, []byte(verifierToken))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := `{"eventNotifications":[{"realmId":"123","dataChangeEvent":{"entities":[{"name":"Invoice","id":"130","operation":"Update"}]}}]}`
+	verifierToken := "verifier-token"
+
+	tests := []struct {
+		name      string
+		payload   string
+		signature string
+		want      bool
+	}{
+		{name: "Valid signature", payload: payload, signature: sign(payload, verifierToken), want: true},
+		{name: "Tampered payload", payload: strings.Replace(payload, "130", "131", 1), signature: sign(payload, verifierToken), want: false},
+		{name: "Signed with another token", payload: payload, signature: sign(payload, "another-token"), want: false},
+		{name: "Missing signature", payload: payload, signature: "", want: false},
+		{name: "Signature is not base64", payload: payload, signature: "not base64!", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := function.VerifySignature([]byte(tt.payload), tt.signature, verifierToken); got != tt.want {
+				t.Errorf("[%s] Expected %v, got %v", tt.name, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInvoiceStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   float64
+		balance float64
+		voided  bool
+		want    string
+	}{
+		{name: "Unpaid", total: 100, balance: 100, want: function.INVOICE_STATUS_OPEN},
+		{name: "Partially paid", total: 100, balance: 40, want: function.INVOICE_STATUS_PARTIALLY_PAID},
+		{name: "Paid", total: 100, balance: 0, want: function.INVOICE_STATUS_PAID},
+		{name: "Voided", total: 0, balance: 0, voided: true, want: function.INVOICE_STATUS_VOIDED},
+	}
+
+	for _, tt := range tests {
+		if got := function.InvoiceStatus(tt.total, tt.balance, tt.voided); got != tt.want {
+			t.Errorf("[%s] Expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestIsVoided(t *testing.T) {
+	tests := []struct {
+		name        string
+		total       float64
+		privateNote string
+		want        bool
+	}{
+		{name: "Voided", total: 0, privateNote: "Voided", want: true},
+		{name: "Voided with a note", total: 0, privateNote: "Voided - duplicate of 1042", want: true},
+		{name: "Zero total", total: 0, privateNote: "", want: false},
+		{name: "Noted as voided but not zeroed", total: 100, privateNote: "Voided", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := function.IsVoided(tt.total, tt.privateNote); got != tt.want {
+			t.Errorf("[%s] Expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestQuickBooksWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		signature  string
+		wantStatus int
+	}{
+		{
+			name:       "Wrong HTTP method",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "Missing signature",
+			method:     http.MethodPost,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid signature",
+			method:     http.MethodPost,
+			signature:  sign("another payload", "verifier-token"),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/quickbooks-webhook", strings.NewReader(`{"eventNotifications":[]}`))
+			if tt.signature != "" {
+				req.Header.Set("intuit-signature", tt.signature)
+			}
+			res := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(function.QuickBooksWebhook)
+			handler.ServeHTTP(res, req)
+
+			if res.Code != tt.wantStatus {
+				t.Errorf("[%s] Expected status %v, got %v", tt.name, tt.wantStatus, res.Code)
+			}
+		})
+	}
+}
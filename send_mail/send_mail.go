@@ -11,6 +11,7 @@ import (
 	"cloud.google.com/go/compute/metadata"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 	sendgrid "github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
@@ -20,6 +21,14 @@ type EmailMetaData struct {
 	Recipients map[string]string `json:"recipients"` // Email address mapped to recipient name
 	Data       map[string]any    `json:"data"`       // Dynamic template data for the email
 	TemplateID string            `json:"template_id"`// SendGrid dynamic template ID
+	Attachments []EmailAttachment `json:"attachments"` // Files attached to the email (optional)
+}
+
+// EmailAttachment is a file attached to the email, such as an invoice PDF.
+type EmailAttachment struct {
+	Content  string `json:"content"`  // Base64 encoded file content
+	Type     string `json:"type"`     // MIME type, e.g. application/pdf
+	Filename string `json:"filename"` // File name shown to the recipient
 }
 
 // Global variables to store the SendGrid API key and sender email address.
@@ -63,7 +72,7 @@ func init() {
 
 // SendMail handles the HTTP POST request to send transactional emails using SendGrid.
 // It validates the incoming request, constructs the email message, and sends it using the SendGrid API.
-
+// Only roles with the send_mail permission may send mail.
 func SendMail(response http.ResponseWriter, request *http.Request) {
 	// Enable CORS for allowed origins and handle preflight OPTIONS requests.
 	if shared.CorsEnabledFunction(response, request) {
@@ -76,9 +85,9 @@ func SendMail(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Ensure that the user is authorized 
-	if err := shared.IsAuthorized(request); err != nil {
-		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+	// Ensure that the caller's role allows sending mail
+	if _, err := accounts.AuthorizeCaller(request.Context(), shared.AuthClient, request, accounts.PERMISSION_SEND_MAIL); err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
 		return
 	}
 	
@@ -125,15 +134,37 @@ func SendMail(response http.ResponseWriter, request *http.Request) {
 	message.AddPersonalizations(p)
 	message.SetTemplateID(emailMetaData.TemplateID)
 
+	// Attach the files, if any.
+	for _, attachment := range emailMetaData.Attachments {
+		if attachment.Content == "" || attachment.Filename == "" {
+			shared.WriteJSONError(response, http.StatusBadRequest, "Attachments require content and a filename")
+			return
+		}
+		a := mail.NewAttachment()
+		a.SetContent(attachment.Content)
+		a.SetType(attachment.Type)
+		a.SetFilename(attachment.Filename)
+		a.SetDisposition("attachment")
+		message.AddAttachment(a)
+	}
+
 	// Send the email using SendGrid API.
 	client := sendgrid.NewSendClient(SENDGRID_API_KEY)
-	_, err := client.Send(message)
+	sendGridResponse, err := client.Send(message)
 	if err != nil {
 		log.Printf("Error sending email to recipients %v: %v", recipients, err)
 		shared.WriteJSONError(response, http.StatusInternalServerError, "Failed to send email")
 		return
 	}
 
-	//Only logging successfully sent emails. Not sending responses
+	// SendGrid reports a rejected email through the status code rather than an error, which is passed
+	// through so that callers can tell whether the email was accepted
+	if sendGridResponse.StatusCode < 200 || sendGridResponse.StatusCode >= 300 {
+		log.Printf("SendGrid rejected the email to recipients %v with status %d: %s", recipients, sendGridResponse.StatusCode, sendGridResponse.Body)
+		shared.WriteJSONError(response, sendGridResponse.StatusCode, "SendGrid rejected the email: "+sendGridResponse.Body)
+		return
+	}
+
 	log.Printf("Email sent successfully to %v recipients using template %s", recipients, emailMetaData.TemplateID)
-}
\ No newline at end of file
+	shared.WriteJSONSuccess(response, sendGridResponse.StatusCode, "Email sent successfully", nil)
+}
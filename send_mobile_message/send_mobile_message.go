@@ -12,6 +12,7 @@ import (
 	"cloud.google.com/go/compute/metadata"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 	twilio "github.com/twilio/twilio-go"
 	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 )
@@ -86,9 +87,9 @@ func SendMobileMessage(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Ensure that the user is authorized 
-	if err := shared.IsAuthorized(request); err != nil {
-		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+	// Ensure that the caller's role allows texting the staff
+	if _, err := accounts.AuthorizeCaller(request.Context(), shared.AuthClient, request, accounts.PERMISSION_SEND_SMS); err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
 		return
 	}
 	
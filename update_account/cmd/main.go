@@ -28,6 +28,7 @@ func main(){
 		shared.InitFirebaseDebug(adminSDKFilePath)
 		
 		http.Handle("/update-account", http.HandlerFunc(function.UpdateAccount))
+		http.Handle("/reassign-accounts", http.HandlerFunc(function.ReassignAccounts))
 			
 		log.Print("update-account started at: 3003")
 		err = http.ListenAndServe(":3003", nil)
@@ -0,0 +1,219 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+// Maximum number of identifiers accepted by a single Auth GetUsers call
+const getUsersBatchSize = 100
+
+// ReassignAccountsRequest defines the structure of the incoming JSON request
+type ReassignAccountsRequest struct {
+	UIDs    []string `json:"uids"`     // Customers to reassign (required unless from_rep is set)
+	FromRep string   `json:"from_rep"` // Reassign every customer of this sales rep instead of a list (optional)
+	ToRep   string   `json:"to_rep"`   // Sales rep to assign the customers to, empty to unassign them (optional)
+}
+
+// Validate checks that the request names either a list of customers or a rep whose customers are
+// reassigned. The error is meant for the caller.
+func (r *ReassignAccountsRequest) Validate() error {
+	if (len(r.UIDs) == 0) == (r.FromRep == "") {
+		return errors.New("Either uids or from_rep is required")
+	}
+	return nil
+}
+
+// AssignedRepUpdate returns the update assigning a customer to the sales rep toRep. Unassigning, with an
+// empty toRep, removes the field so the customer is no longer listed for any rep.
+func AssignedRepUpdate(toRep string) firestore.Update {
+	if toRep == "" {
+		return firestore.Update{Path: accounts.ASSIGNED_REP_FIELD, Value: firestore.Delete}
+	}
+	return firestore.Update{Path: accounts.ASSIGNED_REP_FIELD, Value: toRep}
+}
+
+// ReassignAccounts assigns customers to another sales rep by setting the assigned_rep field of their
+// users documents. Either a list of customers or every customer of a rep, such as a rep who left, is
+// reassigned. The request is rejected if any of the accounts is not a customer.
+//
+// Authorization: Requires Firebase ID token of a role with the assign_reps permission
+// Method: POST
+// Request Body: JSON matching ReassignAccountsRequest structure
+// Response: The reassigned UIDs and the requested UIDs without a users document
+func ReassignAccounts(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS and preflight requests
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Only allow POST method for this function
+	if request.Method != http.MethodPost {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method, expected POST")
+		return
+	}
+
+	// Ensure that the caller's role allows reassigning customers
+	if _, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_ASSIGN_REPS); err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	var reassignRequest ReassignAccountsRequest
+	if err := json.NewDecoder(request.Body).Decode(&reassignRequest); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate required fields
+	if err := reassignRequest.Validate(); err != nil {
+		shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reassignRequest.ToRep != "" {
+		if err := accounts.CheckSalesRep(ctx, shared.AuthClient, reassignRequest.ToRep); err != nil {
+			shared.WriteJSONError(response, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	docRefs, notFound, err := accountsToReassign(ctx, &reassignRequest)
+	if err != nil {
+		log.Printf("Error reading the accounts to reassign: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while reading the accounts")
+		return
+	}
+
+	// Only customers are assigned to sales reps, staff accounts keep their role's access
+	nonCustomers, err := nonCustomerUIDs(ctx, docRefs)
+	if err != nil {
+		log.Printf("Error reading the roles of the accounts to reassign: %v", err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while reading the accounts")
+		return
+	}
+	if len(nonCustomers) > 0 {
+		shared.WriteJSONError(response, http.StatusBadRequest, "Only customers can be reassigned, these accounts are not customers: "+strings.Join(nonCustomers, ", "))
+		return
+	}
+
+	update := AssignedRepUpdate(reassignRequest.ToRep)
+	bulkWriter := shared.FirestoreClient.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(docRefs))
+	for _, docRef := range docRefs {
+		job, err := bulkWriter.Update(docRef, []firestore.Update{update})
+		if err != nil {
+			bulkWriter.End()
+			log.Printf("Error queueing reassignment of uid %s: %v", docRef.ID, err)
+			shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while reassigning the accounts")
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	bulkWriter.End()
+
+	reassigned := []string{}
+	failed := []string{}
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("Error reassigning uid %s: %v", docRefs[i].ID, err)
+			failed = append(failed, docRefs[i].ID)
+			continue
+		}
+		reassigned = append(reassigned, docRefs[i].ID)
+	}
+
+	result := map[string]any{
+		"reassigned": reassigned,
+		"not_found":  notFound,
+		"failed":     failed,
+	}
+	if len(failed) > 0 {
+		shared.WriteJSONSuccess(response, http.StatusOK, fmt.Sprintf("Reassigned %d accounts, %d could not be reassigned", len(reassigned), len(failed)), result)
+		return
+	}
+	shared.WriteJSONSuccess(response, http.StatusOK, fmt.Sprintf("Reassigned %d accounts", len(reassigned)), result)
+}
+
+// accountsToReassign returns the users documents of the customers to reassign, along with the requested
+// UIDs that have no users document.
+func accountsToReassign(ctx context.Context, reassignRequest *ReassignAccountsRequest) ([]*firestore.DocumentRef, []string, error) {
+	users := shared.FirestoreClient.Collection("users")
+	notFound := []string{}
+
+	if reassignRequest.FromRep != "" {
+		docSnapshots, err := users.Where(accounts.ASSIGNED_REP_FIELD, "==", reassignRequest.FromRep).Select().Documents(ctx).GetAll()
+		if err != nil {
+			return nil, nil, err
+		}
+		docRefs := make([]*firestore.DocumentRef, 0, len(docSnapshots))
+		for _, docSnapshot := range docSnapshots {
+			docRefs = append(docRefs, docSnapshot.Ref)
+		}
+		return docRefs, notFound, nil
+	}
+
+	requestedRefs := make([]*firestore.DocumentRef, 0, len(reassignRequest.UIDs))
+	for _, uid := range reassignRequest.UIDs {
+		requestedRefs = append(requestedRefs, users.Doc(uid))
+	}
+	docSnapshots, err := shared.FirestoreClient.GetAll(ctx, requestedRefs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docRefs := make([]*firestore.DocumentRef, 0, len(docSnapshots))
+	for _, docSnapshot := range docSnapshots {
+		if !docSnapshot.Exists() {
+			notFound = append(notFound, docSnapshot.Ref.ID)
+			continue
+		}
+		docRefs = append(docRefs, docSnapshot.Ref)
+	}
+	return docRefs, notFound, nil
+}
+
+// NonCustomers returns the UIDs of the users whose role is not customer.
+func NonCustomers(users []*auth.UserRecord) []string {
+	uids := []string{}
+	for _, user := range users {
+		if accounts.RoleFromClaims(user.CustomClaims) != accounts.ROLE_CUSTOMER {
+			uids = append(uids, user.UID)
+		}
+	}
+	return uids
+}
+
+// nonCustomerUIDs returns the UIDs of the accounts of docRefs whose Auth user is not a customer. Documents
+// without an Auth user are customer documents left behind, see reconcile-accounts, and are not returned.
+func nonCustomerUIDs(ctx context.Context, docRefs []*firestore.DocumentRef) ([]string, error) {
+	uids := []string{}
+	for start := 0; start < len(docRefs); start += getUsersBatchSize {
+		batch := docRefs[start:min(start+getUsersBatchSize, len(docRefs))]
+		identifiers := make([]auth.UserIdentifier, 0, len(batch))
+		for _, docRef := range batch {
+			identifiers = append(identifiers, auth.UIDIdentifier{UID: docRef.ID})
+		}
+
+		result, err := shared.AuthClient.GetUsers(ctx, identifiers)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, NonCustomers(result.Users)...)
+	}
+	return uids, nil
+}
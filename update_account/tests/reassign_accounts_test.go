@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestReassignAccountsRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request function.ReassignAccountsRequest
+		wantErr bool
+	}{
+		{name: "Listed customers", request: function.ReassignAccountsRequest{UIDs: []string{"c1", "c2"}, ToRep: "rep2"}},
+		{name: "Customers of a rep", request: function.ReassignAccountsRequest{FromRep: "rep1", ToRep: "rep2"}},
+		{name: "Unassign customers of a rep", request: function.ReassignAccountsRequest{FromRep: "rep1"}},
+		{name: "Neither customers nor rep", request: function.ReassignAccountsRequest{ToRep: "rep2"}, wantErr: true},
+		{name: "Both customers and rep", request: function.ReassignAccountsRequest{UIDs: []string{"c1"}, FromRep: "rep1", ToRep: "rep2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.request.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestAssignedRepUpdate(t *testing.T) {
+	update := function.AssignedRepUpdate("rep2")
+	if update.Path != accounts.ASSIGNED_REP_FIELD || update.Value != "rep2" {
+		t.Errorf("Expected %s set to rep2, got %+v", accounts.ASSIGNED_REP_FIELD, update)
+	}
+
+	update = function.AssignedRepUpdate("")
+	if update.Path != accounts.ASSIGNED_REP_FIELD || update.Value != firestore.Delete {
+		t.Errorf("Expected %s to be deleted when unassigning, got %+v", accounts.ASSIGNED_REP_FIELD, update)
+	}
+}
+
+func TestNonCustomers(t *testing.T) {
+	user := func(uid string, claims map[string]any) *auth.UserRecord {
+		return &auth.UserRecord{UserInfo: &auth.UserInfo{UID: uid}, CustomClaims: claims}
+	}
+	users := []*auth.UserRecord{
+		user("customer", nil),
+		user("rep", accounts.ClaimsForRole(accounts.ROLE_SALES_REP)),
+		user("legacy-admin", map[string]any{"admin": true}),
+		user("warehouse", accounts.ClaimsForRole(accounts.ROLE_WAREHOUSE)),
+		user("unknown-role", map[string]any{"role": "superuser"}),
+	}
+
+	if got := function.NonCustomers(users); !slices.Equal(got, []string{"rep", "legacy-admin", "warehouse"}) {
+		t.Errorf("Expected rep, legacy-admin and warehouse, got %v", got)
+	}
+}
@@ -10,13 +10,15 @@ import (
 	"cloud.google.com/go/firestore"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
 )
 
 // UpdateUserRequest defines the structure of the incoming JSON request
 type UpdateUserRequest struct {
-	UID        string                `json:"uid"`        // Firebase User ID (required)
-	Brands     []string              `json:"brands"`     // List of brand names associated with the user (required)
-	Properties []map[string]string   `json:"properties"` // List of property objects with fields: street, city, county, state, postal (required)
+	UID            string              `json:"uid"`             // Firebase User ID (required)
+	Brands         []string            `json:"brands"`          // List of brand names associated with the user (required)
+	Properties     []map[string]string `json:"properties"`      // List of property objects with fields: street, city, county, state, postal (required)
+	SyncQuickBooks bool                `json:"sync_quickbooks"` // Push the updated properties to the matching QuickBooks customer (optional)
 }
 
 func init() {
@@ -24,15 +26,18 @@ func init() {
 	if os.Getenv("ENV") != "DEBUG" {
 		shared.InitFirebaseProd(nil)
 		functions.HTTP("update-account", UpdateAccount)
+		functions.HTTP("reassign-accounts", ReassignAccounts)
 	}
 }
 
 // UpdateAccount is a Google Cloud Function that updates a user's brands and properties
-// in Firestore if they differ from the existing records.
+// in Firestore if they differ from the existing records, refreshing the fields fetch-accounts searches on.
 //
-// Authorization: Requires Firebase ID token with 'admin' custom claim set to true
+// Authorization: Requires Firebase ID token of a role with the update_account permission. Sales reps can
+// only update the customers assigned to them.
 // Method: PUT
-// Request Body: JSON matching UpdateUserRequest structure
+// Request Body: JSON matching UpdateUserRequest structure. With sync_quickbooks set, the account is
+// also pushed to its QuickBooks customer through the quickbooks-sync-customers function.
 // Response: Success or error message with appropriate HTTP status code
 func UpdateAccount(response http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
@@ -48,9 +53,10 @@ func UpdateAccount(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Ensure that the user is authorized (admin privileges)
-	if err := shared.IsAuthorizedAndAdmin(request); err != nil {
-		shared.WriteJSONError(response, http.StatusUnauthorized, err.Error())
+	// Ensure that the caller's role allows updating accounts
+	token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_UPDATE_ACCOUNT)
+	if err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
 		return
 	}
 
@@ -104,8 +110,15 @@ func UpdateAccount(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Prepare update operations by comparing incoming data with current Firestore document
+	// Sales reps can only update the customers assigned to them
 	currentData := docSnapshot.Data()
+	assignedRep, _ := currentData[accounts.ASSIGNED_REP_FIELD].(string)
+	if !accounts.CanManageAccount(accounts.RoleFromClaims(token.Claims), token.UID, assignedRep) {
+		shared.WriteJSONError(response, http.StatusNotFound, "No user found with the given UID")
+		return
+	}
+
+	// Prepare update operations by comparing incoming data with current Firestore document
 	updates := []firestore.Update{}
 
 	var firestoreUser UpdateUserRequest
@@ -120,19 +133,36 @@ func UpdateAccount(response http.ResponseWriter, request *http.Request) {
 		updates = append(updates, firestore.Update{FieldPath: []string{"properties"}, Value: user.Properties})
 	}
 
-	// If no changes detected, respond with success and exit
-	if len(updates) == 0 {
-		shared.WriteJSONSuccess(response, http.StatusOK, "No changes detected", nil)
-		return
+	// Apply updates to Firestore if any changes were detected, along with the fields fetch-accounts searches on
+	message := "No changes detected"
+	if len(updates) > 0 {
+		userRecord, err := shared.AuthClient.GetUser(ctx, user.UID)
+		if err != nil {
+			log.Printf("Error fetching auth user %s: %v", user.UID, err)
+			shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while updating the user data")
+			return
+		}
+		for field, value := range accounts.SearchFields(userRecord, user.Brands, user.Properties) {
+			updates = append(updates, firestore.Update{FieldPath: []string{field}, Value: value})
+		}
+
+		_, err = shared.FirestoreClient.Collection("users").Doc(user.UID).Update(ctx, updates)
+		if err != nil {
+			log.Printf("Firestore update error: %v", err)
+			shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while updating the user data")
+			return
+		}
+		message = "Information updated successfully"
 	}
 
-	// Apply updates to Firestore
-	_, err = shared.FirestoreClient.Collection("users").Doc(user.UID).Update(ctx, updates)
-	if err != nil {
-		log.Printf("Firestore update error: %v", err)
-		shared.WriteJSONError(response, http.StatusInternalServerError, "Error occurred while updating the user data")
-		return
+	// Push the account to its QuickBooks customer if requested
+	if user.SyncQuickBooks {
+		if err := accounts.TriggerQuickBooksSync(ctx, request.Header.Get("Authorization"), user.UID); err != nil {
+			log.Printf("QuickBooks sync error for uid %s: %v", user.UID, err)
+			shared.WriteJSONSuccess(response, http.StatusOK, message+", but QuickBooks sync failed", nil)
+			return
+		}
 	}
 
-	shared.WriteJSONSuccess(response, http.StatusOK, "Information updated successfully", nil)
-}
\ No newline at end of file
+	shared.WriteJSONSuccess(response, http.StatusOK, message, nil)
+}
@@ -0,0 +1,88 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+const (
+	ORDER_STATUS_PENDING   = "pending"
+	ORDER_STATUS_APPROVED  = "approved"
+	ORDER_STATUS_INVOICED  = "invoiced"
+	ORDER_STATUS_SHIPPED   = "shipped"
+	ORDER_STATUS_DELIVERED = "delivered"
+	ORDER_STATUS_CANCELLED = "cancelled"
+)
+
+// orderTransitions lists the statuses an order can move to from each status. Delivered and cancelled
+// orders are final. An invoiced order cannot be cancelled here since its QuickBooks invoice would remain.
+var orderTransitions = map[string][]string{
+	ORDER_STATUS_PENDING:   {ORDER_STATUS_APPROVED, ORDER_STATUS_CANCELLED},
+	ORDER_STATUS_APPROVED:  {ORDER_STATUS_INVOICED, ORDER_STATUS_CANCELLED},
+	ORDER_STATUS_INVOICED:  {ORDER_STATUS_SHIPPED},
+	ORDER_STATUS_SHIPPED:   {ORDER_STATUS_DELIVERED},
+	ORDER_STATUS_DELIVERED: {},
+	ORDER_STATUS_CANCELLED: {},
+}
+
+// StatusPermission returns the permission needed to move an order to status. The warehouse only ships
+// and delivers orders, approving, invoicing and cancelling them is left to admins.
+func StatusPermission(status string) accounts.Permission {
+	switch status {
+	case ORDER_STATUS_SHIPPED, ORDER_STATUS_DELIVERED:
+		return accounts.PERMISSION_FULFILL_ORDERS
+	default:
+		return accounts.PERMISSION_MANAGE_ORDERS
+	}
+}
+
+// StatusChange records who moved the order to a status and when. The orders document keeps them in
+// its history array, starting with the pending entry written by the place-order function.
+type StatusChange struct {
+	From      string    `firestore:"from" json:"from"`
+	To        string    `firestore:"to" json:"to"`
+	ChangedBy string    `firestore:"changed_by" json:"changed_by"`
+	ChangedAt time.Time `firestore:"changed_at" json:"changed_at"`
+	Note      string    `firestore:"note,omitempty" json:"note,omitempty"`
+}
+
+// TransitionError is returned when an order cannot move from its current status to the requested one.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (err *TransitionError) Error() string {
+	return fmt.Sprintf("An order cannot move from %s to %s", err.From, err.To)
+}
+
+// ErrOrderInvoiced is returned when cancelling an order whose QuickBooks invoice was created, such as when
+// the invoice was created but the status could not be changed yet.
+var ErrOrderInvoiced = errors.New("An order with a QuickBooks invoice cannot be cancelled")
+
+// CheckTransition returns an error unless an order in status from, with the QuickBooks invoice invoiceID
+// when it was invoiced, can be moved to status to.
+func CheckTransition(from string, to string, invoiceID string) error {
+	if !IsValidTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	if to == ORDER_STATUS_CANCELLED && invoiceID != "" {
+		return ErrOrderInvoiced
+	}
+	return nil
+}
+
+// IsValidStatus reports whether status is one of the order statuses.
+func IsValidStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// IsValidTransition reports whether an order in status from can be moved to status to.
+func IsValidTransition(from string, to string) bool {
+	return slices.Contains(orderTransitions[from], to)
+}
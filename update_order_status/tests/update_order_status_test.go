@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	function "github.com/HarshMohanSason/AHSChemicalsGCFunctions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+func TestIsValidTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{from: function.ORDER_STATUS_PENDING, to: function.ORDER_STATUS_APPROVED, want: true},
+		{from: function.ORDER_STATUS_PENDING, to: function.ORDER_STATUS_CANCELLED, want: true},
+		{from: function.ORDER_STATUS_APPROVED, to: function.ORDER_STATUS_INVOICED, want: true},
+		{from: function.ORDER_STATUS_APPROVED, to: function.ORDER_STATUS_CANCELLED, want: true},
+		{from: function.ORDER_STATUS_INVOICED, to: function.ORDER_STATUS_SHIPPED, want: true},
+		{from: function.ORDER_STATUS_SHIPPED, to: function.ORDER_STATUS_DELIVERED, want: true},
+
+		// Steps cannot be skipped or undone
+		{from: function.ORDER_STATUS_PENDING, to: function.ORDER_STATUS_INVOICED, want: false},
+		{from: function.ORDER_STATUS_PENDING, to: function.ORDER_STATUS_SHIPPED, want: false},
+		{from: function.ORDER_STATUS_SHIPPED, to: function.ORDER_STATUS_INVOICED, want: false},
+		{from: function.ORDER_STATUS_APPROVED, to: function.ORDER_STATUS_PENDING, want: false},
+
+		// An invoiced order keeps its QuickBooks invoice, so it cannot be cancelled
+		{from: function.ORDER_STATUS_INVOICED, to: function.ORDER_STATUS_CANCELLED, want: false},
+
+		// Delivered and cancelled orders are final
+		{from: function.ORDER_STATUS_DELIVERED, to: function.ORDER_STATUS_CANCELLED, want: false},
+		{from: function.ORDER_STATUS_CANCELLED, to: function.ORDER_STATUS_PENDING, want: false},
+
+		{from: "unknown", to: function.ORDER_STATUS_APPROVED, want: false},
+		{from: function.ORDER_STATUS_PENDING, to: function.ORDER_STATUS_PENDING, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := function.IsValidTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("%s -> %s: Expected %v, got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
+
+func TestIsValidStatus(t *testing.T) {
+	for _, status := range []string{
+		function.ORDER_STATUS_PENDING,
+		function.ORDER_STATUS_APPROVED,
+		function.ORDER_STATUS_INVOICED,
+		function.ORDER_STATUS_SHIPPED,
+		function.ORDER_STATUS_DELIVERED,
+		function.ORDER_STATUS_CANCELLED,
+	} {
+		if !function.IsValidStatus(status) {
+			t.Errorf("Expected %s to be a valid status", status)
+		}
+	}
+
+	for _, status := range []string{"", "Pending", "paid"} {
+		if function.IsValidStatus(status) {
+			t.Errorf("Expected %q to be rejected", status)
+		}
+	}
+}
+
+func TestTransitionError(t *testing.T) {
+	err := &function.TransitionError{From: function.ORDER_STATUS_INVOICED, To: function.ORDER_STATUS_CANCELLED}
+	if got := err.Error(); got != "An order cannot move from invoiced to cancelled" {
+		t.Errorf("Unexpected message %q", got)
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      string
+		to        string
+		invoiceID string
+		wantErr   error
+	}{
+		{name: "Cancel an approved order", from: function.ORDER_STATUS_APPROVED, to: function.ORDER_STATUS_CANCELLED},
+		{name: "Cancel an approved order with an invoice", from: function.ORDER_STATUS_APPROVED, to: function.ORDER_STATUS_CANCELLED, invoiceID: "130", wantErr: function.ErrOrderInvoiced},
+		{name: "Invoice an order whose invoice was created", from: function.ORDER_STATUS_APPROVED, to: function.ORDER_STATUS_INVOICED, invoiceID: "130"},
+		{name: "Ship an invoiced order", from: function.ORDER_STATUS_INVOICED, to: function.ORDER_STATUS_SHIPPED, invoiceID: "130"},
+	}
+
+	for _, tt := range tests {
+		if err := function.CheckTransition(tt.from, tt.to, tt.invoiceID); !errors.Is(err, tt.wantErr) {
+			t.Errorf("[%s] Expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	var transitionError *function.TransitionError
+	if err := function.CheckTransition(function.ORDER_STATUS_PENDING, function.ORDER_STATUS_SHIPPED, ""); !errors.As(err, &transitionError) {
+		t.Errorf("Expected a TransitionError, got %v", err)
+	}
+}
+
+func TestStatusPermission(t *testing.T) {
+	tests := []struct {
+		status string
+		role   string
+		want   bool
+	}{
+		{status: function.ORDER_STATUS_SHIPPED, role: accounts.ROLE_WAREHOUSE, want: true},
+		{status: function.ORDER_STATUS_DELIVERED, role: accounts.ROLE_WAREHOUSE, want: true},
+		{status: function.ORDER_STATUS_APPROVED, role: accounts.ROLE_WAREHOUSE, want: false},
+		{status: function.ORDER_STATUS_INVOICED, role: accounts.ROLE_WAREHOUSE, want: false},
+		{status: function.ORDER_STATUS_CANCELLED, role: accounts.ROLE_WAREHOUSE, want: false},
+		{status: function.ORDER_STATUS_CANCELLED, role: accounts.ROLE_ADMIN, want: true},
+		{status: function.ORDER_STATUS_SHIPPED, role: accounts.ROLE_ADMIN, want: true},
+		{status: function.ORDER_STATUS_SHIPPED, role: accounts.ROLE_SALES_REP, want: false},
+		{status: function.ORDER_STATUS_APPROVED, role: accounts.ROLE_CUSTOMER, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := accounts.HasPermission(tt.role, function.StatusPermission(tt.status)); got != tt.want {
+			t.Errorf("[%s %s] Expected %v, got %v", tt.role, tt.status, tt.want, got)
+		}
+	}
+}
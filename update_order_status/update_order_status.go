@@ -0,0 +1,245 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared"
+	"github.com/HarshMohanSason/AHSChemicalsGCShared/shared/accounts"
+)
+
+const (
+	ORDERS_COLLECTION = "orders"
+)
+
+// ErrOrderNotFound is returned when the requested order does not exist.
+var ErrOrderNotFound = errors.New("order not found")
+
+// UpdateOrderStatusRequest defines the structure of the incoming JSON request
+type UpdateOrderStatusRequest struct {
+	OrderID string `json:"order_id"` // Document ID in the orders collection (required)
+	Status  string `json:"status"`   // Status to move the order to (required)
+	Note    string `json:"note"`     // Reason for the change, stored in the history (optional)
+}
+
+// orderState holds the orders document fields needed to change the status.
+type orderState struct {
+	Status              string `firestore:"status"`
+	QuickBooksInvoiceID string `firestore:"quickbooks_invoice_id"`
+}
+
+func init() {
+	// Initialize Firebase and register the Cloud Function only in production environment.
+	if os.Getenv("ENV") != "DEBUG" {
+		shared.InitFirebaseProd(nil)
+		functions.HTTP("update-order-status", UpdateOrderStatus)
+	}
+}
+
+// UpdateOrderStatus moves an order to another status, rejecting transitions the order lifecycle does not
+// allow, and appends who made the change and when to the order's history. Moving an order to invoiced
+// creates its QuickBooks invoice through the quickbooks-create-invoice function first.
+//
+// Authentication: Requires a valid Firebase ID token in the Authorization header whose role grants the
+// permission of the requested status: the warehouse may ship and deliver orders, admins may also approve,
+// invoice and cancel them.
+// Method: PUT
+// URL Parameters:
+//   - realm_id: The QuickBooks company to invoice in when moving to invoiced (optional)
+//
+// Request Body: JSON matching UpdateOrderStatusRequest structure
+// Success Response: 200 OK with the order ID and its new status
+// Error Response: Appropriate HTTP status codes with descriptive error messages
+func UpdateOrderStatus(response http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	// Handle CORS and preflight requests
+	if shared.CorsEnabledFunction(response, request) {
+		return
+	}
+
+	// Only allow PUT method for status changes
+	if request.Method != http.MethodPut {
+		shared.WriteJSONError(response, http.StatusMethodNotAllowed, "Wrong HTTP method, expected PUT")
+		return
+	}
+
+	// Every role that may change a status can fulfill orders, the status itself is checked below
+	token, err := accounts.AuthorizeCaller(ctx, shared.AuthClient, request, accounts.PERMISSION_FULFILL_ORDERS)
+	if err != nil {
+		shared.WriteJSONError(response, accounts.AuthorizationStatus(err), err.Error())
+		return
+	}
+
+	defer request.Body.Close()
+
+	// Decode the JSON request body
+	var statusRequest UpdateOrderStatusRequest
+	if err := json.NewDecoder(request.Body).Decode(&statusRequest); err != nil {
+		log.Printf("JSON decode error: %v", err)
+		shared.WriteJSONError(response, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate required fields
+	if statusRequest.OrderID == "" {
+		shared.WriteJSONError(response, http.StatusBadRequest, "Order ID is required")
+		return
+	}
+	if !IsValidStatus(statusRequest.Status) {
+		shared.WriteJSONError(response, http.StatusBadRequest, fmt.Sprintf("Unknown order status: %q", statusRequest.Status))
+		return
+	}
+	if !accounts.HasPermission(accounts.RoleFromClaims(token.Claims), StatusPermission(statusRequest.Status)) {
+		shared.WriteJSONError(response, http.StatusForbidden, accounts.ErrPermissionDenied.Error())
+		return
+	}
+
+	orderRef := shared.FirestoreClient.Collection(ORDERS_COLLECTION).Doc(statusRequest.OrderID)
+
+	// Check the transition before any side effect such as creating the invoice
+	order, err := readOrderState(ctx, orderRef)
+	if errors.Is(err, ErrOrderNotFound) {
+		shared.WriteJSONError(response, http.StatusNotFound, "No order found with the given ID")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching order %s: %v", statusRequest.OrderID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error fetching the order")
+		return
+	}
+	if err := CheckTransition(order.Status, statusRequest.Status, order.QuickBooksInvoiceID); err != nil {
+		shared.WriteJSONError(response, http.StatusConflict, err.Error())
+		return
+	}
+
+	// An order is only invoiced once its QuickBooks invoice exists. A previous attempt may have created
+	// the invoice without changing the status, in which case it is not created again.
+	if statusRequest.Status == ORDER_STATUS_INVOICED && order.QuickBooksInvoiceID == "" {
+		if err := createInvoice(ctx, request.Header.Get("Authorization"), statusRequest.OrderID, request.URL.Query().Get("realm_id")); err != nil {
+			log.Printf("Error creating invoice for order %s: %v", statusRequest.OrderID, err)
+			shared.WriteJSONError(response, http.StatusBadGateway, "Error creating the QuickBooks invoice: "+err.Error())
+			return
+		}
+	}
+
+	change := StatusChange{
+		To:        statusRequest.Status,
+		ChangedBy: token.UID,
+		ChangedAt: time.Now(),
+		Note:      statusRequest.Note,
+	}
+
+	// Apply the change in a transaction so two callers cannot move the order concurrently
+	err = shared.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snapshot, err := tx.Get(orderRef)
+		if err != nil {
+			return err
+		}
+
+		var current orderState
+		if err := snapshot.DataTo(&current); err != nil {
+			return err
+		}
+
+		// quickbooks-create-invoice moves the order to invoiced along with writing the invoice ID
+		if change.To == ORDER_STATUS_INVOICED && current.Status == ORDER_STATUS_INVOICED && current.QuickBooksInvoiceID != "" {
+			change.From = ORDER_STATUS_APPROVED
+			return nil
+		}
+		if err := CheckTransition(current.Status, change.To, current.QuickBooksInvoiceID); err != nil {
+			return err
+		}
+
+		change.From = current.Status
+		return tx.Update(orderRef, []firestore.Update{
+			{Path: "status", Value: change.To},
+			{Path: "updated_at", Value: change.ChangedAt},
+			{Path: "history", Value: firestore.ArrayUnion(change)},
+		})
+	})
+
+	var transitionError *TransitionError
+	if errors.As(err, &transitionError) || errors.Is(err, ErrOrderInvoiced) {
+		shared.WriteJSONError(response, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating status of order %s: %v", statusRequest.OrderID, err)
+		shared.WriteJSONError(response, http.StatusInternalServerError, "Error updating the order status")
+		return
+	}
+
+	shared.WriteJSONSuccess(response, http.StatusOK, "Order status updated successfully", map[string]any{
+		"order_id": statusRequest.OrderID,
+		"status":   change.To,
+		"change":   change,
+	})
+}
+
+// readOrderState returns the status and QuickBooks invoice ID of the order.
+func readOrderState(ctx context.Context, orderRef *firestore.DocumentRef) (*orderState, error) {
+	snapshot, err := orderRef.Get(ctx)
+	if snapshot != nil && !snapshot.Exists() {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var order orderState
+	if err := snapshot.DataTo(&order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// createInvoice creates the QuickBooks invoice of the order through the quickbooks-create-invoice function,
+// which builds the invoice from the order, writes the invoice ID back onto it and moves it to invoiced.
+// That function keys the request on the order ID, so a retried or concurrent status change cannot create
+// a second invoice.
+func createInvoice(ctx context.Context, authorization string, orderID string, realmID string) error {
+	invoiceURL := os.Getenv("QUICKBOOKS_CREATE_INVOICE_URL")
+	if invoiceURL == "" {
+		return errors.New("QUICKBOOKS_CREATE_INVOICE_URL is not configured")
+	}
+	if realmID != "" {
+		invoiceURL += "?realm_id=" + url.QueryEscape(realmID)
+	}
+
+	body, err := json.Marshal(map[string]string{"order_id": orderID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, invoiceURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("quickbooks-create-invoice returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}